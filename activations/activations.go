@@ -1,6 +1,7 @@
 package activations
 
 import (
+	"math"
 	"nnscratch/maths"
 )
 
@@ -29,4 +30,99 @@ func DiffReLu(a float64) float64 {
 		return 0
 	}
 	return 1.0
-}
\ No newline at end of file
+}
+
+// leaky relu lets a small slope through for negative inputs
+func LeakyReLu(a float64, slope float64) float64 {
+	if a < 0 {
+		return slope * a
+	}
+	return a
+}
+
+func DiffLeakyReLu(a float64, slope float64) float64 {
+	if a < 0 {
+		return slope
+	}
+	return 1.0
+}
+
+// tanh function
+func Tanh(a float64) float64 {
+	return math.Tanh(a)
+}
+
+func DiffTanh(a float64) float64 {
+	t := math.Tanh(a)
+	return 1.0 - t*t
+}
+
+// gelu function using the exact gaussian cdf x * phi(x)
+func GELU(a float64) float64 {
+	return 0.5 * a * (1.0 + math.Erf(a/math.Sqrt2))
+}
+
+func DiffGELU(a float64) float64 {
+	cdf := 0.5 * (1.0 + math.Erf(a/math.Sqrt2))
+	pdf := maths.Exp(-0.5*a*a) / math.Sqrt(2*math.Pi)
+	return cdf + a*pdf
+}
+
+// elu function, alpha sets the value negative inputs level off at
+func ELU(a float64, alpha float64) float64 {
+	if a < 0 {
+		return alpha * (maths.Exp(a) - 1.0)
+	}
+	return a
+}
+
+func DiffELU(a float64, alpha float64) float64 {
+	if a < 0 {
+		return alpha * maths.Exp(a)
+	}
+	return 1.0
+}
+
+// selu constants from the self normalizing networks paper
+const (
+	SELUAlpha = 1.6732632423543772848170429916717
+	SELUScale = 1.0507009873554804934193349852946
+)
+
+// selu function
+func SELU(a float64) float64 {
+	return SELUScale * ELU(a, SELUAlpha)
+}
+
+func DiffSELU(a float64) float64 {
+	return SELUScale * DiffELU(a, SELUAlpha)
+}
+
+// swish function x * sigmoid(x) also called silu
+func Swish(a float64) float64 {
+	return a * Sigmoid(a)
+}
+
+func DiffSwish(a float64) float64 {
+	sigx := Sigmoid(a)
+	return sigx + a*sigx*(1.0-sigx)
+}
+
+// softplus function log(1 + e^x) written so it does not overflow
+func Softplus(a float64) float64 {
+	return math.Max(a, 0) + math.Log1p(maths.Exp(-math.Abs(a)))
+}
+
+func DiffSoftplus(a float64) float64 {
+	return Sigmoid(a)
+}
+
+// mish function x * tanh(softplus(x))
+func Mish(a float64) float64 {
+	return a * math.Tanh(Softplus(a))
+}
+
+func DiffMish(a float64) float64 {
+	t := math.Tanh(Softplus(a))
+	return t + a*(1.0-t*t)*Sigmoid(a)
+}
@@ -0,0 +1,171 @@
+package autograd
+
+import (
+	"fmt"
+	"nnscratch/layers"
+	"nnscratch/tensor"
+)
+
+// Runs an existing layer as one op of the graph, its hand written Backward
+// gives the gradient of the input and its parameter gradients. These are
+// added to what the parameters hold like the gradients of FromParameter, so a
+// parameter shared by several layers gets the sum. A layer keeps the input of
+// its last Forward so use it once per graph
+func LayerOp(l layers.Layer, x *Variable) (*Variable, error) {
+	value, err := l.Forward(x.Value)
+	if err != nil {
+		return nil, err
+	}
+	// the layer's parameters need gradients even when x does not
+	parents := []*Variable{x}
+	if !x.RequiresGrad && len(l.GetParameters()) > 0 {
+		parents = []*Variable{NewVariable(x.Value, true)}
+	}
+	return newResult(value, parents, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		// Backward overwrites the parameter gradients, clearing them first
+		// makes it give fresh tensors that are then added to the old ones
+		params := l.GetParameters()
+		held := make([]*tensor.Tensor, len(params))
+		for i, p := range params {
+			held[i], p.Grad = p.Grad, nil
+		}
+		gx, err := l.Backward(g, 0)
+		if err != nil {
+			return nil, err
+		}
+		for i, p := range params {
+			switch {
+			case p.Grad == nil:
+				p.Grad = held[i]
+			case held[i] != nil:
+				sum, err := tensor.TensorAdd(held[i], p.Grad)
+				if err != nil {
+					return nil, err
+				}
+				p.Grad = sum
+			}
+		}
+		return []*tensor.Tensor{gx}, nil
+	}), nil
+}
+
+// Runs an existing loss layer as one op of the graph giving a one element loss
+func LossOp(l layers.LossLayer, yPred *Variable, yActual *tensor.Tensor) (*Variable, error) {
+	loss, err := l.Loss(yPred.Value, yActual)
+	if err != nil {
+		return nil, err
+	}
+	value, _ := tensor.NewTensor(1)
+	value.Data()[0] = loss
+	return newResult(value, []*Variable{yPred}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		diff, err := l.Diffrential()
+		if err != nil {
+			return nil, err
+		}
+		gp, err := diff.MulScalar(g.Values()[0])
+		return []*tensor.Tensor{gp}, err
+	}), nil
+}
+
+// FuncLayer turns a forward function into a layers.Layer, Backward comes from
+// the graph the function builds so it can go in a Sequential like any layer.
+// Params are handed to the function in the same order as variables
+type FuncLayer struct {
+	Params []*layers.Parameter
+	Fn     func(input *Variable, params []*Variable) (*Variable, error)
+	input  *Variable
+	output *Variable
+}
+
+func NewFuncLayer(fn func(input *Variable, params []*Variable) (*Variable, error), params ...*layers.Parameter) *FuncLayer {
+	return &FuncLayer{
+		Params: params,
+		Fn:     fn,
+	}
+}
+
+func (f *FuncLayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	f.input = NewVariable(input, true)
+	params := make([]*Variable, len(f.Params))
+	for i, p := range f.Params {
+		params[i] = FromParameter(p)
+	}
+	out, err := f.Fn(f.input, params)
+	if err != nil {
+		return nil, err
+	}
+	f.output = out
+	return out.Value, nil
+}
+
+// Parameter gradients are added to what they hold, so zero them between steps
+func (f *FuncLayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	if f.output == nil {
+		return nil, fmt.Errorf("funcLayer: backward called before forward")
+	}
+	if f.output.RequiresGrad {
+		if err := f.output.BackwardWithGrad(gradOutput); err != nil {
+			return nil, err
+		}
+	}
+	if f.input.Grad == nil {
+		return tensor.NewTensor(f.input.Shape()...)
+	}
+	return f.input.Grad, nil
+}
+
+func (f *FuncLayer) GetParameters() []*layers.Parameter {
+	return f.Params
+}
+
+func (f *FuncLayer) GetWeights() []*tensor.Tensor {
+	weights := make([]*tensor.Tensor, len(f.Params))
+	for i, p := range f.Params {
+		weights[i] = p.Value
+	}
+	return weights
+}
+
+func (f *FuncLayer) GetBiases() []*tensor.Tensor {
+	return nil
+}
+
+// FuncLoss turns a function giving a one element loss into a layers.LossLayer
+type FuncLoss struct {
+	Fn   func(yPred *Variable, yActual *Variable) (*Variable, error)
+	pred *Variable
+	loss *Variable
+}
+
+func NewFuncLoss(fn func(yPred *Variable, yActual *Variable) (*Variable, error)) *FuncLoss {
+	return &FuncLoss{Fn: fn}
+}
+
+func (f *FuncLoss) Loss(y_pred *tensor.Tensor, y_actual *tensor.Tensor) (float64, error) {
+	f.pred = NewVariable(y_pred, true)
+	loss, err := f.Fn(f.pred, Constant(y_actual))
+	if err != nil {
+		return 0, err
+	}
+	if loss.Value.Len() != 1 {
+		return 0, fmt.Errorf("funcLoss: loss must have one element got shape %v", loss.Shape())
+	}
+	f.loss = loss
+	return loss.Value.Values()[0], nil
+}
+
+func (f *FuncLoss) Diffrential() (*tensor.Tensor, error) {
+	if f.loss == nil {
+		return nil, fmt.Errorf("funcLoss: diffrential called before loss")
+	}
+	f.pred.ZeroGrad()
+	if f.loss.RequiresGrad {
+		if err := f.loss.Backward(); err != nil {
+			return nil, err
+		}
+	}
+	if f.pred.Grad == nil {
+		return tensor.NewTensor(f.pred.Shape()...)
+	}
+	return f.pred.Grad, nil
+}
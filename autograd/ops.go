@@ -0,0 +1,328 @@
+package autograd
+
+import (
+	"math"
+	"nnscratch/tensor"
+)
+
+// Elementwise ops broadcast like their tensor counterparts, so the gradient
+// for each input is summed back down to that input's shape
+
+func Add(a, b *Variable) (*Variable, error) {
+	value, err := tensor.TensorAdd(a.Value, b.Value)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(value, []*Variable{a, b}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		return sumToInputs(g, a, b, g, g)
+	}), nil
+}
+
+func Sub(a, b *Variable) (*Variable, error) {
+	value, err := tensor.TensorDiff(a.Value, b.Value)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(value, []*Variable{a, b}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		gb, err := g.MulScalar(-1)
+		if err != nil {
+			return nil, err
+		}
+		return sumToInputs(g, a, b, g, gb)
+	}), nil
+}
+
+func Mul(a, b *Variable) (*Variable, error) {
+	value, err := tensor.TensorMul(a.Value, b.Value)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(value, []*Variable{a, b}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		ga, err := tensor.TensorMul(g, b.Value)
+		if err != nil {
+			return nil, err
+		}
+		gb, err := tensor.TensorMul(g, a.Value)
+		if err != nil {
+			return nil, err
+		}
+		return sumToInputs(g, a, b, ga, gb)
+	}), nil
+}
+
+func Div(a, b *Variable) (*Variable, error) {
+	value, err := tensor.TensorDiv(a.Value, b.Value)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(value, []*Variable{a, b}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		// d(a/b)/da = 1/b and d(a/b)/db = -(a/b)/b
+		ga, err := tensor.TensorDiv(g, b.Value)
+		if err != nil {
+			return nil, err
+		}
+		gb, err := tensor.TensorMul(ga, value)
+		if err != nil {
+			return nil, err
+		}
+		gb, _ = gb.MulScalar(-1)
+		return sumToInputs(g, a, b, ga, gb)
+	}), nil
+}
+
+func Pow(a, b *Variable) (*Variable, error) {
+	value, err := tensor.TensorPow(a.Value, b.Value)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(value, []*Variable{a, b}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		// d(a^b)/da = b * a^(b-1)
+		bMinus, _ := b.Value.AddScalar(-1)
+		da, err := tensor.TensorPow(a.Value, bMinus)
+		if err != nil {
+			return nil, err
+		}
+		da, _ = tensor.TensorMul(da, b.Value)
+		ga, err := tensor.TensorMul(g, da)
+		if err != nil {
+			return nil, err
+		}
+		// d(a^b)/db = a^b * ln(a), taken as 0 where a is not positive
+		lnA, _ := a.Value.Apply(func(x float64) float64 {
+			if x <= 0 {
+				return 0
+			}
+			return math.Log(x)
+		})
+		db, err := tensor.TensorMul(value, lnA)
+		if err != nil {
+			return nil, err
+		}
+		gb, err := tensor.TensorMul(g, db)
+		if err != nil {
+			return nil, err
+		}
+		return sumToInputs(g, a, b, ga, gb)
+	}), nil
+}
+
+// Elementwise minimum, on ties the gradient goes to a
+func Minimum(a, b *Variable) (*Variable, error) {
+	return choose(a, b, tensor.TensorMin, tensor.TensorLessEqual)
+}
+
+// Elementwise maximum, on ties the gradient goes to a
+func Maximum(a, b *Variable) (*Variable, error) {
+	return choose(a, b, tensor.TensorMax, tensor.TensorGreaterEqual)
+}
+
+// Picks a or b elementwise with op, pickA marks where a was picked
+func choose(a, b *Variable, op, pickA func(a, b *tensor.Tensor) (*tensor.Tensor, error)) (*Variable, error) {
+	value, err := op(a.Value, b.Value)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(value, []*Variable{a, b}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		maskA, err := pickA(a.Value, b.Value)
+		if err != nil {
+			return nil, err
+		}
+		ga, err := tensor.TensorMul(g, maskA)
+		if err != nil {
+			return nil, err
+		}
+		gb, err := tensor.TensorDiff(g, ga)
+		if err != nil {
+			return nil, err
+		}
+		return sumToInputs(g, a, b, ga, gb)
+	}), nil
+}
+
+// The comparisons give constants, they have no gradient
+func Equal(a, b *Variable) (*Variable, error) {
+	return compare(a, b, tensor.TensorEqual)
+}
+
+func NotEqual(a, b *Variable) (*Variable, error) {
+	return compare(a, b, tensor.TensorNotEqual)
+}
+
+func Greater(a, b *Variable) (*Variable, error) {
+	return compare(a, b, tensor.TensorGreater)
+}
+
+func GreaterEqual(a, b *Variable) (*Variable, error) {
+	return compare(a, b, tensor.TensorGreaterEqual)
+}
+
+func Less(a, b *Variable) (*Variable, error) {
+	return compare(a, b, tensor.TensorLess)
+}
+
+func LessEqual(a, b *Variable) (*Variable, error) {
+	return compare(a, b, tensor.TensorLessEqual)
+}
+
+func compare(a, b *Variable, op func(a, b *tensor.Tensor) (*tensor.Tensor, error)) (*Variable, error) {
+	value, err := op(a.Value, b.Value)
+	if err != nil {
+		return nil, err
+	}
+	return Constant(value), nil
+}
+
+// Sums the gradients of a broadcast binary op back to the input shapes
+func sumToInputs(g *tensor.Tensor, a, b *Variable, ga, gb *tensor.Tensor) ([]*tensor.Tensor, error) {
+	ga, err := ga.SumTo(a.Shape()...)
+	if err != nil {
+		return nil, err
+	}
+	gb, err = gb.SumTo(b.Shape()...)
+	if err != nil {
+		return nil, err
+	}
+	return []*tensor.Tensor{ga, gb}, nil
+}
+
+func AddScalar(a *Variable, s float64) (*Variable, error) {
+	value, err := a.Value.AddScalar(s)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(value, []*Variable{a}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		return []*tensor.Tensor{g}, nil
+	}), nil
+}
+
+func MulScalar(a *Variable, s float64) (*Variable, error) {
+	value, err := a.Value.MulScalar(s)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(value, []*Variable{a}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		ga, err := g.MulScalar(s)
+		return []*tensor.Tensor{ga}, err
+	}), nil
+}
+
+// Raises every value to the power p
+func Power(a *Variable, p float64) (*Variable, error) {
+	value, err := a.Value.Power(p)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(value, []*Variable{a}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		d, err := a.Value.Apply(func(x float64) float64 {
+			return p * math.Pow(x, p-1)
+		})
+		if err != nil {
+			return nil, err
+		}
+		ga, err := tensor.TensorMul(g, d)
+		return []*tensor.Tensor{ga}, err
+	}), nil
+}
+
+// Applies fn to every value, diff is the derivative of fn
+func Apply(a *Variable, fn func(float64) float64, diff func(float64) float64) (*Variable, error) {
+	value, err := a.Value.Apply(fn)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(value, []*Variable{a}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		d, err := a.Value.Apply(diff)
+		if err != nil {
+			return nil, err
+		}
+		ga, err := tensor.TensorMul(g, d)
+		return []*tensor.Tensor{ga}, err
+	}), nil
+}
+
+func Exp(a *Variable) (*Variable, error) {
+	return Apply(a, math.Exp, math.Exp)
+}
+
+func Log(a *Variable) (*Variable, error) {
+	return Apply(a, math.Log, func(x float64) float64 {
+		return 1 / x
+	})
+}
+
+// Matrix multiplication with the same cases as tensor.Matmul
+func Matmul(a, b *Variable) (*Variable, error) {
+	value, err := tensor.Matmul(a.Value, b.Value)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(value, []*Variable{a, b}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		ra, rb := len(a.Shape()), len(b.Shape())
+		switch {
+		// (m) . (m) => (1)
+		case ra == 1 && rb == 1:
+			ga, err := tensor.TensorMul(b.Value, g)
+			if err != nil {
+				return nil, err
+			}
+			gb, err := tensor.TensorMul(a.Value, g)
+			return []*tensor.Tensor{ga, gb}, err
+		// (m, k) * (k) => (m)
+		case ra == 2 && rb == 1:
+			gCol, _ := g.Unsqeeze(1)
+			ga, err := tensor.TensorMul(gCol, b.Value)
+			if err != nil {
+				return nil, err
+			}
+			aT, _ := a.Value.Transpose()
+			gb, err := tensor.Matmul(aT, g)
+			return []*tensor.Tensor{ga, gb}, err
+		}
+		// (..., m, k) * (..., k, p) => (..., m, p), the batch dims broadcast so
+		// the gradients are summed back down to the input shapes
+		bT, err := b.Value.TransposeAxes(-1, -2)
+		if err != nil {
+			return nil, err
+		}
+		ga, err := tensor.Matmul(g, bT)
+		if err != nil {
+			return nil, err
+		}
+		aT, err := a.Value.TransposeAxes(-1, -2)
+		if err != nil {
+			return nil, err
+		}
+		gb, err := tensor.Matmul(aT, g)
+		if err != nil {
+			return nil, err
+		}
+		return sumToInputs(g, a, b, ga, gb)
+	}), nil
+}
+
+// Stacks like tensor.TensorCombine
+func Combine(a, b *Variable) (*Variable, error) {
+	value, err := tensor.TensorCombine(a.Value, b.Value)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(value, []*Variable{a, b}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		n := 1
+		if len(a.Shape()) > len(b.Shape()) {
+			n = a.Shape()[0]
+		}
+		ga, err := g.Narrow(0, 0, n)
+		if err != nil {
+			return nil, err
+		}
+		ga, err = ga.Reshape(a.Shape()...)
+		if err != nil {
+			return nil, err
+		}
+		gb, err := g.Slice(n)
+		if err != nil {
+			return nil, err
+		}
+		return []*tensor.Tensor{ga, gb}, nil
+	}), nil
+}
@@ -0,0 +1,107 @@
+package autograd
+
+import (
+	"nnscratch/layers"
+	"nnscratch/tensor"
+	"slices"
+	"testing"
+)
+
+func leaf(t *testing.T, data []float64, shape ...int) *Variable {
+	t.Helper()
+	value, err := tensor.NewTensorInput(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err = value.Reshape(shape...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewVariable(value, true)
+}
+
+func backwardSum(t *testing.T, v *Variable) {
+	t.Helper()
+	sum, err := Sum(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sum.Backward(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMatmulBatchedGrad(t *testing.T) {
+	// (2, 2, 3) * (2, 3, 2), one matrix product per batch entry
+	a := leaf(t, []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, 2, 2, 3)
+	b := leaf(t, []float64{1, -1, 2, 0, 0.5, 3, 0, 1, 1, 1, -2, 2}, 2, 3, 2)
+	out, err := Matmul(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backwardSum(t, out)
+
+	// with a gradient of ones, d/da[n, m, k] is the row sum of b[n, k] and
+	// d/db[n, k, p] is a[n, .., k] summed over the rows
+	wantA := []float64{0, 2, 3.5, 0, 2, 3.5, 1, 2, 0, 1, 2, 0}
+	wantB := []float64{5, 5, 7, 7, 9, 9, 17, 17, 19, 19, 21, 21}
+	if !slices.Equal(a.Grad.Shape(), a.Shape()) || !slices.Equal(a.Grad.Values(), wantA) {
+		t.Errorf("a grad %v with shape %v, expected %v", a.Grad.Values(), a.Grad.Shape(), wantA)
+	}
+	if !slices.Equal(b.Grad.Shape(), b.Shape()) || !slices.Equal(b.Grad.Values(), wantB) {
+		t.Errorf("b grad %v with shape %v, expected %v", b.Grad.Values(), b.Grad.Shape(), wantB)
+	}
+}
+
+func TestMatmulBroadcastGrad(t *testing.T) {
+	// (2, 2, 3) * (1, 3, 2), b is broadcast over the batch
+	a := leaf(t, []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, 2, 2, 3)
+	b := leaf(t, []float64{1, -1, 2, 0, 0.5, 3}, 1, 3, 2)
+	out, err := Matmul(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backwardSum(t, out)
+
+	// b's gradient is summed over the batch it was broadcast to
+	wantA := []float64{0, 2, 3.5, 0, 2, 3.5, 0, 2, 3.5, 0, 2, 3.5}
+	wantB := []float64{22, 22, 26, 26, 30, 30}
+	if !slices.Equal(a.Grad.Shape(), a.Shape()) || !slices.Equal(a.Grad.Values(), wantA) {
+		t.Errorf("a grad %v with shape %v, expected %v", a.Grad.Values(), a.Grad.Shape(), wantA)
+	}
+	if !slices.Equal(b.Grad.Shape(), b.Shape()) || !slices.Equal(b.Grad.Values(), wantB) {
+		t.Errorf("b grad %v with shape %v, expected %v", b.Grad.Values(), b.Grad.Shape(), wantB)
+	}
+}
+
+func TestLayerOpSharedParameter(t *testing.T) {
+	// two dense layers tied to one weight
+	first, second := layers.NewDenseLayer(2, 1), layers.NewDenseLayer(2, 1)
+	second.Weights = first.Weights
+	x1, _ := tensor.NewTensorInput([][]float64{{1, 0}})
+	x2, _ := tensor.NewTensorInput([][]float64{{0, 3}})
+
+	out1, err := LayerOp(first, Constant(x1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out2, err := LayerOp(second, Constant(x2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := Add(out1, out2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backwardSum(t, out)
+
+	// each use adds its input to the gradient of the shared weight
+	if got, want := first.Weights.Grad.Values(), []float64{1, 3}; !slices.Equal(got, want) {
+		t.Errorf("shared weight grad %v, expected %v", got, want)
+	}
+	for _, l := range []*layers.DenseLayer{first, second} {
+		if got := l.Bias.Grad.Values(); !slices.Equal(got, []float64{1}) {
+			t.Errorf("bias grad %v, expected [1]", got)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package autograd
+
+import (
+	"math"
+	"nnscratch/tensor"
+)
+
+// Gives the input shape with the reduced axes set to 1, no axes means all
+func keptShape(shape []int, axes []int) []int {
+	kept := append([]int(nil), shape...)
+	if len(axes) == 0 {
+		for i := range kept {
+			kept[i] = 1
+		}
+		return kept
+	}
+	for _, a := range axes {
+		if a < 0 {
+			a += len(shape)
+		}
+		kept[a] = 1
+	}
+	return kept
+}
+
+// Spreads a reduced tensor back over the input shape
+func spread(t *tensor.Tensor, shape []int, axes []int) (*tensor.Tensor, error) {
+	kept, err := t.Reshape(keptShape(shape, axes)...)
+	if err != nil {
+		return nil, err
+	}
+	return kept.Expand(shape...)
+}
+
+// Number of input values behind every reduced value
+func reducedCount(shape []int, axes []int) float64 {
+	kept := keptShape(shape, axes)
+	count := 1
+	for i := range shape {
+		if kept[i] == 1 {
+			count *= shape[i]
+		}
+	}
+	return float64(count)
+}
+
+// Sum of every value as a one element variable
+func Sum(a *Variable) (*Variable, error) {
+	return SumAxis(a, false)
+}
+
+func SumAxis(a *Variable, keepDims bool, axes ...int) (*Variable, error) {
+	value, err := a.Value.SumAxis(keepDims, axes...)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(value, []*Variable{a}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		ga, err := spread(g, a.Shape(), axes)
+		return []*tensor.Tensor{ga}, err
+	}), nil
+}
+
+func Mean(a *Variable, keepDims bool, axes ...int) (*Variable, error) {
+	sum, err := SumAxis(a, keepDims, axes...)
+	if err != nil {
+		return nil, err
+	}
+	return MulScalar(sum, 1/reducedCount(a.Shape(), axes))
+}
+
+func Prod(a *Variable, keepDims bool, axes ...int) (*Variable, error) {
+	value, err := a.Value.Prod(keepDims, axes...)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(value, []*Variable{a}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		// d(prod)/dx = prod/x, so this needs x to be non zero
+		gp, err := tensor.TensorMul(g, value)
+		if err != nil {
+			return nil, err
+		}
+		gp, err = spread(gp, a.Shape(), axes)
+		if err != nil {
+			return nil, err
+		}
+		ga, err := tensor.TensorDiv(gp, a.Value)
+		return []*tensor.Tensor{ga}, err
+	}), nil
+}
+
+// Largest value over the axes, ties share the gradient equally
+func MaxAxis(a *Variable, keepDims bool, axes ...int) (*Variable, error) {
+	value, err := a.Value.Max(keepDims, axes...)
+	if err != nil {
+		return nil, err
+	}
+	return extremum(a, value, a.Value, nil, axes), nil
+}
+
+// Smallest value over the axes, ties share the gradient equally
+func MinAxis(a *Variable, keepDims bool, axes ...int) (*Variable, error) {
+	value, err := a.Value.Min(keepDims, axes...)
+	if err != nil {
+		return nil, err
+	}
+	return extremum(a, value, a.Value, nil, axes), nil
+}
+
+// Sends the gradient of a max or min to the positions of source holding the
+// picked value, times sign when it is given
+func extremum(a *Variable, value, source, sign *tensor.Tensor, axes []int) *Variable {
+	return newResult(value, []*Variable{a}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		picked, err := spread(value, a.Shape(), axes)
+		if err != nil {
+			return nil, err
+		}
+		mask, err := tensor.TensorEqual(source, picked)
+		if err != nil {
+			return nil, err
+		}
+		ties, err := mask.SumAxis(true, axes...)
+		if err != nil {
+			return nil, err
+		}
+		share, err := g.Reshape(ties.Shape()...)
+		if err != nil {
+			return nil, err
+		}
+		share, err = tensor.TensorDiv(share, ties)
+		if err != nil {
+			return nil, err
+		}
+		ga, err := tensor.TensorMul(mask, share)
+		if err != nil {
+			return nil, err
+		}
+		if sign != nil {
+			ga, err = tensor.TensorMul(ga, sign)
+		}
+		return []*tensor.Tensor{ga}, err
+	})
+}
+
+// Population variance over the axes
+func Var(a *Variable, keepDims bool, axes ...int) (*Variable, error) {
+	value, err := a.Value.Var(keepDims, axes...)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(value, []*Variable{a}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		// d(var)/dx = 2(x - mean)/n
+		centered, err := centre(a.Value, axes)
+		if err != nil {
+			return nil, err
+		}
+		scale, err := spread(g, a.Shape(), axes)
+		if err != nil {
+			return nil, err
+		}
+		ga, err := tensor.TensorMul(centered, scale)
+		if err != nil {
+			return nil, err
+		}
+		ga, err = ga.MulScalar(2 / reducedCount(a.Shape(), axes))
+		return []*tensor.Tensor{ga}, err
+	}), nil
+}
+
+// Population standard deviation over the axes
+func Std(a *Variable, keepDims bool, axes ...int) (*Variable, error) {
+	value, err := a.Value.Std(keepDims, axes...)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(value, []*Variable{a}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		// d(std)/dx = (x - mean)/(n * std)
+		centered, err := centre(a.Value, axes)
+		if err != nil {
+			return nil, err
+		}
+		scale, err := tensor.TensorDiv(g, value)
+		if err != nil {
+			return nil, err
+		}
+		scale, err = spread(scale, a.Shape(), axes)
+		if err != nil {
+			return nil, err
+		}
+		ga, err := tensor.TensorMul(centered, scale)
+		if err != nil {
+			return nil, err
+		}
+		ga, err = ga.MulScalar(1 / reducedCount(a.Shape(), axes))
+		return []*tensor.Tensor{ga}, err
+	}), nil
+}
+
+// Takes the mean over the axes away from every value
+func centre(t *tensor.Tensor, axes []int) (*tensor.Tensor, error) {
+	mean, err := t.Mean(true, axes...)
+	if err != nil {
+		return nil, err
+	}
+	return tensor.TensorDiff(t, mean)
+}
+
+func LogSumExp(a *Variable, keepDims bool, axes ...int) (*Variable, error) {
+	value, err := a.Value.LogSumExp(keepDims, axes...)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(value, []*Variable{a}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		// the gradient is the softmax of the input over the axes
+		lse, err := spread(value, a.Shape(), axes)
+		if err != nil {
+			return nil, err
+		}
+		softmax, err := tensor.TensorDiff(a.Value, lse)
+		if err != nil {
+			return nil, err
+		}
+		softmax, _ = softmax.Apply(math.Exp)
+		scale, err := spread(g, a.Shape(), axes)
+		if err != nil {
+			return nil, err
+		}
+		ga, err := tensor.TensorMul(softmax, scale)
+		return []*tensor.Tensor{ga}, err
+	}), nil
+}
+
+// The p norm over the axes, p can be math.Inf(1)
+func Norm(a *Variable, p float64, keepDims bool, axes ...int) (*Variable, error) {
+	value, err := a.Value.Norm(p, keepDims, axes...)
+	if err != nil {
+		return nil, err
+	}
+	sign, _ := a.Value.Apply(func(x float64) float64 {
+		switch {
+		case x > 0:
+			return 1
+		case x < 0:
+			return -1
+		}
+		return 0
+	})
+	if math.IsInf(p, 1) {
+		abs, _ := a.Value.Apply(math.Abs)
+		return extremum(a, value, abs, sign, axes), nil
+	}
+	return newResult(value, []*Variable{a}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		// d|x|_p/dx = sign(x) |x|^(p-1) / |x|_p^(p-1)
+		scale, err := value.Apply(func(n float64) float64 {
+			if n == 0 {
+				return 0
+			}
+			return 1 / math.Pow(n, p-1)
+		})
+		if err != nil {
+			return nil, err
+		}
+		scale, err = tensor.TensorMul(g, scale)
+		if err != nil {
+			return nil, err
+		}
+		scale, err = spread(scale, a.Shape(), axes)
+		if err != nil {
+			return nil, err
+		}
+		d, _ := a.Value.Apply(func(x float64) float64 {
+			return math.Pow(math.Abs(x), p-1)
+		})
+		d, _ = tensor.TensorMul(d, sign)
+		ga, err := tensor.TensorMul(d, scale)
+		return []*tensor.Tensor{ga}, err
+	}), nil
+}
@@ -0,0 +1,174 @@
+package autograd
+
+import (
+	"nnscratch/tensor"
+)
+
+// The gradient of a view is the incoming gradient placed in the same view
+// of a zero tensor shaped like the input
+
+// Runs a view op on the input and sends gradients back through the same view
+func viewOp(a *Variable, view func(t *tensor.Tensor) (*tensor.Tensor, error)) (*Variable, error) {
+	value, err := view(a.Value)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(value, []*Variable{a}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		ga, err := tensor.NewTensor(a.Shape()...)
+		if err != nil {
+			return nil, err
+		}
+		window, err := view(ga)
+		if err != nil {
+			return nil, err
+		}
+		return []*tensor.Tensor{ga}, window.SetTensor(g)
+	}), nil
+}
+
+func Slice(a *Variable, coords ...int) (*Variable, error) {
+	return viewOp(a, func(t *tensor.Tensor) (*tensor.Tensor, error) {
+		return t.Slice(coords...)
+	})
+}
+
+func View(a *Variable, start, end int) (*Variable, error) {
+	return viewOp(a, func(t *tensor.Tensor) (*tensor.Tensor, error) {
+		return t.View(start, end)
+	})
+}
+
+func Narrow(a *Variable, dim, start, length int) (*Variable, error) {
+	return viewOp(a, func(t *tensor.Tensor) (*tensor.Tensor, error) {
+		return t.Narrow(dim, start, length)
+	})
+}
+
+func SliceRange(a *Variable, dim, start, end, step int) (*Variable, error) {
+	return viewOp(a, func(t *tensor.Tensor) (*tensor.Tensor, error) {
+		return t.SliceRange(dim, start, end, step)
+	})
+}
+
+func Transpose(a *Variable) (*Variable, error) {
+	value, err := a.Value.Transpose()
+	if err != nil {
+		return nil, err
+	}
+	return newResult(value, []*Variable{a}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		ga, err := g.Transpose()
+		return []*tensor.Tensor{ga}, err
+	}), nil
+}
+
+func TransposeAxes(a *Variable, dim0, dim1 int) (*Variable, error) {
+	value, err := a.Value.TransposeAxes(dim0, dim1)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(value, []*Variable{a}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		ga, err := g.TransposeAxes(dim0, dim1)
+		return []*tensor.Tensor{ga}, err
+	}), nil
+}
+
+func Permute(a *Variable, dims ...int) (*Variable, error) {
+	value, err := a.Value.Permute(dims...)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(value, []*Variable{a}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		// dimension dims[i] of the input became dimension i of the output
+		inverse := make([]int, len(dims))
+		for i, d := range dims {
+			if d < 0 {
+				d += len(dims)
+			}
+			inverse[d] = i
+		}
+		ga, err := g.Permute(inverse...)
+		return []*tensor.Tensor{ga}, err
+	}), nil
+}
+
+// Runs an op that only changes the shape, the gradient is reshaped back
+func reshapeOp(a *Variable, value *tensor.Tensor, err error) (*Variable, error) {
+	if err != nil {
+		return nil, err
+	}
+	return newResult(value, []*Variable{a}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		ga, err := g.Reshape(a.Shape()...)
+		return []*tensor.Tensor{ga}, err
+	}), nil
+}
+
+func Reshape(a *Variable, shape ...int) (*Variable, error) {
+	value, err := a.Value.Reshape(shape...)
+	return reshapeOp(a, value, err)
+}
+
+func Flatten(a *Variable) (*Variable, error) {
+	value, err := a.Value.Flatten()
+	return reshapeOp(a, value, err)
+}
+
+func Unsqeeze(a *Variable, pos int) (*Variable, error) {
+	value, err := a.Value.Unsqeeze(pos)
+	return reshapeOp(a, value, err)
+}
+
+func Expand(a *Variable, shape ...int) (*Variable, error) {
+	value, err := a.Value.Expand(shape...)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(value, []*Variable{a}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		ga, err := g.SumTo(a.Shape()...)
+		return []*tensor.Tensor{ga}, err
+	}), nil
+}
+
+func BroadcastTo(a *Variable, shape ...int) (*Variable, error) {
+	if _, err := a.Value.BroadcastTo(shape...); err != nil {
+		return nil, err
+	}
+	return Expand(a, shape...)
+}
+
+func Copy(a *Variable) (*Variable, error) {
+	return newResult(a.Value.Copy(), []*Variable{a}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		return []*tensor.Tensor{g}, nil
+	}), nil
+}
+
+// Gathers rows like tensor.GetBatchElements, repeated rows add up their gradients
+func GetBatchElements(a *Variable, indices []int) (*Variable, error) {
+	value, err := a.Value.GetBatchElements(indices)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(value, []*Variable{a}, func(g *tensor.Tensor) ([]*tensor.Tensor, error) {
+		ga, err := tensor.NewTensor(a.Shape()...)
+		if err != nil {
+			return nil, err
+		}
+		for i, row := range indices {
+			gi, err := g.Slice(i)
+			if err != nil {
+				return nil, err
+			}
+			prev, err := ga.Slice(row)
+			if err != nil {
+				return nil, err
+			}
+			sum, err := tensor.TensorAdd(prev, gi)
+			if err != nil {
+				return nil, err
+			}
+			if err := prev.SetTensor(sum); err != nil {
+				return nil, err
+			}
+		}
+		return []*tensor.Tensor{ga}, nil
+	}), nil
+}
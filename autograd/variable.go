@@ -0,0 +1,185 @@
+package autograd
+
+import (
+	"fmt"
+	"nnscratch/layers"
+	"nnscratch/tensor"
+)
+
+// Variable wraps a tensor and remembers the op that made it, so calling
+// Backward on a result fills in Grad on every leaf that requires it
+type Variable struct {
+	Value        *tensor.Tensor
+	Grad         *tensor.Tensor
+	RequiresGrad bool
+
+	// set when the variable stands for a layers.Parameter
+	param *layers.Parameter
+	// the inputs of the op that made this variable and how to send a
+	// gradient back to each of them, both nil for leaves
+	parents  []*Variable
+	backward func(grad *tensor.Tensor) ([]*tensor.Tensor, error)
+}
+
+// Makes a leaf variable
+func NewVariable(value *tensor.Tensor, requiresGrad bool) *Variable {
+	return &Variable{
+		Value:        value,
+		RequiresGrad: requiresGrad,
+	}
+}
+
+// Makes a leaf variable that is never differentiated
+func Constant(value *tensor.Tensor) *Variable {
+	return NewVariable(value, false)
+}
+
+// Makes a leaf variable for the parameter, gradients reaching it are added
+// into the parameter's Grad so the optimizers in optim can step it as usual
+func FromParameter(p *layers.Parameter) *Variable {
+	v := NewVariable(p.Value, true)
+	v.param = p
+	return v
+}
+
+// Gives a new leaf with the same value that is cut off from the graph
+func (v *Variable) Detach() *Variable {
+	return Constant(v.Value)
+}
+
+// Clears the gradient of the variable
+func (v *Variable) ZeroGrad() {
+	v.Grad = nil
+}
+
+// Shape of the value
+func (v *Variable) Shape() []int {
+	return v.Value.Shape()
+}
+
+// Makes the result of an op, the graph is only recorded when one of the
+// parents needs a gradient
+func newResult(value *tensor.Tensor, parents []*Variable, backward func(grad *tensor.Tensor) ([]*tensor.Tensor, error)) *Variable {
+	result := Constant(value)
+	for _, p := range parents {
+		if p.RequiresGrad {
+			result.RequiresGrad = true
+			result.parents = parents
+			result.backward = backward
+			break
+		}
+	}
+	return result
+}
+
+// Backpropagates from a one element variable such as a loss
+func (v *Variable) Backward() error {
+	if v.Value.Len() != 1 {
+		return fmt.Errorf("backward: needs a one element variable got shape %v, use BackwardWithGrad", v.Shape())
+	}
+	ones, err := tensor.NewTensorOnes(v.Shape()...)
+	if err != nil {
+		return err
+	}
+	return v.BackwardWithGrad(ones)
+}
+
+// Backpropagates grad, the gradient of some scalar with respect to v, through
+// the graph. Gradients are added to what the leaves already hold
+func (v *Variable) BackwardWithGrad(grad *tensor.Tensor) error {
+	if !v.RequiresGrad {
+		return fmt.Errorf("backward: variable does not require grad")
+	}
+	if !tensor.ShapesMatch(v.Value, grad) {
+		return fmt.Errorf("backward: gradient shape %v does not match variable shape %v", grad.Shape(), v.Shape())
+	}
+
+	order := v.topoOrder()
+	grads := map[*Variable]*tensor.Tensor{v: grad}
+	for i := len(order) - 1; i >= 0; i-- {
+		node := order[i]
+		g := grads[node]
+		if g == nil {
+			continue
+		}
+		delete(grads, node)
+		if node.backward == nil {
+			if err := node.accumulate(g); err != nil {
+				return err
+			}
+			continue
+		}
+		parentGrads, err := node.backward(g)
+		if err != nil {
+			return err
+		}
+		for k, p := range node.parents {
+			if !p.RequiresGrad || parentGrads[k] == nil {
+				continue
+			}
+			if prev, ok := grads[p]; ok {
+				sum, err := tensor.TensorAdd(prev, parentGrads[k])
+				if err != nil {
+					return err
+				}
+				grads[p] = sum
+			} else {
+				grads[p] = parentGrads[k]
+			}
+		}
+	}
+	return nil
+}
+
+// Every variable that needs a gradient and leads to v, parents before children
+func (v *Variable) topoOrder() []*Variable {
+	var order []*Variable
+	visited := map[*Variable]bool{}
+	type frame struct {
+		node *Variable
+		next int
+	}
+	stack := []frame{{node: v}}
+	visited[v] = true
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		if top.next < len(top.node.parents) {
+			p := top.node.parents[top.next]
+			top.next++
+			if p.RequiresGrad && !visited[p] {
+				visited[p] = true
+				stack = append(stack, frame{node: p})
+			}
+			continue
+		}
+		order = append(order, top.node)
+		stack = stack[:len(stack)-1]
+	}
+	return order
+}
+
+// Adds the gradient into a leaf and the parameter behind it
+func (v *Variable) accumulate(g *tensor.Tensor) error {
+	sum, err := addGrad(v.Grad, g)
+	if err != nil {
+		return err
+	}
+	v.Grad = sum
+	if v.param != nil {
+		sum, err := addGrad(v.param.Grad, g)
+		if err != nil {
+			return err
+		}
+		v.param.Grad = sum
+	}
+	return nil
+}
+
+// Adds g to a stored gradient, the result never shares data with g so it
+// can be zeroed in place later
+func addGrad(stored, g *tensor.Tensor) (*tensor.Tensor, error) {
+	if stored == nil || !tensor.ShapesMatch(stored, g) {
+		return g.Copy(), nil
+	}
+	return tensor.TensorAdd(stored, g)
+}
@@ -0,0 +1,292 @@
+// Package checkpoint saves a training run, its parameters, optimizer and
+// scheduler state, epoch, random generators and place in the data, so that it
+// can carry on after an interruption exactly as if it had never stopped.
+package checkpoint
+
+import (
+	"fmt"
+	"io"
+	"nnscratch/internal/binfmt"
+	"nnscratch/layers"
+	"nnscratch/optim"
+	"nnscratch/random"
+	"nnscratch/tensor"
+	"nnscratch/utils"
+	"sort"
+)
+
+// Checkpoint files start with this magic, the version goes up whenever the
+// layout of the payload changes
+const (
+	checkpointMagic = "NNCK"
+	Version         = 1
+)
+
+// Anything with parameters, models with buffers like batch norm statistics
+// also implement layers.BufferLayer
+type Model interface {
+	GetParameters() []*layers.Parameter
+}
+
+// A training run. Save reads it and Load restores into it, so the model,
+// optimizer, scheduler, generators and loader given to Load must be built the
+// same way as the ones that were saved. Only the architecture is not saved, use
+// layers.Save for that
+type Run struct {
+	Epoch      int
+	Model      Model
+	Optimizer  optim.Stateful       // nil when there is none
+	Scheduler  optim.Stateful       // learning rate scheduler, nil when there is none
+	Generators []*random.Generator  // random.Default() when empty
+	Loader     *utils.DataLoader    // needed by Load to rebuild Iterator
+	Iterator   *utils.BatchIterator // place in the current epoch, nil between epochs
+}
+
+func (run *Run) generators() []*random.Generator {
+	if len(run.Generators) == 0 {
+		return []*random.Generator{random.Default()}
+	}
+	return run.Generators
+}
+
+func buffersOf(m Model) []*tensor.Tensor {
+	if b, ok := m.(layers.BufferLayer); ok {
+		return b.GetBuffers()
+	}
+	return nil
+}
+
+func writeTensors(enc *binfmt.Writer, ts []*tensor.Tensor) {
+	enc.WriteUint32(uint32(len(ts)))
+	for _, t := range ts {
+		enc.WriteTensor(t)
+	}
+}
+
+func readTensors(dec *binfmt.Reader) []*tensor.Tensor {
+	ts := make([]*tensor.Tensor, dec.ReadUint32())
+	for i := range ts {
+		if dec.Err() != nil {
+			return nil
+		}
+		ts[i] = dec.ReadTensor()
+	}
+	return ts
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Optimizer and scheduler state is its scalars then its tensor lists, both sorted by name.
+// Every tensor is preceded by a flag, 0 for the nil ones
+func writeState(enc *binfmt.Writer, state optim.State) {
+	enc.WriteUint32(uint32(len(state.Scalars)))
+	for _, name := range sortedKeys(state.Scalars) {
+		enc.WriteString(name)
+		enc.WriteFloat64(state.Scalars[name])
+	}
+	enc.WriteUint32(uint32(len(state.Tensors)))
+	for _, name := range sortedKeys(state.Tensors) {
+		enc.WriteString(name)
+		enc.WriteUint32(uint32(len(state.Tensors[name])))
+		for _, t := range state.Tensors[name] {
+			if t == nil {
+				enc.WriteUint32(0)
+				continue
+			}
+			enc.WriteUint32(1)
+			enc.WriteTensor(t)
+		}
+	}
+}
+
+func readState(dec *binfmt.Reader) optim.State {
+	state := optim.State{
+		Scalars: make(map[string]float64),
+		Tensors: make(map[string][]*tensor.Tensor),
+	}
+	for n := dec.ReadUint32(); n > 0 && dec.Err() == nil; n-- {
+		name := dec.ReadString()
+		state.Scalars[name] = dec.ReadFloat64()
+	}
+	for n := dec.ReadUint32(); n > 0 && dec.Err() == nil; n-- {
+		name := dec.ReadString()
+		ts := make([]*tensor.Tensor, dec.ReadUint32())
+		for i := range ts {
+			if dec.Err() != nil {
+				break
+			}
+			if dec.ReadUint32() != 0 {
+				ts[i] = dec.ReadTensor()
+			}
+		}
+		state.Tensors[name] = ts
+	}
+	return state
+}
+
+// Writes the state of run
+func Save(w io.Writer, run *Run) error {
+	if run.Model == nil {
+		return fmt.Errorf("checkpoint: no model to save")
+	}
+	enc := &binfmt.Writer{}
+	enc.WriteInt64(int64(run.Epoch))
+
+	params := run.Model.GetParameters()
+	values := make([]*tensor.Tensor, len(params))
+	for i, p := range params {
+		values[i] = p.Value
+	}
+	writeTensors(enc, values)
+	writeTensors(enc, buffersOf(run.Model))
+
+	for _, stateful := range []optim.Stateful{run.Optimizer, run.Scheduler} {
+		if stateful == nil {
+			enc.WriteUint32(0)
+			continue
+		}
+		enc.WriteUint32(1)
+		writeState(enc, stateful.StateDict())
+	}
+
+	gens := run.generators()
+	enc.WriteUint32(uint32(len(gens)))
+	for _, g := range gens {
+		enc.WriteUint64(g.State())
+	}
+
+	if run.Iterator == nil {
+		enc.WriteUint32(0)
+	} else {
+		state := run.Iterator.State()
+		enc.WriteUint32(1)
+		enc.WriteInts(state.Indices)
+		enc.WriteInt64(int64(state.Current))
+	}
+	return binfmt.WriteFramed(w, checkpointMagic, Version, enc.Payload())
+}
+
+// Restores a run written by Save into run. Everything is read and checked
+// before anything in run changes, so a failed Load leaves run as it was
+func Load(r io.Reader, run *Run) error {
+	if run.Model == nil {
+		return fmt.Errorf("checkpoint: no model to load into")
+	}
+	version, payload, err := binfmt.ReadFramed(r, checkpointMagic)
+	if err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+	if version != Version {
+		return fmt.Errorf("checkpoint: unsupported version %d, expected %d", version, Version)
+	}
+	dec := binfmt.NewReader(payload)
+	epoch := int(dec.ReadInt64())
+	values := readTensors(dec)
+	buffers := readTensors(dec)
+	hasState := dec.ReadUint32() != 0
+	var state optim.State
+	if hasState {
+		state = readState(dec)
+	}
+	hasSchedulerState := dec.ReadUint32() != 0
+	var schedulerState optim.State
+	if hasSchedulerState {
+		schedulerState = readState(dec)
+	}
+	genStates := make([]uint64, dec.ReadUint32())
+	for i := range genStates {
+		if dec.Err() != nil {
+			break
+		}
+		genStates[i] = dec.ReadUint64()
+	}
+	var iterState *utils.IteratorState
+	if dec.ReadUint32() != 0 {
+		iterState = &utils.IteratorState{
+			Indices: dec.ReadInts(),
+			Current: int(dec.ReadInt64()),
+		}
+	}
+	if err := dec.Err(); err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+
+	params := run.Model.GetParameters()
+	if len(params) != len(values) {
+		return fmt.Errorf("checkpoint: model has %d parameters but %d were saved", len(params), len(values))
+	}
+	for i, p := range params {
+		if !tensor.ShapesMatch(p.Value, values[i]) {
+			return fmt.Errorf("checkpoint: parameter %d has shape %v but %v was saved", i, p.Value.Shape(), values[i].Shape())
+		}
+	}
+	modelBuffers := buffersOf(run.Model)
+	if len(modelBuffers) != len(buffers) {
+		return fmt.Errorf("checkpoint: model has %d buffers but %d were saved", len(modelBuffers), len(buffers))
+	}
+	for i, b := range modelBuffers {
+		if !tensor.ShapesMatch(b, buffers[i]) || !b.IsContiguous() {
+			return fmt.Errorf("checkpoint: buffer %d has shape %v but %v was saved", i, b.Shape(), buffers[i].Shape())
+		}
+	}
+	if run.Optimizer != nil && !hasState {
+		return fmt.Errorf("checkpoint: no optimizer state was saved")
+	}
+	if run.Scheduler != nil && !hasSchedulerState {
+		return fmt.Errorf("checkpoint: no scheduler state was saved")
+	}
+	gens := run.generators()
+	if len(gens) != len(genStates) {
+		return fmt.Errorf("checkpoint: run has %d generators but %d were saved", len(gens), len(genStates))
+	}
+	var iterator *utils.BatchIterator
+	if iterState != nil {
+		if run.Loader == nil {
+			return fmt.Errorf("checkpoint: a data position was saved but the run has no loader")
+		}
+		iterator, err = run.Loader.ResumeIterator(*iterState)
+		if err != nil {
+			return fmt.Errorf("checkpoint: %w", err)
+		}
+	}
+	// the optimizer and the scheduler check their own state, so they go first.
+	// The scheduler sets the learning rate after the optimizer has loaded it,
+	// if it fails the optimizer gets its old state back
+	if run.Optimizer != nil {
+		previous := run.Optimizer.StateDict()
+		if err := run.Optimizer.LoadStateDict(state); err != nil {
+			return fmt.Errorf("checkpoint: %w", err)
+		}
+		if run.Scheduler != nil {
+			if err := run.Scheduler.LoadStateDict(schedulerState); err != nil {
+				run.Optimizer.LoadStateDict(previous)
+				return fmt.Errorf("checkpoint: %w", err)
+			}
+		}
+	} else if run.Scheduler != nil {
+		if err := run.Scheduler.LoadStateDict(schedulerState); err != nil {
+			return fmt.Errorf("checkpoint: %w", err)
+		}
+	}
+
+	for i, p := range params {
+		p.Value = values[i]
+		p.Grad, _ = tensor.NewTensor(values[i].Shape()...)
+	}
+	for i, b := range modelBuffers {
+		copy(b.Data(), buffers[i].Data())
+	}
+	for i, g := range gens {
+		g.SetState(genStates[i])
+	}
+	run.Epoch = epoch
+	run.Iterator = iterator
+	return nil
+}
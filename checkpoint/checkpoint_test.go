@@ -0,0 +1,203 @@
+package checkpoint
+
+import (
+	"bytes"
+	"nnscratch/layers"
+	"nnscratch/optim"
+	"nnscratch/random"
+	"nnscratch/tensor"
+	"nnscratch/utils"
+	"testing"
+)
+
+// Everything a training run is built from, built the same way every time
+type training struct {
+	model     *layers.Sequential
+	optimizer *optim.Adam
+	scheduler *optim.Scheduler
+	generator *random.Generator
+	loader    *utils.DataLoader
+}
+
+func newTraining(t *testing.T, x, y *tensor.Tensor) training {
+	t.Helper()
+	random.Seed(1)
+	bn, err := layers.NewBatchNorm1dLayer(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dropout, err := layers.NewDropoutLayer(0.2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generator := random.New(7)
+	dropout.Generator = generator
+	model := layers.NewSequential(layers.NewDenseLayer(2, 8), bn, dropout, &layers.TanhLayer{}, layers.NewDenseLayer(8, 1), &layers.SigmoidLayer{})
+	model.LossLayer = &layers.BCELossLayer{}
+	loader := utils.NewDataLoader(x, y, 2, true)
+	loader.SetGenerator(generator)
+	adam := optim.NewAdam(model.GetParameters(), 0.05)
+	scheduler := optim.NewScheduler(adam, optim.Exponential{Gamma: 0.5})
+	return training{model, adam, scheduler, generator, loader}
+}
+
+func (tr training) step(t *testing.T, it *utils.BatchIterator) {
+	t.Helper()
+	tr.optimizer.ZeroGrad()
+	xb, yb := it.Get()
+	pred, err := tr.model.Forward(xb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.model.LossLayer.Loss(pred, yb); err != nil {
+		t.Fatal(err)
+	}
+	diff, _ := tr.model.LossLayer.Diffrential()
+	if _, err := tr.model.Backward(diff, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.optimizer.Step(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (tr training) run(it *utils.BatchIterator) *Run {
+	return &Run{
+		Model:      tr.model,
+		Optimizer:  tr.optimizer,
+		Scheduler:  tr.scheduler,
+		Generators: []*random.Generator{random.Default(), tr.generator},
+		Loader:     tr.loader,
+		Iterator:   it,
+	}
+}
+
+func TestResumeIsExact(t *testing.T) {
+	const epochs = 6
+	x, _ := tensor.NewTensorRandomFrom(random.New(3), 10, 2)
+	y, _ := tensor.NewTensorRandomFrom(random.New(4), 10, 1)
+
+	// a run that is saved in the middle of an epoch and carries on
+	whole := newTraining(t, x, y)
+	var buf bytes.Buffer
+	for epoch := 0; epoch < epochs; epoch++ {
+		it := whole.loader.MakeIterator()
+		for batch := 0; it.Next(); batch++ {
+			whole.step(t, it)
+			if epoch == 3 && batch == 1 {
+				run := whole.run(it)
+				run.Epoch = epoch
+				if err := Save(&buf, run); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		whole.scheduler.Step()
+	}
+	want, err := whole.model.Forward(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// and a fresh one resumed from the checkpoint
+	resumed := newTraining(t, x, y)
+	run := resumed.run(nil)
+	if err := Load(bytes.NewReader(buf.Bytes()), run); err != nil {
+		t.Fatal(err)
+	}
+	if run.Epoch != 3 || run.Iterator == nil {
+		t.Fatalf("resumed at epoch %d with iterator %v, expected epoch 3 in the middle", run.Epoch, run.Iterator)
+	}
+	if got := resumed.optimizer.GetLR(); got != 0.05/8 {
+		t.Errorf("resumed with lr %v, expected %v", got, 0.05/8)
+	}
+	it := run.Iterator
+	for epoch := run.Epoch; epoch < epochs; epoch++ {
+		if it == nil {
+			it = resumed.loader.MakeIterator()
+		}
+		for it.Next() {
+			resumed.step(t, it)
+		}
+		it = nil
+		resumed.scheduler.Step()
+	}
+	got, err := resumed.model.Forward(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotValues := got.Values()
+	for i, v := range want.Values() {
+		if gotValues[i] != v {
+			t.Fatalf("output %d is %v after resuming, expected exactly %v", i, gotValues[i], v)
+		}
+	}
+}
+
+func TestSchedulerRoundTrip(t *testing.T) {
+	newRun := func() (*optim.SGD, *optim.Scheduler, *Run) {
+		model := layers.NewDenseLayer(2, 1)
+		sgd := optim.NewSGD(model.GetParameters(), 0.1, optim.WithMomentum(0.9))
+		scheduler := optim.NewScheduler(sgd, optim.StepLR{StepSize: 2, Gamma: 0.5})
+		return sgd, scheduler, &Run{Model: model, Optimizer: sgd, Scheduler: scheduler}
+	}
+	sgd, scheduler, run := newRun()
+	for i := 0; i < 3; i++ {
+		scheduler.Step()
+	}
+	var buf bytes.Buffer
+	if err := Save(&buf, run); err != nil {
+		t.Fatal(err)
+	}
+
+	loadedSGD, loaded, loadedRun := newRun()
+	if err := Load(bytes.NewReader(buf.Bytes()), loadedRun); err != nil {
+		t.Fatal(err)
+	}
+	// 0.1 halved once after 2 of the 3 steps
+	if loaded.StepCount != 3 || loadedSGD.GetLR() != 0.05 {
+		t.Fatalf("loaded scheduler at step %d with lr %v, expected 3 and 0.05", loaded.StepCount, loadedSGD.GetLR())
+	}
+	// both go on from the same place
+	scheduler.Step()
+	loaded.Step()
+	if loadedSGD.GetLR() != 0.025 || sgd.GetLR() != 0.025 {
+		t.Errorf("lr %v after resuming and %v without, expected 0.025", loadedSGD.GetLR(), sgd.GetLR())
+	}
+}
+
+func TestLoadNeedsSchedulerState(t *testing.T) {
+	model := layers.NewDenseLayer(2, 1)
+	sgd := optim.NewSGD(model.GetParameters(), 0.1)
+	var buf bytes.Buffer
+	if err := Save(&buf, &Run{Model: model, Optimizer: sgd}); err != nil {
+		t.Fatal(err)
+	}
+	target := optim.NewScheduler(sgd, optim.Exponential{Gamma: 0.5})
+	target.Step()
+	if err := Load(&buf, &Run{Model: model, Optimizer: sgd, Scheduler: target}); err == nil {
+		t.Fatal("loaded a checkpoint without scheduler state into a run with a scheduler")
+	}
+	if target.StepCount != 1 || sgd.GetLR() != 0.05 {
+		t.Errorf("failed load left the scheduler at step %d and lr %v, expected 1 and 0.05", target.StepCount, sgd.GetLR())
+	}
+}
+
+func TestFailedSchedulerLoadRestoresOptimizer(t *testing.T) {
+	model := layers.NewDenseLayer(2, 1)
+	saved := optim.NewSGD(model.GetParameters(), 0.1)
+	// the saved scheduler state is that of another optimizer, which the
+	// scheduler rejects after the optimizer state has been loaded
+	var buf bytes.Buffer
+	if err := Save(&buf, &Run{Model: model, Optimizer: saved, Scheduler: optim.NewSGD(nil, 1)}); err != nil {
+		t.Fatal(err)
+	}
+	sgd := optim.NewSGD(model.GetParameters(), 0.3)
+	scheduler := optim.NewScheduler(sgd, optim.Exponential{Gamma: 0.5})
+	if err := Load(&buf, &Run{Model: model, Optimizer: sgd, Scheduler: scheduler}); err == nil {
+		t.Fatal("loaded a scheduler state that does not fit")
+	}
+	if sgd.GetLR() != 0.3 {
+		t.Errorf("failed load left lr %v, expected the old 0.3", sgd.GetLR())
+	}
+}
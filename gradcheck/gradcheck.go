@@ -0,0 +1,192 @@
+package gradcheck
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"nnscratch/layers"
+	"nnscratch/tensor"
+	"strings"
+)
+
+// Options for the checks, Epsilon is the finite difference step. A value
+// passes when its relative error is at most Tolerance or its absolute error
+// is at most AbsTolerance, the latter covers gradients that are about zero
+type Options struct {
+	Epsilon      float64
+	Tolerance    float64
+	AbsTolerance float64
+	Seed         int64
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Epsilon:      1e-6,
+		Tolerance:    1e-5,
+		AbsTolerance: 1e-8,
+		Seed:         1,
+	}
+}
+
+// Result of comparing one analytic gradient with the numerical one
+type Result struct {
+	Name        string
+	MaxRelError float64
+	MaxAbsError float64
+	Passed      bool
+}
+
+type Report struct {
+	Results []Result
+}
+
+// Check if every tensor passed
+func (r *Report) Passed() bool {
+	for _, res := range r.Results {
+		if !res.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	for _, res := range r.Results {
+		status := "ok"
+		if !res.Passed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(&b, "%-12s rel %.3e abs %.3e %s\n", res.Name, res.MaxRelError, res.MaxAbsError, status)
+	}
+	return b.String()
+}
+
+// CheckLayer compares the gradients from l.Backward with central finite
+// differences for the input and every Parameter.Value. The layer output is
+// turned into a scalar by a fixed random projection sum(out * r) so that
+// every output element is checked
+func CheckLayer(l layers.Layer, input *tensor.Tensor, opts Options) (*Report, error) {
+	input = input.Copy()
+	out, err := l.Forward(input)
+	if err != nil {
+		return nil, err
+	}
+	rng := rand.New(rand.NewSource(opts.Seed))
+	proj, _ := tensor.NewTensor(out.Shape()...)
+	for i := range proj.Data() {
+		proj.Data()[i] = rng.NormFloat64()
+	}
+
+	gradInput, err := l.Backward(proj, 0)
+	if err != nil {
+		return nil, err
+	}
+	params := l.GetParameters()
+	analytic := []*tensor.Tensor{gradInput}
+	for _, p := range params {
+		if p.Grad == nil {
+			return nil, fmt.Errorf("gradcheck: a parameter has no gradient after backward")
+		}
+		analytic = append(analytic, p.Grad.Copy())
+	}
+
+	objective := func() (float64, error) {
+		out, err := l.Forward(input)
+		if err != nil {
+			return 0, err
+		}
+		prod, err := tensor.TensorMul(out, proj)
+		if err != nil {
+			return 0, err
+		}
+		return prod.Sum()
+	}
+
+	report := &Report{}
+	res, err := compare("input", input, analytic[0], objective, opts)
+	if err != nil {
+		return nil, err
+	}
+	report.Results = append(report.Results, res)
+	for i, p := range params {
+		res, err := compare(fmt.Sprintf("param[%d]", i), p.Value, analytic[i+1], objective, opts)
+		if err != nil {
+			return nil, err
+		}
+		report.Results = append(report.Results, res)
+	}
+	return report, nil
+}
+
+// CheckLoss compares l.Diffrential with central finite differences of
+// l.Loss(yPred, yActual) with respect to yPred
+func CheckLoss(l layers.LossLayer, yPred *tensor.Tensor, yActual *tensor.Tensor, opts Options) (*Report, error) {
+	yPred = yPred.Copy()
+	if _, err := l.Loss(yPred, yActual); err != nil {
+		return nil, err
+	}
+	analytic, err := l.Diffrential()
+	if err != nil {
+		return nil, err
+	}
+	analytic = analytic.Copy()
+	objective := func() (float64, error) {
+		return l.Loss(yPred, yActual)
+	}
+	res, err := compare("y_pred", yPred, analytic, objective, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Report{Results: []Result{res}}, nil
+}
+
+// Perturbs every value of x in place and compares the slope of objective with
+// analytic. A strided x is perturbed through a contiguous copy that is written
+// back into its storage after every change, so x stays the tensor the layer holds
+func compare(name string, x *tensor.Tensor, analytic *tensor.Tensor, objective func() (float64, error), opts Options) (Result, error) {
+	if !tensor.ShapesMatch(x, analytic) {
+		return Result{}, fmt.Errorf("gradcheck: %s gradient has shape %v but the tensor has shape %v", name, analytic.Shape(), x.Shape())
+	}
+	local := x.Contiguous()
+	values := local.Data()
+	set := func(i int, v float64) error {
+		values[i] = v
+		if local == x {
+			return nil
+		}
+		return x.SetTensor(local)
+	}
+	grads := analytic.Values()
+	res := Result{Name: name, Passed: true}
+	for i := range values {
+		orig := values[i]
+		if err := set(i, orig+opts.Epsilon); err != nil {
+			return Result{}, err
+		}
+		plus, err := objective()
+		if err != nil {
+			return Result{}, err
+		}
+		if err := set(i, orig-opts.Epsilon); err != nil {
+			return Result{}, err
+		}
+		minus, err := objective()
+		if err != nil {
+			return Result{}, err
+		}
+		if err := set(i, orig); err != nil {
+			return Result{}, err
+		}
+
+		numeric := (plus - minus) / (2 * opts.Epsilon)
+		abs := math.Abs(numeric - grads[i])
+		rel := abs / math.Max(math.Abs(numeric)+math.Abs(grads[i]), 1e-8)
+		res.MaxAbsError = math.Max(res.MaxAbsError, abs)
+		res.MaxRelError = math.Max(res.MaxRelError, rel)
+		if rel > opts.Tolerance && abs > opts.AbsTolerance {
+			res.Passed = false
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,80 @@
+package gradcheck
+
+import (
+	"nnscratch/layers"
+	"nnscratch/tensor"
+	"slices"
+	"testing"
+)
+
+func TestCheckLayer(t *testing.T) {
+	x, _ := tensor.NewTensorInput([][]float64{{0.1, -0.4, 0.7}, {1.2, 0.3, -0.5}})
+	tests := []struct {
+		name  string
+		layer layers.Layer
+	}{
+		{"dense", layers.NewDenseLayer(3, 2)},
+		{"sigmoid", &layers.SigmoidLayer{}},
+		{"sine", &layers.SineLayer{}},
+		{"cosine", &layers.CosineLayer{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := CheckLayer(tt.layer, x, DefaultOptions())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !report.Passed() {
+				t.Errorf("gradients differ\n%s", report)
+			}
+		})
+	}
+}
+
+func TestCheckLoss(t *testing.T) {
+	pred, _ := tensor.NewTensorInput([][]float64{{0.2, 0.7}, {0.9, 0.4}})
+	actual, _ := tensor.NewTensorInput([][]float64{{0, 1}, {1, 0}})
+	tests := []struct {
+		name string
+		loss layers.LossLayer
+	}{
+		{"mse", &layers.MSELossLayer{}},
+		{"bce", &layers.BCELossLayer{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := CheckLoss(tt.loss, pred, actual, DefaultOptions())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !report.Passed() {
+				t.Errorf("gradients differ\n%s", report)
+			}
+		})
+	}
+}
+
+// A parameter held as a strided view is perturbed where the layer reads it
+// and is left as the same tensor
+func TestCheckLayerStridedParameter(t *testing.T) {
+	dense := layers.NewDenseLayer(3, 2)
+	w, _ := tensor.NewTensorInput([][]float64{{0.5, -1}, {2, 0.25}, {-0.75, 1.5}})
+	view, _ := w.Transpose()
+	dense.Weights.Value = view
+	before := slices.Clone(view.Values())
+
+	x, _ := tensor.NewTensorInput([][]float64{{0.1, -0.4, 0.7}, {1.2, 0.3, -0.5}})
+	report, err := CheckLayer(dense, x, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Passed() {
+		t.Errorf("gradients differ\n%s", report)
+	}
+	if dense.Weights.Value != view {
+		t.Error("the weight was replaced")
+	}
+	if got := view.Values(); !slices.Equal(got, before) {
+		t.Errorf("the weight was left at %v, expected %v", got, before)
+	}
+}
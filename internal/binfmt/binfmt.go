@@ -0,0 +1,234 @@
+// Package binfmt holds the little endian encoding shared by the model and
+// checkpoint files. A file is a header of magic, version, payload length and
+// the CRC32 of the payload, followed by the payload.
+package binfmt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"nnscratch/tensor"
+)
+
+// Largest payload ReadFramed accepts, guards against corrupt lengths
+const maxPayload = 1 << 34
+
+// Writes payload framed by the header
+func WriteFramed(w io.Writer, magic string, version uint32, payload []byte) error {
+	header := make([]byte, 0, len(magic)+16)
+	header = append(header, magic...)
+	header = binary.LittleEndian.AppendUint32(header, version)
+	header = binary.LittleEndian.AppendUint64(header, uint64(len(payload)))
+	header = binary.LittleEndian.AppendUint32(header, crc32.ChecksumIEEE(payload))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// Reads a framed payload, checking the magic and the checksum
+func ReadFramed(r io.Reader, magic string) (uint32, []byte, error) {
+	header := make([]byte, len(magic)+16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, fmt.Errorf("binfmt: reading header: %w", err)
+	}
+	if string(header[:len(magic)]) != magic {
+		return 0, nil, fmt.Errorf("binfmt: bad magic %q, expected %q", header[:len(magic)], magic)
+	}
+	rest := header[len(magic):]
+	version := binary.LittleEndian.Uint32(rest)
+	length := binary.LittleEndian.Uint64(rest[4:])
+	sum := binary.LittleEndian.Uint32(rest[12:])
+	if length > maxPayload {
+		return 0, nil, fmt.Errorf("binfmt: payload length %d is too large", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, fmt.Errorf("binfmt: reading payload: %w", err)
+	}
+	if crc32.ChecksumIEEE(payload) != sum {
+		return 0, nil, fmt.Errorf("binfmt: checksum mismatch, the data is corrupt")
+	}
+	return version, payload, nil
+}
+
+// Writer builds a payload
+type Writer struct {
+	buf bytes.Buffer
+}
+
+func (w *Writer) Payload() []byte {
+	return w.buf.Bytes()
+}
+
+func (w *Writer) WriteUint32(v uint32) {
+	w.buf.Write(binary.LittleEndian.AppendUint32(nil, v))
+}
+
+func (w *Writer) WriteUint64(v uint64) {
+	w.buf.Write(binary.LittleEndian.AppendUint64(nil, v))
+}
+
+func (w *Writer) WriteInt64(v int64) {
+	w.WriteUint64(uint64(v))
+}
+
+func (w *Writer) WriteFloat64(v float64) {
+	w.WriteUint64(math.Float64bits(v))
+}
+
+func (w *Writer) WriteBytes(b []byte) {
+	w.WriteUint64(uint64(len(b)))
+	w.buf.Write(b)
+}
+
+func (w *Writer) WriteString(s string) {
+	w.WriteBytes([]byte(s))
+}
+
+func (w *Writer) WriteInts(v []int) {
+	w.WriteUint32(uint32(len(v)))
+	for _, x := range v {
+		w.WriteInt64(int64(x))
+	}
+}
+
+// Writes the shape and the values of t in row major order
+func (w *Writer) WriteTensor(t *tensor.Tensor) {
+	w.WriteInts(t.Shape())
+	for _, v := range t.Contiguous().Data() {
+		w.WriteFloat64(v)
+	}
+}
+
+// Reader walks a payload. The first error sticks, later reads give zero
+// values, so callers check Err once after a group of reads
+type Reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func NewReader(payload []byte) *Reader {
+	return &Reader{data: payload}
+}
+
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// Fails the reader with err unless it has already failed
+func (r *Reader) Fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *Reader) next(n uint64) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(len(r.data)-r.pos) {
+		r.err = fmt.Errorf("binfmt: unexpected end of data at byte %d", r.pos)
+		return nil
+	}
+	b := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b
+}
+
+func (r *Reader) ReadUint32() uint32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (r *Reader) ReadUint64() uint64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+func (r *Reader) ReadInt64() int64 {
+	return int64(r.ReadUint64())
+}
+
+func (r *Reader) ReadFloat64() float64 {
+	return math.Float64frombits(r.ReadUint64())
+}
+
+func (r *Reader) ReadBytes() []byte {
+	return r.next(r.ReadUint64())
+}
+
+func (r *Reader) ReadString() string {
+	return string(r.ReadBytes())
+}
+
+// Reads the length of a list whose items take at least minSize bytes each,
+// failing when that many could not fit in the rest of the data. This keeps a
+// corrupt length from making a huge allocation
+func (r *Reader) ReadCount(minSize uint64) int {
+	n := r.ReadUint32()
+	if r.err != nil {
+		return 0
+	}
+	if uint64(n)*minSize > uint64(len(r.data)-r.pos) {
+		r.Fail(fmt.Errorf("binfmt: list of %d items runs past the data", n))
+		return 0
+	}
+	return int(n)
+}
+
+func (r *Reader) ReadInts() []int {
+	n := r.ReadUint32()
+	if r.err != nil {
+		return nil
+	}
+	if uint64(n)*8 > uint64(len(r.data)-r.pos) {
+		r.Fail(fmt.Errorf("binfmt: list of %d ints runs past the data", n))
+		return nil
+	}
+	v := make([]int, n)
+	for i := range v {
+		v[i] = int(r.ReadInt64())
+	}
+	return v
+}
+
+func (r *Reader) ReadTensor() *tensor.Tensor {
+	shape := r.ReadInts()
+	if r.err != nil {
+		return nil
+	}
+	size := uint64(1)
+	for _, d := range shape {
+		if d <= 0 {
+			r.Fail(fmt.Errorf("binfmt: bad tensor shape %v", shape))
+			return nil
+		}
+		size *= uint64(d)
+		if size*8 > uint64(len(r.data)-r.pos) {
+			r.Fail(fmt.Errorf("binfmt: tensor of shape %v runs past the data", shape))
+			return nil
+		}
+	}
+	t, err := tensor.NewTensor(shape...)
+	if err != nil {
+		r.Fail(err)
+		return nil
+	}
+	data := t.Data()
+	for i := range data {
+		data[i] = r.ReadFloat64()
+	}
+	return t
+}
@@ -1,6 +1,7 @@
 package layers
 
 import (
+	"fmt"
 	"nnscratch/tensor"
 	"nnscratch/activations"
 	"nnscratch/maths"
@@ -103,3 +104,381 @@ func (s *CosineLayer) GetWeights() []*tensor.Tensor {
 func (s *CosineLayer) GetBiases() []*tensor.Tensor {
 	return nil 
 }
+
+// Gives gradOutput times the derivative of the activation at the input
+func activationBackward(name string, input *tensor.Tensor, gradOutput *tensor.Tensor, diff func(float64) float64) (*tensor.Tensor, error) {
+	if input == nil {
+		return nil, fmt.Errorf("%s: backward called before forward", name)
+	}
+	diffren, err := input.Apply(diff)
+	if err != nil {
+		return nil, err
+	}
+	return tensor.TensorMul(gradOutput, diffren)
+}
+
+// ReLU layer max(0, x)
+type ReLULayer struct {
+	input *tensor.Tensor
+}
+
+func (a *ReLULayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	a.input = input
+	return input.Apply(activations.ReLu)
+}
+
+func (a *ReLULayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	return activationBackward("relu", a.input, gradOutput, activations.DiffReLu)
+}
+
+func (a *ReLULayer) GetParameters() []*Parameter {
+	return []*Parameter{}
+}
+
+func (a *ReLULayer) GetWeights() []*tensor.Tensor {
+	return nil
+}
+
+func (a *ReLULayer) GetBiases() []*tensor.Tensor {
+	return nil
+}
+
+// Leaky ReLU layer, Slope is used for negative inputs
+type LeakyReLULayer struct {
+	Slope float64
+	input *tensor.Tensor
+}
+
+func NewLeakyReLULayer(slope float64) *LeakyReLULayer {
+	return &LeakyReLULayer{Slope: slope}
+}
+
+func (a *LeakyReLULayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	a.input = input
+	return input.Apply(func(x float64) float64 {
+		return activations.LeakyReLu(x, a.Slope)
+	})
+}
+
+func (a *LeakyReLULayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	return activationBackward("leakyRelu", a.input, gradOutput, func(x float64) float64 {
+		return activations.DiffLeakyReLu(x, a.Slope)
+	})
+}
+
+func (a *LeakyReLULayer) GetParameters() []*Parameter {
+	return []*Parameter{}
+}
+
+func (a *LeakyReLULayer) GetWeights() []*tensor.Tensor {
+	return nil
+}
+
+func (a *LeakyReLULayer) GetBiases() []*tensor.Tensor {
+	return nil
+}
+
+// Tanh layer
+type TanhLayer struct {
+	input *tensor.Tensor
+}
+
+func (a *TanhLayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	a.input = input
+	return input.Apply(activations.Tanh)
+}
+
+func (a *TanhLayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	return activationBackward("tanh", a.input, gradOutput, activations.DiffTanh)
+}
+
+func (a *TanhLayer) GetParameters() []*Parameter {
+	return []*Parameter{}
+}
+
+func (a *TanhLayer) GetWeights() []*tensor.Tensor {
+	return nil
+}
+
+func (a *TanhLayer) GetBiases() []*tensor.Tensor {
+	return nil
+}
+
+// GELU layer using the exact gaussian cdf
+type GELULayer struct {
+	input *tensor.Tensor
+}
+
+func (a *GELULayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	a.input = input
+	return input.Apply(activations.GELU)
+}
+
+func (a *GELULayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	return activationBackward("gelu", a.input, gradOutput, activations.DiffGELU)
+}
+
+func (a *GELULayer) GetParameters() []*Parameter {
+	return []*Parameter{}
+}
+
+func (a *GELULayer) GetWeights() []*tensor.Tensor {
+	return nil
+}
+
+func (a *GELULayer) GetBiases() []*tensor.Tensor {
+	return nil
+}
+
+// ELU layer, Alpha is the value negative inputs level off at
+type ELULayer struct {
+	Alpha float64
+	input *tensor.Tensor
+}
+
+func NewELULayer(alpha float64) *ELULayer {
+	return &ELULayer{Alpha: alpha}
+}
+
+func (a *ELULayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	a.input = input
+	return input.Apply(func(x float64) float64 {
+		return activations.ELU(x, a.Alpha)
+	})
+}
+
+func (a *ELULayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	return activationBackward("elu", a.input, gradOutput, func(x float64) float64 {
+		return activations.DiffELU(x, a.Alpha)
+	})
+}
+
+func (a *ELULayer) GetParameters() []*Parameter {
+	return []*Parameter{}
+}
+
+func (a *ELULayer) GetWeights() []*tensor.Tensor {
+	return nil
+}
+
+func (a *ELULayer) GetBiases() []*tensor.Tensor {
+	return nil
+}
+
+// SELU layer with the fixed self normalizing constants
+type SELULayer struct {
+	input *tensor.Tensor
+}
+
+func (a *SELULayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	a.input = input
+	return input.Apply(activations.SELU)
+}
+
+func (a *SELULayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	return activationBackward("selu", a.input, gradOutput, activations.DiffSELU)
+}
+
+func (a *SELULayer) GetParameters() []*Parameter {
+	return []*Parameter{}
+}
+
+func (a *SELULayer) GetWeights() []*tensor.Tensor {
+	return nil
+}
+
+func (a *SELULayer) GetBiases() []*tensor.Tensor {
+	return nil
+}
+
+// Swish (SiLU) layer x * sigmoid(x)
+type SwishLayer struct {
+	input *tensor.Tensor
+}
+
+func (a *SwishLayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	a.input = input
+	return input.Apply(activations.Swish)
+}
+
+func (a *SwishLayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	return activationBackward("swish", a.input, gradOutput, activations.DiffSwish)
+}
+
+func (a *SwishLayer) GetParameters() []*Parameter {
+	return []*Parameter{}
+}
+
+func (a *SwishLayer) GetWeights() []*tensor.Tensor {
+	return nil
+}
+
+func (a *SwishLayer) GetBiases() []*tensor.Tensor {
+	return nil
+}
+
+// Softplus layer log(1 + e^x)
+type SoftplusLayer struct {
+	input *tensor.Tensor
+}
+
+func (a *SoftplusLayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	a.input = input
+	return input.Apply(activations.Softplus)
+}
+
+func (a *SoftplusLayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	return activationBackward("softplus", a.input, gradOutput, activations.DiffSoftplus)
+}
+
+func (a *SoftplusLayer) GetParameters() []*Parameter {
+	return []*Parameter{}
+}
+
+func (a *SoftplusLayer) GetWeights() []*tensor.Tensor {
+	return nil
+}
+
+func (a *SoftplusLayer) GetBiases() []*tensor.Tensor {
+	return nil
+}
+
+// Mish layer x * tanh(softplus(x))
+type MishLayer struct {
+	input *tensor.Tensor
+}
+
+func (a *MishLayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	a.input = input
+	return input.Apply(activations.Mish)
+}
+
+func (a *MishLayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	return activationBackward("mish", a.input, gradOutput, activations.DiffMish)
+}
+
+func (a *MishLayer) GetParameters() []*Parameter {
+	return []*Parameter{}
+}
+
+func (a *MishLayer) GetWeights() []*tensor.Tensor {
+	return nil
+}
+
+func (a *MishLayer) GetBiases() []*tensor.Tensor {
+	return nil
+}
+
+// PReLU layer, a leaky relu whose negative slope is learnt. There is either
+// one slope for everything or one per channel (axis 1 of the input)
+type PReLULayer struct {
+	Slope *Parameter // (numParameters)
+	input *tensor.Tensor
+}
+
+func NewPReLULayer(numParameters int, init float64) (*PReLULayer, error) {
+	a, err := tensor.NewTensor(numParameters)
+	if err != nil {
+		return nil, fmt.Errorf("prelu: %w", err)
+	}
+	for i := range a.Data() {
+		a.Data()[i] = init
+	}
+	a_grad, _ := tensor.NewTensor(numParameters)
+	return &PReLULayer{
+		Slope: &Parameter{Value: a, Grad: a_grad},
+	}, nil
+}
+
+// Gives the slope shaped to broadcast over the input
+func (p *PReLULayer) slope(input *tensor.Tensor) (*tensor.Tensor, error) {
+	n := p.Slope.Value.Len()
+	if n == 1 {
+		return p.Slope.Value, nil
+	}
+	shape := input.Shape()
+	if len(shape) < 2 || shape[1] != n {
+		return nil, fmt.Errorf("prelu: %d slopes need input (batch, %d, ...) got %v", n, n, shape)
+	}
+	bshape := make([]int, len(shape))
+	for i := range bshape {
+		bshape[i] = 1
+	}
+	bshape[1] = n
+	return p.Slope.Value.Reshape(bshape...)
+}
+
+// Gives 1 where the input is negative and 0 elsewhere
+func negativeMask(input *tensor.Tensor) (*tensor.Tensor, error) {
+	return input.Apply(func(x float64) float64 {
+		if x < 0 {
+			return 1
+		}
+		return 0
+	})
+}
+
+// y = x - (1 - a) * x * neg
+func (p *PReLULayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	slope, err := p.slope(input)
+	if err != nil {
+		return nil, err
+	}
+	p.input = input
+	neg, _ := negativeMask(input)
+	negx, err := tensor.TensorMul(input, neg)
+	if err != nil {
+		return nil, err
+	}
+	oneMinus, _ := slope.MulScalar(-1)
+	oneMinus, _ = oneMinus.AddScalar(1)
+	shrink, err := tensor.TensorMul(negx, oneMinus)
+	if err != nil {
+		return nil, err
+	}
+	return tensor.TensorDiff(input, shrink)
+}
+
+func (p *PReLULayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	if p.input == nil {
+		return nil, fmt.Errorf("prelu: backward called before forward")
+	}
+	slope, err := p.slope(p.input)
+	if err != nil {
+		return nil, err
+	}
+	neg, _ := negativeMask(p.input)
+
+	// da = sum of g * x where x is negative, over everything but the channel
+	negx, _ := tensor.TensorMul(p.input, neg)
+	da, err := tensor.TensorMul(gradOutput, negx)
+	if err != nil {
+		return nil, err
+	}
+	da, err = da.SumTo(slope.Shape()...)
+	if err != nil {
+		return nil, err
+	}
+	p.Slope.Grad, err = da.Reshape(p.Slope.Value.Shape()...)
+	if err != nil {
+		return nil, err
+	}
+
+	// dx = g * (1 - neg + neg * a)
+	aMinus, _ := slope.AddScalar(-1)
+	diffren, _ := tensor.TensorMul(neg, aMinus)
+	diffren, _ = diffren.AddScalar(1)
+	return tensor.TensorMul(gradOutput, diffren)
+}
+
+func (p *PReLULayer) GetParameters() []*Parameter {
+	return []*Parameter{p.Slope}
+}
+
+func (p *PReLULayer) GetWeights() []*tensor.Tensor {
+	return []*tensor.Tensor{p.Slope.Value}
+}
+
+func (p *PReLULayer) GetBiases() []*tensor.Tensor {
+	return nil
+}
@@ -0,0 +1,75 @@
+package layers_test
+
+import (
+	"math"
+	"nnscratch/gradcheck"
+	"nnscratch/layers"
+	"testing"
+)
+
+func newPReLU(t *testing.T, numParameters int, init float64) *layers.PReLULayer {
+	t.Helper()
+	p, err := layers.NewPReLULayer(numParameters, init)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestActivationGradients(t *testing.T) {
+	x, _ := randomInput(t, 3, 4, 2).MulScalar(1.5)
+	tests := []struct {
+		name  string
+		layer layers.Layer
+	}{
+		{"relu", &layers.ReLULayer{}},
+		{"leaky relu", layers.NewLeakyReLULayer(0.1)},
+		{"tanh", &layers.TanhLayer{}},
+		{"gelu", &layers.GELULayer{}},
+		{"elu", layers.NewELULayer(0.7)},
+		{"selu", &layers.SELULayer{}},
+		{"swish", &layers.SwishLayer{}},
+		{"softplus", &layers.SoftplusLayer{}},
+		{"mish", &layers.MishLayer{}},
+		{"prelu shared", newPReLU(t, 1, 0.25)},
+		{"prelu per channel", newPReLU(t, 4, 0.3)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkLayer(t, tt.layer, x, gradcheck.DefaultOptions())
+		})
+	}
+}
+
+func TestActivationForward(t *testing.T) {
+	perChannel := newPReLU(t, 2, 0)
+	perChannel.Slope.Value = tensorOf(t, []float64{0.1, 0.5}, 2)
+	tests := []struct {
+		name  string
+		layer layers.Layer
+		want  []float64
+	}{
+		{"relu", &layers.ReLULayer{}, []float64{0, 1, 3, 0}},
+		{"leaky relu", layers.NewLeakyReLULayer(0.1), []float64{-0.2, 1, 3, -0.4}},
+		{"elu", layers.NewELULayer(0.7), []float64{0.7 * (math.Exp(-2) - 1), 1, 3, 0.7 * (math.Exp(-4) - 1)}},
+		{"softplus", &layers.SoftplusLayer{}, []float64{math.Log1p(math.Exp(-2)), math.Log1p(math.E), math.Log1p(math.Exp(3)), math.Log1p(math.Exp(-4))}},
+		{"prelu shared", newPReLU(t, 1, 0.25), []float64{-0.5, 1, 3, -1}},
+		// column 0 has slope 0.1 and column 1 slope 0.5
+		{"prelu per channel", perChannel, []float64{-0.2, 1, 3, -2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := tt.layer.Forward(tensorOf(t, []float64{-2, 1, 3, -4}, 2, 2))
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectValues(t, out, []int{2, 2}, tt.want)
+		})
+	}
+}
+
+func TestPReLUNeedsParameters(t *testing.T) {
+	if _, err := layers.NewPReLULayer(0, 0.25); err == nil {
+		t.Error("no slopes gave no error")
+	}
+}
@@ -0,0 +1,245 @@
+package layers
+
+import (
+	"fmt"
+	"math"
+	"nnscratch/tensor"
+)
+
+// Score given to masked positions before the softmax. It is finite so a row
+// with every key masked gives a uniform distribution rather than NaN
+const attentionMask = -1e9
+
+// Multi-head scaled dot-product self-attention over (batch, seq, embed)
+// inputs. Every head attends with softmax(q k^T / sqrt(headDim)) v and the
+// heads are joined by the output projection
+type MultiHeadAttention struct {
+	EmbedDim  int
+	NumHeads  int
+	Causal    bool // a position only attends to itself and earlier ones
+	Query     *DenseLayer
+	Key       *DenseLayer
+	Value     *DenseLayer
+	Output    *DenseLayer
+	padding   *tensor.Tensor // (batch, seq), nonzero keys are ignored
+	q, k, v   *tensor.Tensor // (batch, heads, seq, headDim)
+	attention *tensor.Tensor // (batch, heads, seq, seq)
+}
+
+func NewMultiHeadAttention(embedDim, numHeads int, causal bool) (*MultiHeadAttention, error) {
+	if embedDim <= 0 || numHeads <= 0 || embedDim%numHeads != 0 {
+		return nil, fmt.Errorf("attention: embed dim %d must be positive and divisible by %d heads", embedDim, numHeads)
+	}
+	return &MultiHeadAttention{
+		EmbedDim: embedDim,
+		NumHeads: numHeads,
+		Causal:   causal,
+		Query:    NewDenseLayer(embedDim, embedDim),
+		Key:      NewDenseLayer(embedDim, embedDim),
+		Value:    NewDenseLayer(embedDim, embedDim),
+		Output:   NewDenseLayer(embedDim, embedDim),
+	}, nil
+}
+
+// Sets the keys to ignore for the following forwards, mask is (batch, seq)
+// with nonzero values at padded positions. nil clears it
+func (m *MultiHeadAttention) SetKeyPaddingMask(mask *tensor.Tensor) {
+	m.padding = mask
+}
+
+func (m *MultiHeadAttention) headDim() int {
+	return m.EmbedDim / m.NumHeads
+}
+
+// (batch, seq, embed) -> (batch, heads, seq, headDim)
+func (m *MultiHeadAttention) splitHeads(t *tensor.Tensor) (*tensor.Tensor, error) {
+	shape := t.Shape()
+	t, err := t.Reshape(shape[0], shape[1], m.NumHeads, m.headDim())
+	if err != nil {
+		return nil, err
+	}
+	return t.Permute(0, 2, 1, 3)
+}
+
+// (batch, heads, seq, headDim) -> (batch, seq, embed)
+func (m *MultiHeadAttention) mergeHeads(t *tensor.Tensor) (*tensor.Tensor, error) {
+	shape := t.Shape()
+	t, err := t.Permute(0, 2, 1, 3)
+	if err != nil {
+		return nil, err
+	}
+	return t.Reshape(shape[0], shape[2], m.EmbedDim)
+}
+
+// Gives the additive mask (batch or 1, 1, seq, seq) of the causal and
+// padding masks, nil when there is neither
+func (m *MultiHeadAttention) mask(batch, seq int) (*tensor.Tensor, error) {
+	if !m.Causal && m.padding == nil {
+		return nil, nil
+	}
+	rows := 1
+	var pad []float64
+	if m.padding != nil {
+		if !listEqual(m.padding.Shape(), []int{batch, seq}) {
+			return nil, fmt.Errorf("attention: padding mask %v does not match input (%d, %d)", m.padding.Shape(), batch, seq)
+		}
+		rows = batch
+		pad = m.padding.Contiguous().Data()
+	}
+	mask, err := tensor.NewTensor(rows, 1, seq, seq)
+	if err != nil {
+		return nil, err
+	}
+	md := mask.Data()
+	for b := 0; b < rows; b++ {
+		for i := 0; i < seq; i++ {
+			for j := 0; j < seq; j++ {
+				if (m.Causal && j > i) || (pad != nil && pad[b*seq+j] != 0) {
+					md[(b*seq+i)*seq+j] = attentionMask
+				}
+			}
+		}
+	}
+	return mask, nil
+}
+
+func (m *MultiHeadAttention) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	shape := input.Shape()
+	if len(shape) != 3 || shape[2] != m.EmbedDim {
+		return nil, fmt.Errorf("attention: expected input (batch, seq, %d) got %v", m.EmbedDim, shape)
+	}
+	var err error
+	projections := []*DenseLayer{m.Query, m.Key, m.Value}
+	heads := make([]*tensor.Tensor, 3)
+	for i, proj := range projections {
+		out, err := proj.Forward(input)
+		if err != nil {
+			return nil, err
+		}
+		heads[i], err = m.splitHeads(out)
+		if err != nil {
+			return nil, err
+		}
+	}
+	m.q, m.k, m.v = heads[0], heads[1], heads[2]
+
+	kT, _ := m.k.TransposeAxes(2, 3)
+	scores, err := tensor.Matmul(m.q, kT)
+	if err != nil {
+		return nil, err
+	}
+	scores, _ = scores.MulScalar(1 / math.Sqrt(float64(m.headDim())))
+	mask, err := m.mask(shape[0], shape[1])
+	if err != nil {
+		return nil, err
+	}
+	if mask != nil {
+		scores, err = tensor.TensorAdd(scores, mask)
+		if err != nil {
+			return nil, err
+		}
+	}
+	m.attention, err = softmax(scores, -1)
+	if err != nil {
+		return nil, err
+	}
+	context, err := tensor.Matmul(m.attention, m.v)
+	if err != nil {
+		return nil, err
+	}
+	context, err = m.mergeHeads(context)
+	if err != nil {
+		return nil, err
+	}
+	return m.Output.Forward(context)
+}
+
+func (m *MultiHeadAttention) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	if m.attention == nil {
+		return nil, fmt.Errorf("attention: backward called before forward")
+	}
+	dContext, err := m.Output.Backward(gradOutput, lr)
+	if err != nil {
+		return nil, err
+	}
+	dContext, err = m.splitHeads(dContext)
+	if err != nil {
+		return nil, err
+	}
+
+	// context = attention v
+	vT, _ := m.v.TransposeAxes(2, 3)
+	dAttention, err := tensor.Matmul(dContext, vT)
+	if err != nil {
+		return nil, err
+	}
+	attentionT, _ := m.attention.TransposeAxes(2, 3)
+	dv, err := tensor.Matmul(attentionT, dContext)
+	if err != nil {
+		return nil, err
+	}
+
+	// softmax, dscores = a * (da - sum(da * a)), then the 1 / sqrt(headDim) scale
+	weighted, _ := tensor.TensorMul(dAttention, m.attention)
+	dot, _ := weighted.SumAxis(true, -1)
+	centered, _ := tensor.TensorDiff(dAttention, dot)
+	dScores, _ := tensor.TensorMul(m.attention, centered)
+	dScores, _ = dScores.MulScalar(1 / math.Sqrt(float64(m.headDim())))
+
+	// scores = q k^T
+	dq, err := tensor.Matmul(dScores, m.k)
+	if err != nil {
+		return nil, err
+	}
+	dScoresT, _ := dScores.TransposeAxes(2, 3)
+	dk, err := tensor.Matmul(dScoresT, m.q)
+	if err != nil {
+		return nil, err
+	}
+
+	var gradInput *tensor.Tensor
+	projections := []*DenseLayer{m.Query, m.Key, m.Value}
+	for i, grad := range []*tensor.Tensor{dq, dk, dv} {
+		grad, err = m.mergeHeads(grad)
+		if err != nil {
+			return nil, err
+		}
+		dx, err := projections[i].Backward(grad, lr)
+		if err != nil {
+			return nil, err
+		}
+		if gradInput == nil {
+			gradInput = dx
+			continue
+		}
+		gradInput, err = tensor.TensorAdd(gradInput, dx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return gradInput, nil
+}
+
+func (m *MultiHeadAttention) GetParameters() []*Parameter {
+	var params []*Parameter
+	for _, proj := range []*DenseLayer{m.Query, m.Key, m.Value, m.Output} {
+		params = append(params, proj.GetParameters()...)
+	}
+	return params
+}
+
+func (m *MultiHeadAttention) GetWeights() []*tensor.Tensor {
+	var weights []*tensor.Tensor
+	for _, proj := range []*DenseLayer{m.Query, m.Key, m.Value, m.Output} {
+		weights = append(weights, proj.GetWeights()...)
+	}
+	return weights
+}
+
+func (m *MultiHeadAttention) GetBiases() []*tensor.Tensor {
+	var biases []*tensor.Tensor
+	for _, proj := range []*DenseLayer{m.Query, m.Key, m.Value, m.Output} {
+		biases = append(biases, proj.GetBiases()...)
+	}
+	return biases
+}
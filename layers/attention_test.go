@@ -0,0 +1,118 @@
+package layers_test
+
+import (
+	"nnscratch/gradcheck"
+	"nnscratch/layers"
+	"nnscratch/tensor"
+	"testing"
+)
+
+func TestMultiHeadAttentionGradients(t *testing.T) {
+	padding, _ := tensor.NewTensorInput([][]float64{{0, 0, 0, 1}, {0, 0, 1, 1}})
+	tests := []struct {
+		name    string
+		heads   int
+		causal  bool
+		padding *tensor.Tensor
+	}{
+		{"two heads", 2, false, nil},
+		{"causal", 3, true, nil},
+		{"causal with padding", 2, true, padding},
+	}
+	x := randomInput(t, 2, 4, 6)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := layers.NewMultiHeadAttention(6, tt.heads, tt.causal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m.SetKeyPaddingMask(tt.padding)
+			scaleParameters(t, m, 50)
+			checkLayer(t, m, x, gradcheck.DefaultOptions())
+		})
+	}
+}
+
+// Changes the input at one position of the first sequence and reports which
+// output positions of that sequence moved
+func changedPositions(t *testing.T, l layers.Layer, x *tensor.Tensor, pos int) []bool {
+	t.Helper()
+	before, err := l.Forward(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before = before.Copy()
+	nudged := x.Copy()
+	for d := 0; d < x.Shape()[2]; d++ {
+		v, _ := nudged.Get(0, pos, d)
+		nudged.Set(v+1, 0, pos, d)
+	}
+	after, err := l.Forward(nudged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := make([]bool, x.Shape()[1])
+	for i := range changed {
+		for d := 0; d < before.Shape()[2]; d++ {
+			a, _ := before.Get(0, i, d)
+			b, _ := after.Get(0, i, d)
+			changed[i] = changed[i] || a != b
+		}
+	}
+	return changed
+}
+
+func TestMultiHeadAttentionMasks(t *testing.T) {
+	x := randomInput(t, 2, 4, 6)
+	causal, err := layers.NewMultiHeadAttention(6, 2, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the nudged position and the ones after it can see it
+	for i, changed := range changedPositions(t, causal, x, 2) {
+		if changed != (i >= 2) {
+			t.Errorf("causal attention output %d changed %v", i, changed)
+		}
+	}
+
+	padded, err := layers.NewMultiHeadAttention(6, 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	padding, _ := tensor.NewTensorInput([][]float64{{0, 0, 0, 1}, {0, 0, 0, 0}})
+	padded.SetKeyPaddingMask(padding)
+	// a padded key is never attended to, so only its own query moves
+	for i, changed := range changedPositions(t, padded, x, 3) {
+		if changed != (i == 3) {
+			t.Errorf("padded attention output %d changed %v", i, changed)
+		}
+	}
+}
+
+func TestMultiHeadAttentionForward(t *testing.T) {
+	x := tensorOf(t, []float64{1, 2, 3, 4}, 1, 2, 2)
+	for _, causal := range []bool{false, true} {
+		m, err := layers.NewMultiHeadAttention(2, 1, causal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// zero queries give every key the same score, the values and the
+		// output projection pass their input through
+		for _, dense := range []*layers.DenseLayer{m.Query, m.Key, m.Value, m.Output} {
+			scaleParameters(t, dense, 0)
+		}
+		for _, dense := range []*layers.DenseLayer{m.Value, m.Output} {
+			copy(dense.Weights.Value.Data(), []float64{1, 0, 0, 1})
+		}
+		out, err := m.Forward(x)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// every position averages the values it can see
+		want := []float64{2, 3, 2, 3}
+		if causal {
+			want = []float64{1, 2, 2, 3}
+		}
+		expectValues(t, out, []int{1, 2, 2}, want)
+	}
+}
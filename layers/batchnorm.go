@@ -0,0 +1,247 @@
+package layers
+
+import (
+	"fmt"
+	"math"
+	"nnscratch/tensor"
+)
+
+// Shared batch normalization over inputs laid out as (batch, channels, ...).
+// Every channel is normalized over the batch and all trailing positions.
+type batchNorm struct {
+	Gamma       *Parameter     // (channels), starts at 1
+	Beta        *Parameter     // (channels), starts at 0
+	RunningMean *tensor.Tensor // (channels)
+	RunningVar  *tensor.Tensor // (channels), unbiased estimate
+	Momentum    float64        // weight of the newest batch in the running statistics
+	Eps         float64
+	training    bool
+	name        string
+
+	// cache of the last forward
+	shape    []int
+	xhat     []float64
+	invstd   []float64
+	batchFit bool // statistics came from the batch
+}
+
+func newBatchNorm(name string, numFeatures int) (batchNorm, error) {
+	gamma, beta, err := affineParameters(numFeatures)
+	if err != nil {
+		return batchNorm{}, fmt.Errorf("%s: %w", name, err)
+	}
+	mean, _ := tensor.NewTensor(numFeatures)
+	variance, _ := tensor.NewTensor(numFeatures)
+	for i := range variance.Data() {
+		variance.Data()[i] = 1
+	}
+	return batchNorm{
+		Gamma:       gamma,
+		Beta:        beta,
+		RunningMean: mean,
+		RunningVar:  variance,
+		Momentum:    0.1,
+		Eps:         1e-5,
+		training:    true,
+		name:        name,
+	}, nil
+}
+
+func (b *batchNorm) SetTraining(training bool) {
+	b.training = training
+}
+
+// Whether the layer is in training mode
+func (b *batchNorm) Training() bool {
+	return b.training
+}
+
+func (b *batchNorm) channels() int {
+	return b.Gamma.Value.Len()
+}
+
+// Normalizes x seen as (n, channels, spatial). In training mode the batch
+// statistics are used and folded into the running ones
+func (b *batchNorm) forward(input *tensor.Tensor, n, spatial int) (*tensor.Tensor, error) {
+	c := b.channels()
+	count := n * spatial
+	if b.training && count < 2 {
+		return nil, fmt.Errorf("%s: need more than one value per channel in training got input %v", b.name, input.Shape())
+	}
+	x := input.Contiguous().Data()
+	out, err := tensor.NewTensor(input.Shape()...)
+	if err != nil {
+		return nil, err
+	}
+	od := out.Data()
+	gamma := b.Gamma.Value.Contiguous().Data()
+	beta := b.Beta.Value.Contiguous().Data()
+	rm := b.RunningMean.Data()
+	rv := b.RunningVar.Data()
+
+	b.shape = input.Shape()
+	b.xhat = make([]float64, len(x))
+	b.invstd = make([]float64, c)
+	b.batchFit = b.training
+	for ch := 0; ch < c; ch++ {
+		var mean, variance float64
+		if b.training {
+			for i := 0; i < n; i++ {
+				for _, v := range x[(i*c+ch)*spatial : (i*c+ch+1)*spatial] {
+					mean += v
+				}
+			}
+			mean /= float64(count)
+			for i := 0; i < n; i++ {
+				for _, v := range x[(i*c+ch)*spatial : (i*c+ch+1)*spatial] {
+					variance += (v - mean) * (v - mean)
+				}
+			}
+			variance /= float64(count)
+			rm[ch] = (1-b.Momentum)*rm[ch] + b.Momentum*mean
+			rv[ch] = (1-b.Momentum)*rv[ch] + b.Momentum*variance*float64(count)/float64(count-1)
+		} else {
+			mean, variance = rm[ch], rv[ch]
+		}
+		invstd := 1 / math.Sqrt(variance+b.Eps)
+		b.invstd[ch] = invstd
+		for i := 0; i < n; i++ {
+			start := (i*c + ch) * spatial
+			for j := start; j < start+spatial; j++ {
+				b.xhat[j] = (x[j] - mean) * invstd
+				od[j] = gamma[ch]*b.xhat[j] + beta[ch]
+			}
+		}
+	}
+	return out, nil
+}
+
+// dx = invstd / m * (m * dxhat - sum(dxhat) - xhat * sum(dxhat * xhat)) when the
+// batch statistics were used, otherwise the statistics are constants and
+// dx = dxhat * invstd
+func (b *batchNorm) backward(gradOutput *tensor.Tensor) (*tensor.Tensor, error) {
+	if b.xhat == nil {
+		return nil, fmt.Errorf("%s: backward called before forward", b.name)
+	}
+	if !listEqual(gradOutput.Shape(), b.shape) {
+		return nil, fmt.Errorf("%s: gradient shape %v does not match output %v", b.name, gradOutput.Shape(), b.shape)
+	}
+	c := b.channels()
+	n := b.shape[0]
+	spatial := len(b.xhat) / (n * c)
+	count := float64(n * spatial)
+	g := gradOutput.Contiguous().Data()
+	gamma := b.Gamma.Value.Contiguous().Data()
+
+	dx := make([]float64, len(g))
+	dgamma := make([]float64, c)
+	dbeta := make([]float64, c)
+	for ch := 0; ch < c; ch++ {
+		for i := 0; i < n; i++ {
+			start := (i*c + ch) * spatial
+			for j := start; j < start+spatial; j++ {
+				dgamma[ch] += g[j] * b.xhat[j]
+				dbeta[ch] += g[j]
+			}
+		}
+		// sum(dxhat) and sum(dxhat * xhat) are gamma times the parameter grads
+		sumDxhat := gamma[ch] * dbeta[ch]
+		sumDxhatXhat := gamma[ch] * dgamma[ch]
+		invstd := b.invstd[ch]
+		for i := 0; i < n; i++ {
+			start := (i*c + ch) * spatial
+			for j := start; j < start+spatial; j++ {
+				dxhat := g[j] * gamma[ch]
+				if b.batchFit {
+					dx[j] = invstd / count * (count*dxhat - sumDxhat - b.xhat[j]*sumDxhatXhat)
+				} else {
+					dx[j] = dxhat * invstd
+				}
+			}
+		}
+	}
+
+	var err error
+	b.Gamma.Grad, err = tensorFrom(dgamma, c)
+	if err != nil {
+		return nil, err
+	}
+	b.Beta.Grad, err = tensorFrom(dbeta, c)
+	if err != nil {
+		return nil, err
+	}
+	return tensorFrom(dx, b.shape...)
+}
+
+func (b *batchNorm) GetParameters() []*Parameter {
+	return []*Parameter{b.Gamma, b.Beta}
+}
+
+func (b *batchNorm) GetWeights() []*tensor.Tensor {
+	return []*tensor.Tensor{b.Gamma.Value}
+}
+
+func (b *batchNorm) GetBiases() []*tensor.Tensor {
+	return []*tensor.Tensor{b.Beta.Value}
+}
+
+// The running statistics, saved along with the parameters
+func (b *batchNorm) GetBuffers() []*tensor.Tensor {
+	return []*tensor.Tensor{b.RunningMean, b.RunningVar}
+}
+
+// Batch normalization over (batch, features) or (batch, channels, length)
+type BatchNorm1dLayer struct {
+	batchNorm
+}
+
+func NewBatchNorm1dLayer(numFeatures int) (*BatchNorm1dLayer, error) {
+	b, err := newBatchNorm("batchnorm1d", numFeatures)
+	if err != nil {
+		return nil, err
+	}
+	return &BatchNorm1dLayer{b}, nil
+}
+
+func (b *BatchNorm1dLayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	shape := input.Shape()
+	c := b.channels()
+	if (len(shape) != 2 && len(shape) != 3) || shape[1] != c {
+		return nil, fmt.Errorf("batchnorm1d: expected input (batch, %d) or (batch, %d, length) got %v", c, c, shape)
+	}
+	spatial := 1
+	if len(shape) == 3 {
+		spatial = shape[2]
+	}
+	return b.forward(input, shape[0], spatial)
+}
+
+func (b *BatchNorm1dLayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	return b.backward(gradOutput)
+}
+
+// Batch normalization over NCHW tensors (batch, channels, height, width)
+type BatchNorm2dLayer struct {
+	batchNorm
+}
+
+func NewBatchNorm2dLayer(numFeatures int) (*BatchNorm2dLayer, error) {
+	b, err := newBatchNorm("batchnorm2d", numFeatures)
+	if err != nil {
+		return nil, err
+	}
+	return &BatchNorm2dLayer{b}, nil
+}
+
+func (b *BatchNorm2dLayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	shape := input.Shape()
+	c := b.channels()
+	if len(shape) != 4 || shape[1] != c {
+		return nil, fmt.Errorf("batchnorm2d: expected input (batch, %d, height, width) got %v", c, shape)
+	}
+	return b.forward(input, shape[0], shape[2]*shape[3])
+}
+
+func (b *BatchNorm2dLayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	return b.backward(gradOutput)
+}
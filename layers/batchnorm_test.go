@@ -0,0 +1,102 @@
+package layers_test
+
+import (
+	"math"
+	"nnscratch/gradcheck"
+	"nnscratch/layers"
+	"nnscratch/tensor"
+	"testing"
+)
+
+func newBatchNorm1d(t *testing.T, numFeatures int) *layers.BatchNorm1dLayer {
+	t.Helper()
+	bn, err := layers.NewBatchNorm1dLayer(numFeatures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bn
+}
+
+func TestBatchNormGradients(t *testing.T) {
+	scaled := newBatchNorm1d(t, 3)
+	scaled.Gamma.Value.Data()[1] = 2.5
+	bn2d, err := layers.NewBatchNorm2dLayer(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		layer layers.Layer
+		input *tensor.Tensor
+	}{
+		{"1d features", newBatchNorm1d(t, 3), randomInput(t, 6, 3)},
+		{"1d sequence", scaled, randomInput(t, 4, 3, 5)},
+		{"2d", bn2d, randomInput(t, 2, 3, 2, 3)},
+	}
+	// in training the input gradients of a channel cancel out to zero, so
+	// some are tiny and the finite differences only match them to about 1e-8
+	opts := gradcheck.DefaultOptions()
+	opts.AbsTolerance = 1e-7
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkLayer(t, tt.layer, tt.input, opts)
+			layers.SetTraining(tt.layer, false)
+			checkLayer(t, tt.layer, tt.input, gradcheck.DefaultOptions())
+		})
+	}
+}
+
+func TestBatchNormRunningStatistics(t *testing.T) {
+	x := randomInput(t, 6, 3)
+	bn := newBatchNorm1d(t, 3)
+	for i := 0; i < 200; i++ {
+		if _, err := bn.Forward(x); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the same batch over and over, so the running statistics end up at its
+	// mean and unbiased variance
+	mean, _ := x.Mean(false, 0)
+	variance, _ := x.Var(false, 0)
+	for ch := 0; ch < 3; ch++ {
+		unbiased := variance.Data()[ch] * 6 / 5
+		if math.Abs(bn.RunningMean.Data()[ch]-mean.Data()[ch]) > 1e-6 || math.Abs(bn.RunningVar.Data()[ch]-unbiased) > 1e-6 {
+			t.Errorf("channel %d running mean %v and variance %v, expected %v and %v", ch, bn.RunningMean.Data()[ch], bn.RunningVar.Data()[ch], mean.Data()[ch], unbiased)
+		}
+	}
+}
+
+func TestBatchNormForward(t *testing.T) {
+	x := tensorOf(t, []float64{3, 2.5, -1, 1}, 2, 2)
+	bn := newBatchNorm1d(t, 2)
+	bn.Eps = 0
+
+	// channel 0 holds 3 and -1, channel 1 holds 2.5 and 1, each normalized by
+	// its batch mean and biased variance
+	out, err := bn.Forward(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectValues(t, out, []int{2, 2}, []float64{1, 1, -1, -1})
+
+	// eval uses the running statistics, gamma * (x - mean) / sqrt(var) + beta
+	copy(bn.RunningMean.Data(), []float64{1, 2})
+	copy(bn.RunningVar.Data(), []float64{4, 0.25})
+	copy(bn.Gamma.Value.Data(), []float64{2, 1})
+	copy(bn.Beta.Value.Data(), []float64{0.5, -1})
+	bn.SetTraining(false)
+	out, err = bn.Forward(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectValues(t, out, []int{2, 2}, []float64{2.5, 0, -1.5, -3})
+}
+
+func TestBatchNormNeedsFeatures(t *testing.T) {
+	if _, err := layers.NewBatchNorm1dLayer(0); err == nil {
+		t.Error("batchnorm1d with no features gave no error")
+	}
+	if _, err := layers.NewBatchNorm2dLayer(-1); err == nil {
+		t.Error("batchnorm2d with -1 features gave no error")
+	}
+}
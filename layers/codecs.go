@@ -0,0 +1,315 @@
+package layers
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Save codecs of the built in layers
+
+// Codec of a layer whose exported fields are its whole config, the layer is
+// stored as JSON and rebuilt by decoding into a zero value
+func fieldsCodec[T any, P interface {
+	*T
+	Layer
+}]() LayerCodec {
+	return LayerCodec{
+		Config: func(l Layer) (any, []Layer, error) {
+			return l, nil, nil
+		},
+		Build: func(config []byte, children []Layer) (Layer, error) {
+			var l P = new(T)
+			if err := json.Unmarshal(config, l); err != nil {
+				return nil, err
+			}
+			return l, nil
+		},
+	}
+}
+
+// Codec of a layer described by a config struct C, build makes the layer from it
+func configCodec[C any](config func(l Layer) C, build func(c C) (Layer, error)) LayerCodec {
+	return LayerCodec{
+		Config: func(l Layer) (any, []Layer, error) {
+			return config(l), nil, nil
+		},
+		Build: func(raw []byte, children []Layer) (Layer, error) {
+			var c C
+			if err := json.Unmarshal(raw, &c); err != nil {
+				return nil, err
+			}
+			return build(c)
+		},
+	}
+}
+
+// Codec of a container whose config is C and whose layers are children
+func containerCodec[C any](config func(l Layer) (C, []Layer), build func(c C, children []Layer) (Layer, error)) LayerCodec {
+	return LayerCodec{
+		Config: func(l Layer) (any, []Layer, error) {
+			c, children := config(l)
+			return c, children, nil
+		},
+		Build: func(raw []byte, children []Layer) (Layer, error) {
+			var c C
+			if err := json.Unmarshal(raw, &c); err != nil {
+				return nil, err
+			}
+			return build(c, children)
+		},
+	}
+}
+
+type sizeConfig struct {
+	In, Out int
+}
+
+type dropoutConfig struct {
+	P float64
+}
+
+type batchNormConfig struct {
+	NumFeatures int
+	Momentum    float64
+	Eps         float64
+}
+
+type normConfig struct {
+	NormalizedShape []int
+	NumGroups       int
+	NumChannels     int
+	Affine          bool
+	Eps             float64
+}
+
+type embeddingConfig struct {
+	NumEmbeddings, Dim, PaddingIdx int
+	MaxNorm                        float64
+}
+
+type attentionConfig struct {
+	EmbedDim, NumHeads, FFDim int
+	Dropout                   float64
+	Causal                    bool
+}
+
+type positionalConfig struct {
+	MaxLen, Dim int
+}
+
+type residualConfig struct {
+	HasShortcut bool
+}
+
+type axisConfig struct {
+	Axis int
+}
+
+func init() {
+	RegisterLayer("dense", &DenseLayer{}, configCodec(
+		func(l Layer) sizeConfig {
+			shape := l.(*DenseLayer).Weights.Value.Shape()
+			return sizeConfig{In: shape[1], Out: shape[0]}
+		},
+		func(c sizeConfig) (Layer, error) {
+			return NewDenseLayer(c.In, c.Out), nil
+		}))
+
+	// activations and other layers without parameters
+	RegisterLayer("sigmoid", &SigmoidLayer{}, fieldsCodec[SigmoidLayer]())
+	RegisterLayer("sine", &SineLayer{}, fieldsCodec[SineLayer]())
+	RegisterLayer("cosine", &CosineLayer{}, fieldsCodec[CosineLayer]())
+	RegisterLayer("relu", &ReLULayer{}, fieldsCodec[ReLULayer]())
+	RegisterLayer("leakyRelu", &LeakyReLULayer{}, fieldsCodec[LeakyReLULayer]())
+	RegisterLayer("tanh", &TanhLayer{}, fieldsCodec[TanhLayer]())
+	RegisterLayer("gelu", &GELULayer{}, fieldsCodec[GELULayer]())
+	RegisterLayer("elu", &ELULayer{}, fieldsCodec[ELULayer]())
+	RegisterLayer("selu", &SELULayer{}, fieldsCodec[SELULayer]())
+	RegisterLayer("swish", &SwishLayer{}, fieldsCodec[SwishLayer]())
+	RegisterLayer("softplus", &SoftplusLayer{}, fieldsCodec[SoftplusLayer]())
+	RegisterLayer("mish", &MishLayer{}, fieldsCodec[MishLayer]())
+	RegisterLayer("softmax", &SoftmaxLayer{}, fieldsCodec[SoftmaxLayer]())
+	RegisterLayer("logSoftmax", &LogSoftmaxLayer{}, fieldsCodec[LogSoftmaxLayer]())
+	RegisterLayer("maxPool2d", &MaxPool2DLayer{}, fieldsCodec[MaxPool2DLayer]())
+	RegisterLayer("avgPool2d", &AvgPool2DLayer{}, fieldsCodec[AvgPool2DLayer]())
+	RegisterLayer("adaptiveAvgPool2d", &AdaptiveAvgPool2DLayer{}, fieldsCodec[AdaptiveAvgPool2DLayer]())
+	RegisterLayer("globalAvgPool2d", &GlobalAvgPool2DLayer{}, fieldsCodec[GlobalAvgPool2DLayer]())
+
+	RegisterLayer("prelu", &PReLULayer{}, configCodec(
+		func(l Layer) sizeConfig {
+			return sizeConfig{Out: l.(*PReLULayer).Slope.Value.Len()}
+		},
+		func(c sizeConfig) (Layer, error) { return NewPReLULayer(c.Out, 0) }))
+
+	RegisterLayer("conv2d", &Conv2DLayer{}, configCodec(
+		func(l Layer) Conv2DConfig { return l.(*Conv2DLayer).Config },
+		func(c Conv2DConfig) (Layer, error) { return NewConv2DLayer(c) }))
+	RegisterLayer("conv1d", &Conv1DLayer{}, configCodec(
+		func(l Layer) Conv1DConfig { return l.(*Conv1DLayer).Config },
+		func(c Conv1DConfig) (Layer, error) { return NewConv1DLayer(c) }))
+
+	RegisterLayer("dropout", &DropoutLayer{}, configCodec(
+		func(l Layer) dropoutConfig { return dropoutConfig{P: l.(*DropoutLayer).P} },
+		func(c dropoutConfig) (Layer, error) { return NewDropoutLayer(c.P) }))
+	RegisterLayer("dropout2d", &Dropout2D{}, configCodec(
+		func(l Layer) dropoutConfig { return dropoutConfig{P: l.(*Dropout2D).P} },
+		func(c dropoutConfig) (Layer, error) { return NewDropout2D(c.P) }))
+	RegisterLayer("alphaDropout", &AlphaDropout{}, configCodec(
+		func(l Layer) dropoutConfig { return dropoutConfig{P: l.(*AlphaDropout).P} },
+		func(c dropoutConfig) (Layer, error) { return NewAlphaDropout(c.P) }))
+
+	batchNormOf := func(b *batchNorm) batchNormConfig {
+		return batchNormConfig{NumFeatures: b.channels(), Momentum: b.Momentum, Eps: b.Eps}
+	}
+	RegisterLayer("batchNorm1d", &BatchNorm1dLayer{}, configCodec(
+		func(l Layer) batchNormConfig { return batchNormOf(&l.(*BatchNorm1dLayer).batchNorm) },
+		func(c batchNormConfig) (Layer, error) {
+			b, err := NewBatchNorm1dLayer(c.NumFeatures)
+			if err != nil {
+				return nil, err
+			}
+			b.Momentum, b.Eps = c.Momentum, c.Eps
+			return b, nil
+		}))
+	RegisterLayer("batchNorm2d", &BatchNorm2dLayer{}, configCodec(
+		func(l Layer) batchNormConfig { return batchNormOf(&l.(*BatchNorm2dLayer).batchNorm) },
+		func(c batchNormConfig) (Layer, error) {
+			b, err := NewBatchNorm2dLayer(c.NumFeatures)
+			if err != nil {
+				return nil, err
+			}
+			b.Momentum, b.Eps = c.Momentum, c.Eps
+			return b, nil
+		}))
+
+	RegisterLayer("layerNorm", &LayerNormLayer{}, configCodec(
+		func(l Layer) normConfig {
+			n := l.(*LayerNormLayer)
+			return normConfig{NormalizedShape: n.NormalizedShape, Affine: n.Gamma != nil, Eps: n.Eps}
+		},
+		func(c normConfig) (Layer, error) {
+			n, err := NewLayerNormLayer(c.Affine, c.NormalizedShape...)
+			if err != nil {
+				return nil, err
+			}
+			n.Eps = c.Eps
+			return n, nil
+		}))
+	RegisterLayer("groupNorm", &GroupNormLayer{}, configCodec(
+		func(l Layer) normConfig {
+			n := l.(*GroupNormLayer)
+			return normConfig{NumGroups: n.NumGroups, NumChannels: n.NumChannels, Affine: n.Gamma != nil, Eps: n.Eps}
+		},
+		func(c normConfig) (Layer, error) {
+			n, err := NewGroupNormLayer(c.NumGroups, c.NumChannels, c.Affine)
+			if err != nil {
+				return nil, err
+			}
+			n.Eps = c.Eps
+			return n, nil
+		}))
+	RegisterLayer("rmsNorm", &RMSNormLayer{}, configCodec(
+		func(l Layer) normConfig {
+			n := l.(*RMSNormLayer)
+			return normConfig{NormalizedShape: n.NormalizedShape, Affine: n.Gamma != nil, Eps: n.Eps}
+		},
+		func(c normConfig) (Layer, error) {
+			n, err := NewRMSNormLayer(c.Affine, c.NormalizedShape...)
+			if err != nil {
+				return nil, err
+			}
+			n.Eps = c.Eps
+			return n, nil
+		}))
+
+	RegisterLayer("embedding", &EmbeddingLayer{}, configCodec(
+		func(l Layer) embeddingConfig {
+			e := l.(*EmbeddingLayer)
+			num, dim := e.dims()
+			return embeddingConfig{NumEmbeddings: num, Dim: dim, PaddingIdx: e.PaddingIdx, MaxNorm: e.MaxNorm}
+		},
+		func(c embeddingConfig) (Layer, error) {
+			e, err := NewEmbeddingLayer(c.NumEmbeddings, c.Dim, c.PaddingIdx)
+			if err != nil {
+				return nil, err
+			}
+			e.MaxNorm = c.MaxNorm
+			return e, nil
+		}))
+
+	RegisterLayer("rnn", &RNNLayer{}, configCodec(
+		func(l Layer) RecurrentConfig { return l.(*RNNLayer).Config },
+		func(c RecurrentConfig) (Layer, error) { return NewRNNLayer(c) }))
+	RegisterLayer("lstm", &LSTMLayer{}, configCodec(
+		func(l Layer) RecurrentConfig { return l.(*LSTMLayer).Config },
+		func(c RecurrentConfig) (Layer, error) { return NewLSTMLayer(c) }))
+	RegisterLayer("gru", &GRULayer{}, configCodec(
+		func(l Layer) RecurrentConfig { return l.(*GRULayer).Config },
+		func(c RecurrentConfig) (Layer, error) { return NewGRULayer(c) }))
+
+	RegisterLayer("multiHeadAttention", &MultiHeadAttention{}, configCodec(
+		func(l Layer) attentionConfig {
+			m := l.(*MultiHeadAttention)
+			return attentionConfig{EmbedDim: m.EmbedDim, NumHeads: m.NumHeads, Causal: m.Causal}
+		},
+		func(c attentionConfig) (Layer, error) { return NewMultiHeadAttention(c.EmbedDim, c.NumHeads, c.Causal) }))
+	RegisterLayer("transformerEncoderBlock", &TransformerEncoderBlock{}, configCodec(
+		func(l Layer) attentionConfig {
+			t := l.(*TransformerEncoderBlock)
+			return attentionConfig{
+				EmbedDim: t.Attention.EmbedDim,
+				NumHeads: t.Attention.NumHeads,
+				FFDim:    t.FF1.Weights.Value.Shape()[0],
+				Dropout:  t.Dropout1.P,
+				Causal:   t.Attention.Causal,
+			}
+		},
+		func(c attentionConfig) (Layer, error) {
+			return NewTransformerEncoderBlock(c.EmbedDim, c.NumHeads, c.FFDim, c.Dropout, c.Causal)
+		}))
+	RegisterLayer("sinusoidalPositional", &SinusoidalPositionalEncoding{}, configCodec(
+		func(l Layer) positionalConfig {
+			p := l.(*SinusoidalPositionalEncoding)
+			return positionalConfig{MaxLen: p.MaxLen, Dim: p.Dim}
+		},
+		func(c positionalConfig) (Layer, error) { return NewSinusoidalPositionalEncoding(c.MaxLen, c.Dim) }))
+	RegisterLayer("learnedPositional", &LearnedPositionalEncoding{}, configCodec(
+		func(l Layer) positionalConfig {
+			shape := l.(*LearnedPositionalEncoding).Weight.Value.Shape()
+			return positionalConfig{MaxLen: shape[0], Dim: shape[1]}
+		},
+		func(c positionalConfig) (Layer, error) { return NewLearnedPositionalEncoding(c.MaxLen, c.Dim) }))
+
+	// containers
+	RegisterLayer("sequential", &Sequential{}, containerCodec(
+		func(l Layer) (struct{}, []Layer) { return struct{}{}, l.(*Sequential).Layers },
+		func(_ struct{}, children []Layer) (Layer, error) { return NewSequential(children...), nil }))
+	RegisterLayer("residual", &Residual{}, containerCodec(
+		func(l Layer) (residualConfig, []Layer) {
+			r := l.(*Residual)
+			return residualConfig{HasShortcut: r.Shortcut != nil}, r.branches()
+		},
+		func(c residualConfig, children []Layer) (Layer, error) {
+			want := 1
+			if c.HasShortcut {
+				want = 2
+			}
+			if len(children) != want {
+				return nil, fmt.Errorf("expected %d layers, a body and a shortcut when it has one, got %d", want, len(children))
+			}
+			r := NewResidual(children[0])
+			if c.HasShortcut {
+				r.Shortcut = children[1]
+			}
+			return r, nil
+		}))
+	RegisterLayer("parallel", &Parallel{}, containerCodec(
+		func(l Layer) (struct{}, []Layer) { return struct{}{}, l.(*Parallel).Branches },
+		func(_ struct{}, children []Layer) (Layer, error) { return NewParallel(children...), nil }))
+	RegisterLayer("concat", &Concat{}, containerCodec(
+		func(l Layer) (axisConfig, []Layer) {
+			c := l.(*Concat)
+			return axisConfig{Axis: c.Axis}, c.Branches
+		},
+		func(c axisConfig, children []Layer) (Layer, error) { return NewConcat(c.Axis, children...), nil }))
+}
@@ -0,0 +1,315 @@
+package layers
+
+import (
+	"fmt"
+	"nnscratch/tensor"
+)
+
+// Gathers the parameters, weights and biases of several layers
+func collectParameters(layers []Layer) []*Parameter {
+	params := []*Parameter{}
+	for _, layer := range layers {
+		params = append(params, layer.GetParameters()...)
+	}
+	return params
+}
+
+func collectWeights(layers []Layer) []*tensor.Tensor {
+	var weights []*tensor.Tensor
+	for _, layer := range layers {
+		weights = append(weights, layer.GetWeights()...)
+	}
+	return weights
+}
+
+func collectBiases(layers []Layer) []*tensor.Tensor {
+	var biases []*tensor.Tensor
+	for _, layer := range layers {
+		biases = append(biases, layer.GetBiases()...)
+	}
+	return biases
+}
+
+func collectBuffers(layers []Layer) []*tensor.Tensor {
+	var buffers []*tensor.Tensor
+	for _, layer := range layers {
+		if b, ok := layer.(BufferLayer); ok {
+			buffers = append(buffers, b.GetBuffers()...)
+		}
+	}
+	return buffers
+}
+
+// Skip connection, out = shortcut(x) + body(x). The shortcut is the identity
+// unless set, e.g. to a 1x1 convolution when the body changes the shape
+type Residual struct {
+	Body     Layer
+	Shortcut Layer // nil for the identity
+}
+
+func NewResidual(body Layer) *Residual {
+	return &Residual{Body: body}
+}
+
+func (r *Residual) branches() []Layer {
+	if r.Shortcut == nil {
+		return []Layer{r.Body}
+	}
+	return []Layer{r.Body, r.Shortcut}
+}
+
+func (r *Residual) SetTraining(training bool) {
+	for _, layer := range r.branches() {
+		SetTraining(layer, training)
+	}
+}
+
+func (r *Residual) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	out, err := r.Body.Forward(input)
+	if err != nil {
+		return nil, err
+	}
+	skip := input
+	if r.Shortcut != nil {
+		skip, err = r.Shortcut.Forward(input)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !listEqual(out.Shape(), skip.Shape()) {
+		return nil, fmt.Errorf("residual: body output %v does not match shortcut %v", out.Shape(), skip.Shape())
+	}
+	return tensor.TensorAdd(skip, out)
+}
+
+// The gradient goes to both paths and their input gradients are summed
+func (r *Residual) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	grad, err := r.Body.Backward(gradOutput, lr)
+	if err != nil {
+		return nil, err
+	}
+	skip := gradOutput
+	if r.Shortcut != nil {
+		skip, err = r.Shortcut.Backward(gradOutput, lr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tensor.TensorAdd(grad, skip)
+}
+
+func (r *Residual) GetParameters() []*Parameter {
+	return collectParameters(r.branches())
+}
+
+func (r *Residual) GetWeights() []*tensor.Tensor {
+	return collectWeights(r.branches())
+}
+
+func (r *Residual) GetBiases() []*tensor.Tensor {
+	return collectBiases(r.branches())
+}
+
+func (r *Residual) GetBuffers() []*tensor.Tensor {
+	return collectBuffers(r.branches())
+}
+
+// Runs every branch on the same input and sums their outputs, which must
+// have the same shape
+type Parallel struct {
+	Branches []Layer
+}
+
+func NewParallel(branches ...Layer) *Parallel {
+	return &Parallel{Branches: branches}
+}
+
+func (p *Parallel) SetTraining(training bool) {
+	for _, layer := range p.Branches {
+		SetTraining(layer, training)
+	}
+}
+
+func (p *Parallel) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	if len(p.Branches) == 0 {
+		return nil, fmt.Errorf("parallel: no branches")
+	}
+	var sum *tensor.Tensor
+	for i, branch := range p.Branches {
+		out, err := branch.Forward(input)
+		if err != nil {
+			return nil, err
+		}
+		if sum == nil {
+			sum = out
+			continue
+		}
+		if !listEqual(out.Shape(), sum.Shape()) {
+			return nil, fmt.Errorf("parallel: branch %d output %v does not match %v", i, out.Shape(), sum.Shape())
+		}
+		sum, err = tensor.TensorAdd(sum, out)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sum, nil
+}
+
+// Every branch gets the output gradient and their input gradients are summed
+func (p *Parallel) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	return fanIn("parallel", p.Branches, func(i int) *tensor.Tensor { return gradOutput }, lr)
+}
+
+// Backpropagates every branch with its gradient and sums the input gradients
+func fanIn(name string, branches []Layer, grad func(i int) *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	var sum *tensor.Tensor
+	for i, branch := range branches {
+		dx, err := branch.Backward(grad(i), lr)
+		if err != nil {
+			return nil, err
+		}
+		if sum == nil {
+			sum = dx
+			continue
+		}
+		sum, err = tensor.TensorAdd(sum, dx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if sum == nil {
+		return nil, fmt.Errorf("%s: no branches", name)
+	}
+	return sum, nil
+}
+
+func (p *Parallel) GetParameters() []*Parameter {
+	return collectParameters(p.Branches)
+}
+
+func (p *Parallel) GetWeights() []*tensor.Tensor {
+	return collectWeights(p.Branches)
+}
+
+func (p *Parallel) GetBiases() []*tensor.Tensor {
+	return collectBiases(p.Branches)
+}
+
+func (p *Parallel) GetBuffers() []*tensor.Tensor {
+	return collectBuffers(p.Branches)
+}
+
+// Runs every branch on the same input and joins their outputs along Axis,
+// like the inception blocks
+type Concat struct {
+	Branches []Layer
+	Axis     int
+	sizes    []int // size of every branch output along Axis
+}
+
+func NewConcat(axis int, branches ...Layer) *Concat {
+	return &Concat{Branches: branches, Axis: axis}
+}
+
+func (c *Concat) SetTraining(training bool) {
+	for _, layer := range c.Branches {
+		SetTraining(layer, training)
+	}
+}
+
+func (c *Concat) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	if len(c.Branches) == 0 {
+		return nil, fmt.Errorf("concat: no branches")
+	}
+	outs := make([]*tensor.Tensor, len(c.Branches))
+	c.sizes = make([]int, len(c.Branches))
+	for i, branch := range c.Branches {
+		out, err := branch.Forward(input)
+		if err != nil {
+			return nil, err
+		}
+		axis := c.Axis
+		if axis < 0 {
+			axis += len(out.Shape())
+		}
+		if axis < 0 || axis >= len(out.Shape()) {
+			return nil, fmt.Errorf("concat: axis %d out of range for branch %d output %v", c.Axis, i, out.Shape())
+		}
+		outs[i] = out
+		c.sizes[i] = out.Shape()[axis]
+	}
+	return tensor.Concat(c.Axis, outs...)
+}
+
+// The output gradient is split along Axis and every branch gets its part
+func (c *Concat) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	if c.sizes == nil {
+		return nil, fmt.Errorf("concat: backward called before forward")
+	}
+	parts := make([]*tensor.Tensor, len(c.Branches))
+	start := 0
+	for i, size := range c.sizes {
+		part, err := gradOutput.Narrow(c.Axis, start, size)
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = part
+		start += size
+	}
+	return fanIn("concat", c.Branches, func(i int) *tensor.Tensor { return parts[i] }, lr)
+}
+
+func (c *Concat) GetParameters() []*Parameter {
+	return collectParameters(c.Branches)
+}
+
+func (c *Concat) GetWeights() []*tensor.Tensor {
+	return collectWeights(c.Branches)
+}
+
+func (c *Concat) GetBiases() []*tensor.Tensor {
+	return collectBiases(c.Branches)
+}
+
+func (c *Concat) GetBuffers() []*tensor.Tensor {
+	return collectBuffers(c.Branches)
+}
+
+// Wraps plain functions as a parameterless layer. The backward function gets
+// the forward input and the output gradient and gives the input gradient
+type LambdaLayer struct {
+	Fn    func(input *tensor.Tensor) (*tensor.Tensor, error)
+	Grad  func(input, gradOutput *tensor.Tensor) (*tensor.Tensor, error)
+	input *tensor.Tensor
+}
+
+func NewLambdaLayer(fn func(input *tensor.Tensor) (*tensor.Tensor, error), grad func(input, gradOutput *tensor.Tensor) (*tensor.Tensor, error)) *LambdaLayer {
+	return &LambdaLayer{Fn: fn, Grad: grad}
+}
+
+func (l *LambdaLayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	l.input = input
+	return l.Fn(input)
+}
+
+func (l *LambdaLayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	if l.input == nil {
+		return nil, fmt.Errorf("lambda: backward called before forward")
+	}
+	if l.Grad == nil {
+		return nil, fmt.Errorf("lambda: no backward function")
+	}
+	return l.Grad(l.input, gradOutput)
+}
+
+func (l *LambdaLayer) GetParameters() []*Parameter {
+	return []*Parameter{}
+}
+
+func (l *LambdaLayer) GetWeights() []*tensor.Tensor {
+	return nil
+}
+
+func (l *LambdaLayer) GetBiases() []*tensor.Tensor {
+	return nil
+}
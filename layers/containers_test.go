@@ -0,0 +1,91 @@
+package layers_test
+
+import (
+	"nnscratch/gradcheck"
+	"nnscratch/layers"
+	"nnscratch/tensor"
+	"testing"
+)
+
+func square() layers.Layer {
+	return layers.NewLambdaLayer(
+		func(x *tensor.Tensor) (*tensor.Tensor, error) {
+			return tensor.TensorMul(x, x)
+		},
+		func(x, g *tensor.Tensor) (*tensor.Tensor, error) {
+			twice, err := x.MulScalar(2)
+			if err != nil {
+				return nil, err
+			}
+			return tensor.TensorMul(twice, g)
+		})
+}
+
+func TestContainerGradients(t *testing.T) {
+	mlp := func() layers.Layer {
+		return layers.NewSequential(layers.NewDenseLayer(4, 5), &layers.TanhLayer{}, layers.NewDenseLayer(5, 4))
+	}
+	residual := func() layers.Layer {
+		return layers.NewResidual(layers.NewSequential(layers.NewDenseLayer(4, 4), &layers.TanhLayer{}))
+	}
+	tests := []struct {
+		name  string
+		layer func() layers.Layer
+	}{
+		{"sequential", mlp},
+		{"residual", residual},
+		{"residual with shortcut", func() layers.Layer {
+			r := layers.NewResidual(layers.NewDenseLayer(4, 2))
+			r.Shortcut = layers.NewDenseLayer(4, 2)
+			return r
+		}},
+		{"parallel", func() layers.Layer {
+			return layers.NewParallel(layers.NewDenseLayer(4, 3), layers.NewSequential(layers.NewDenseLayer(4, 3), &layers.SwishLayer{}))
+		}},
+		{"concat", func() layers.Layer {
+			return layers.NewConcat(-1, layers.NewDenseLayer(4, 3), residual(), &layers.TanhLayer{})
+		}},
+		{"nested", func() layers.Layer {
+			return layers.NewSequential(mlp(), layers.NewConcat(-1, layers.NewDenseLayer(4, 3), residual()), square())
+		}},
+	}
+	// summing several branches leaves more rounding in the finite differences
+	opts := gradcheck.DefaultOptions()
+	opts.AbsTolerance = 1e-7
+	x := randomInput(t, 3, 4)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := tt.layer()
+			scaleParameters(t, l, 50)
+			checkLayer(t, l, x, opts)
+		})
+	}
+}
+
+func TestContainerForward(t *testing.T) {
+	x := tensorOf(t, []float64{1, -2, 3, 0.5}, 2, 2)
+	tests := []struct {
+		name  string
+		layer layers.Layer
+		shape []int
+		want  []float64
+	}{
+		// x + x^2
+		{"residual", layers.NewResidual(square()), []int{2, 2}, []float64{2, 2, 12, 0.75}},
+		// x^2 + relu(x)
+		{"parallel", layers.NewParallel(square(), &layers.ReLULayer{}), []int{2, 2}, []float64{2, 4, 12, 0.75}},
+		// [x^2, relu(x)] side by side
+		{"concat", layers.NewConcat(1, square(), &layers.ReLULayer{}), []int{2, 4}, []float64{1, 4, 1, 0, 9, 0.25, 3, 0.5}},
+		// (x^2)^2
+		{"sequential", layers.NewSequential(square(), square()), []int{2, 2}, []float64{1, 16, 81, 0.0625}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := tt.layer.Forward(x)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectValues(t, out, tt.shape, tt.want)
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package layers
+
+import (
+	"fmt"
+	"nnscratch/tensor"
+)
+
+// Shared im2col machinery for the convolution layers. Every sample is
+// unrolled into a matrix of columns (C*kH*kW, outH*outW) so the convolution
+// becomes one matrix product per group. 1d convolutions run as 2d ones with
+// a height of 1.
+
+// Sizes of one convolution, padTop and padLeft say where the first window
+// starts; padding on the other sides only shows up in outH and outW
+type convGeometry struct {
+	inC, outC, groups int
+	kH, kW            int
+	strideH, strideW  int
+	padTop, padLeft   int
+	dilH, dilW        int
+	inH, inW          int
+	outH, outW        int
+}
+
+// Gives the output size of a dimension and an error when the window does not fit
+func convOutSize(in, kernel, stride, padBefore, padAfter, dilation int) (int, error) {
+	span := dilation*(kernel-1) + 1
+	size := in + padBefore + padAfter - span
+	if size < 0 {
+		return 0, fmt.Errorf("conv: kernel span %d does not fit input size %d with padding (%d, %d)", span, in, padBefore, padAfter)
+	}
+	return size/stride + 1, nil
+}
+
+// Number of rows in the column matrix of one group
+func (g *convGeometry) groupCols() int {
+	return g.inC / g.groups * g.kH * g.kW
+}
+
+// Unrolls one sample (C, H, W) into columns (C*kH*kW, outH*outW)
+func im2col(x []float64, g *convGeometry) []float64 {
+	outP := g.outH * g.outW
+	cols := make([]float64, g.inC*g.kH*g.kW*outP)
+	for c := 0; c < g.inC; c++ {
+		for i := 0; i < g.kH; i++ {
+			for j := 0; j < g.kW; j++ {
+				row := ((c*g.kH+i)*g.kW + j) * outP
+				for oh := 0; oh < g.outH; oh++ {
+					ih := oh*g.strideH - g.padTop + i*g.dilH
+					if ih < 0 || ih >= g.inH {
+						continue
+					}
+					for ow := 0; ow < g.outW; ow++ {
+						iw := ow*g.strideW - g.padLeft + j*g.dilW
+						if iw < 0 || iw >= g.inW {
+							continue
+						}
+						cols[row+oh*g.outW+ow] = x[(c*g.inH+ih)*g.inW+iw]
+					}
+				}
+			}
+		}
+	}
+	return cols
+}
+
+// Adds columns back into the sample they came from, the reverse of im2col
+func col2im(cols []float64, dx []float64, g *convGeometry) {
+	outP := g.outH * g.outW
+	for c := 0; c < g.inC; c++ {
+		for i := 0; i < g.kH; i++ {
+			for j := 0; j < g.kW; j++ {
+				row := ((c*g.kH+i)*g.kW + j) * outP
+				for oh := 0; oh < g.outH; oh++ {
+					ih := oh*g.strideH - g.padTop + i*g.dilH
+					if ih < 0 || ih >= g.inH {
+						continue
+					}
+					for ow := 0; ow < g.outW; ow++ {
+						iw := ow*g.strideW - g.padLeft + j*g.dilW
+						if iw < 0 || iw >= g.inW {
+							continue
+						}
+						dx[(c*g.inH+ih)*g.inW+iw] += cols[row+oh*g.outW+ow]
+					}
+				}
+			}
+		}
+	}
+}
+
+// Convolves a batch x (N, C, H, W) with weights (outC, C/groups*kH*kW) and an
+// optional bias, giving (N, outC, outH, outW) and the columns of every sample
+func convForward(x *tensor.Tensor, weights *tensor.Tensor, bias *tensor.Tensor, g *convGeometry) (*tensor.Tensor, [][]float64, error) {
+	batch := x.Shape()[0]
+	out, err := tensor.NewTensor(batch, g.outC, g.outH, g.outW)
+	if err != nil {
+		return nil, nil, err
+	}
+	xd := x.Contiguous().Data()
+	wd := weights.Contiguous().Data()
+	od := out.Data()
+	var bd []float64
+	if bias != nil {
+		bd = bias.Contiguous().Data()
+	}
+
+	inSize := g.inC * g.inH * g.inW
+	outP := g.outH * g.outW
+	outCg := g.outC / g.groups
+	ck := g.groupCols()
+	allCols := make([][]float64, batch)
+	for n := 0; n < batch; n++ {
+		cols := im2col(xd[n*inSize:(n+1)*inSize], g)
+		allCols[n] = cols
+		on := od[n*g.outC*outP : (n+1)*g.outC*outP]
+		for grp := 0; grp < g.groups; grp++ {
+			gemm(on[grp*outCg*outP:(grp+1)*outCg*outP], wd[grp*outCg*ck:(grp+1)*outCg*ck], cols[grp*ck*outP:(grp+1)*ck*outP], outCg, ck, outP)
+		}
+		if bd != nil {
+			for oc := 0; oc < g.outC; oc++ {
+				row := on[oc*outP : (oc+1)*outP]
+				for p := range row {
+					row[p] += bd[oc]
+				}
+			}
+		}
+	}
+	return out, allCols, nil
+}
+
+// Gives the input, weight and bias gradients of convForward for gradOutput (N, outC, outH, outW)
+func convBackward(gradOutput *tensor.Tensor, weights *tensor.Tensor, allCols [][]float64, g *convGeometry) (dx, dw, db []float64) {
+	batch := len(allCols)
+	gd := gradOutput.Contiguous().Data()
+	wd := weights.Contiguous().Data()
+
+	inSize := g.inC * g.inH * g.inW
+	outP := g.outH * g.outW
+	outCg := g.outC / g.groups
+	ck := g.groupCols()
+	dx = make([]float64, batch*inSize)
+	dw = make([]float64, g.outC*ck)
+	db = make([]float64, g.outC)
+	dcols := make([]float64, g.inC*g.kH*g.kW*outP)
+	for n := 0; n < batch; n++ {
+		gn := gd[n*g.outC*outP : (n+1)*g.outC*outP]
+		cols := allCols[n]
+		for i := range dcols {
+			dcols[i] = 0
+		}
+		for grp := 0; grp < g.groups; grp++ {
+			gg := gn[grp*outCg*outP : (grp+1)*outCg*outP]
+			wg := wd[grp*outCg*ck : (grp+1)*outCg*ck]
+			// dW = dOut * cols^T and dCols = W^T * dOut
+			gemmBT(dw[grp*outCg*ck:(grp+1)*outCg*ck], gg, cols[grp*ck*outP:(grp+1)*ck*outP], outCg, outP, ck)
+			gemmAT(dcols[grp*ck*outP:(grp+1)*ck*outP], wg, gg, ck, outCg, outP)
+		}
+		col2im(dcols, dx[n*inSize:(n+1)*inSize], g)
+		for oc := 0; oc < g.outC; oc++ {
+			for _, v := range gn[oc*outP : (oc+1)*outP] {
+				db[oc] += v
+			}
+		}
+	}
+	return dx, dw, db
+}
+
+// Wraps raw data in a new tensor of the given shape
+func tensorFrom(data []float64, shape ...int) (*tensor.Tensor, error) {
+	t, err := tensor.NewTensor(shape...)
+	if err != nil {
+		return nil, err
+	}
+	copy(t.Data(), data)
+	return t, nil
+}
+
+// Check if two shapes are the same
+func listEqual(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,164 @@
+package layers
+
+import (
+	"fmt"
+	"nnscratch/tensor"
+)
+
+// Padding modes of a Conv1DLayer. Same keeps the length when the stride is
+// 1 and causal pads only the start so an output never sees later steps
+const (
+	PaddingSame   = "same"
+	PaddingCausal = "causal"
+)
+
+// Settings of a Conv1DLayer. Padding is used on both ends unless PaddingMode
+// is set. Stride, Dilation and Groups default to 1 when left at zero
+type Conv1DConfig struct {
+	InChannels  int
+	OutChannels int
+	KernelSize  int
+	Stride      int
+	Padding     int
+	PaddingMode string
+	Dilation    int
+	Groups      int
+	NoBias      bool
+}
+
+// 1d convolution over (batch, channels, length) tensors, it runs as a 2d
+// convolution with a height of 1
+type Conv1DLayer struct {
+	Weights *Parameter // (out, in/groups, kernel)
+	Bias    *Parameter // (out), nil when Config.NoBias
+	Config  Conv1DConfig
+	geom    convGeometry
+	cols    [][]float64
+}
+
+func NewConv1DLayer(cfg Conv1DConfig) (*Conv1DLayer, error) {
+	if cfg.Stride == 0 {
+		cfg.Stride = 1
+	}
+	if cfg.Dilation == 0 {
+		cfg.Dilation = 1
+	}
+	if cfg.Groups == 0 {
+		cfg.Groups = 1
+	}
+	if cfg.KernelSize <= 0 || cfg.Stride < 0 || cfg.Dilation < 0 || cfg.Padding < 0 {
+		return nil, fmt.Errorf("conv1d: kernel size, stride, padding and dilation must be positive got %+v", cfg)
+	}
+	switch cfg.PaddingMode {
+	case "", PaddingCausal:
+	case PaddingSame:
+		if cfg.Stride != 1 {
+			return nil, fmt.Errorf("conv1d: same padding needs a stride of 1 got %d", cfg.Stride)
+		}
+	default:
+		return nil, fmt.Errorf("conv1d: unknown padding mode %q", cfg.PaddingMode)
+	}
+	if cfg.InChannels <= 0 || cfg.OutChannels <= 0 || cfg.Groups < 0 || cfg.InChannels%cfg.Groups != 0 || cfg.OutChannels%cfg.Groups != 0 {
+		return nil, fmt.Errorf("conv1d: channels (%d, %d) must be positive and divisible by groups %d", cfg.InChannels, cfg.OutChannels, cfg.Groups)
+	}
+
+	shape := []int{cfg.OutChannels, cfg.InChannels / cfg.Groups, cfg.KernelSize}
+	w, _ := tensor.NewTensorRandom(shape...)
+	w_grad, _ := tensor.NewTensor(shape...)
+	c := &Conv1DLayer{
+		Weights: &Parameter{Value: w, Grad: w_grad},
+		Config:  cfg,
+	}
+	if !cfg.NoBias {
+		b, _ := tensor.NewTensorRandom(cfg.OutChannels)
+		b_grad, _ := tensor.NewTensor(cfg.OutChannels)
+		c.Bias = &Parameter{Value: b, Grad: b_grad}
+	}
+	return c, nil
+}
+
+// Gives the padding at the start and the end of the sequence
+func (c *Conv1DLayer) padding() (int, int) {
+	span := c.Config.Dilation * (c.Config.KernelSize - 1)
+	switch c.Config.PaddingMode {
+	case PaddingSame:
+		return span / 2, span - span/2
+	case PaddingCausal:
+		return span, 0
+	}
+	return c.Config.Padding, c.Config.Padding
+}
+
+func (c *Conv1DLayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	shape := input.Shape()
+	if len(shape) != 3 || shape[1] != c.Config.InChannels {
+		return nil, fmt.Errorf("conv1d: expected input (batch, %d, length) got %v", c.Config.InChannels, shape)
+	}
+	cfg := c.Config
+	left, right := c.padding()
+	outL, err := convOutSize(shape[2], cfg.KernelSize, cfg.Stride, left, right, cfg.Dilation)
+	if err != nil {
+		return nil, err
+	}
+	c.geom = convGeometry{
+		inC: cfg.InChannels, outC: cfg.OutChannels, groups: cfg.Groups,
+		kH: 1, kW: cfg.KernelSize,
+		strideH: 1, strideW: cfg.Stride,
+		padTop: 0, padLeft: left,
+		dilH: 1, dilW: cfg.Dilation,
+		inH: 1, inW: shape[2],
+		outH: 1, outW: outL,
+	}
+	var bias *tensor.Tensor
+	if c.Bias != nil {
+		bias = c.Bias.Value
+	}
+	out, cols, err := convForward(input, c.Weights.Value, bias, &c.geom)
+	if err != nil {
+		return nil, err
+	}
+	c.cols = cols
+	return out.Reshape(shape[0], cfg.OutChannels, outL)
+}
+
+func (c *Conv1DLayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	if c.cols == nil {
+		return nil, fmt.Errorf("conv1d: backward called before forward")
+	}
+	g := &c.geom
+	batch := len(c.cols)
+	if !listEqual(gradOutput.Shape(), []int{batch, g.outC, g.outW}) {
+		return nil, fmt.Errorf("conv1d: gradient shape %v does not match output (%d, %d, %d)", gradOutput.Shape(), batch, g.outC, g.outW)
+	}
+	dx, dw, db := convBackward(gradOutput, c.Weights.Value, c.cols, g)
+	var err error
+	c.Weights.Grad, err = tensorFrom(dw, c.Weights.Value.Shape()...)
+	if err != nil {
+		return nil, err
+	}
+	if c.Bias != nil {
+		c.Bias.Grad, err = tensorFrom(db, c.Bias.Value.Shape()...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tensorFrom(dx, batch, g.inC, g.inW)
+}
+
+func (c *Conv1DLayer) GetParameters() []*Parameter {
+	if c.Bias == nil {
+		return []*Parameter{c.Weights}
+	}
+	return []*Parameter{c.Weights, c.Bias}
+}
+
+func (c *Conv1DLayer) GetWeights() []*tensor.Tensor {
+	return []*tensor.Tensor{c.Weights.Value}
+}
+
+func (c *Conv1DLayer) GetBiases() []*tensor.Tensor {
+	if c.Bias == nil {
+		return nil
+	}
+	return []*tensor.Tensor{c.Bias.Value}
+}
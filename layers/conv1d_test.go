@@ -0,0 +1,89 @@
+package layers_test
+
+import (
+	"fmt"
+	"nnscratch/gradcheck"
+	"nnscratch/layers"
+	"testing"
+)
+
+func TestConv1DGradients(t *testing.T) {
+	configs := []layers.Conv1DConfig{
+		{InChannels: 2, OutChannels: 3, KernelSize: 3},
+		{InChannels: 2, OutChannels: 4, KernelSize: 3, Stride: 2, Padding: 1, Dilation: 2, Groups: 2},
+		{InChannels: 2, OutChannels: 2, KernelSize: 4, PaddingMode: layers.PaddingSame, Dilation: 2},
+		{InChannels: 2, OutChannels: 2, KernelSize: 3, PaddingMode: layers.PaddingCausal, Dilation: 2},
+	}
+	for i, cfg := range configs {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			conv, err := layers.NewConv1DLayer(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkLayer(t, conv, randomInput(t, 2, cfg.InChannels, 9), gradcheck.DefaultOptions())
+		})
+	}
+}
+
+func TestConv1DCausal(t *testing.T) {
+	conv, err := layers.NewConv1DLayer(layers.Conv1DConfig{InChannels: 2, OutChannels: 2, KernelSize: 3, PaddingMode: layers.PaddingCausal, Dilation: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := randomInput(t, 1, 2, 9)
+	out, err := conv.Forward(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Shape()[2] != 9 {
+		t.Fatalf("output shape %v, expected the length to stay 9", out.Shape())
+	}
+	before := out.Copy()
+
+	// changing the last step must leave every earlier output as it was
+	x.Set(5, 0, 0, 8)
+	after, err := conv.Forward(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for c := 0; c < 2; c++ {
+		for l := 0; l < 8; l++ {
+			a, _ := before.Get(0, c, l)
+			b, _ := after.Get(0, c, l)
+			if a != b {
+				t.Errorf("output %d at step %d changed from %v to %v", c, l, a, b)
+			}
+		}
+	}
+}
+
+func TestConv1DForward(t *testing.T) {
+	x := tensorOf(t, []float64{1, 2, 3, 4}, 1, 1, 4)
+	tests := []struct {
+		name   string
+		cfg    layers.Conv1DConfig
+		kernel []float64
+		want   []float64
+	}{
+		// x[l-1] + 2*x[l] + 3*x[l+1] with a zero on either end
+		{"same", layers.Conv1DConfig{InChannels: 1, OutChannels: 1, KernelSize: 3, PaddingMode: layers.PaddingSame, NoBias: true}, []float64{1, 2, 3}, []float64{8, 14, 20, 11}},
+		// x[l-1] + 10*x[l] with a zero before the start
+		{"causal", layers.Conv1DConfig{InChannels: 1, OutChannels: 1, KernelSize: 2, PaddingMode: layers.PaddingCausal, NoBias: true}, []float64{1, 10}, []float64{10, 21, 32, 43}},
+		// x[l-2] + 10*x[l]
+		{"dilated causal", layers.Conv1DConfig{InChannels: 1, OutChannels: 1, KernelSize: 2, PaddingMode: layers.PaddingCausal, Dilation: 2, NoBias: true}, []float64{1, 10}, []float64{10, 20, 31, 42}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conv, err := layers.NewConv1DLayer(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			conv.Weights.Value = tensorOf(t, tt.kernel, 1, 1, len(tt.kernel))
+			out, err := conv.Forward(x)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectValues(t, out, []int{1, 1, 4}, tt.want)
+		})
+	}
+}
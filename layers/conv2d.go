@@ -0,0 +1,139 @@
+package layers
+
+import (
+	"fmt"
+	"nnscratch/tensor"
+)
+
+// Settings of a Conv2DLayer, pairs are (height, width). Stride, Dilation and
+// Groups default to 1 when left at zero
+type Conv2DConfig struct {
+	InChannels  int
+	OutChannels int
+	KernelSize  [2]int
+	Stride      [2]int
+	Padding     [2]int
+	Dilation    [2]int
+	Groups      int
+	NoBias      bool
+}
+
+// 2d convolution over NCHW tensors (batch, channels, height, width)
+type Conv2DLayer struct {
+	Weights *Parameter // (out, in/groups, kH, kW)
+	Bias    *Parameter // (out), nil when Config.NoBias
+	Config  Conv2DConfig
+	geom    convGeometry
+	cols    [][]float64
+}
+
+func NewConv2DLayer(cfg Conv2DConfig) (*Conv2DLayer, error) {
+	for i := range 2 {
+		if cfg.Stride[i] == 0 {
+			cfg.Stride[i] = 1
+		}
+		if cfg.Dilation[i] == 0 {
+			cfg.Dilation[i] = 1
+		}
+		if cfg.KernelSize[i] <= 0 || cfg.Stride[i] < 0 || cfg.Dilation[i] < 0 || cfg.Padding[i] < 0 {
+			return nil, fmt.Errorf("conv2d: kernel size, stride, padding and dilation must be positive got %+v", cfg)
+		}
+	}
+	if cfg.Groups == 0 {
+		cfg.Groups = 1
+	}
+	if cfg.InChannels <= 0 || cfg.OutChannels <= 0 || cfg.Groups < 0 || cfg.InChannels%cfg.Groups != 0 || cfg.OutChannels%cfg.Groups != 0 {
+		return nil, fmt.Errorf("conv2d: channels (%d, %d) must be positive and divisible by groups %d", cfg.InChannels, cfg.OutChannels, cfg.Groups)
+	}
+
+	shape := []int{cfg.OutChannels, cfg.InChannels / cfg.Groups, cfg.KernelSize[0], cfg.KernelSize[1]}
+	w, _ := tensor.NewTensorRandom(shape...)
+	w_grad, _ := tensor.NewTensor(shape...)
+	c := &Conv2DLayer{
+		Weights: &Parameter{Value: w, Grad: w_grad},
+		Config:  cfg,
+	}
+	if !cfg.NoBias {
+		b, _ := tensor.NewTensorRandom(cfg.OutChannels)
+		b_grad, _ := tensor.NewTensor(cfg.OutChannels)
+		c.Bias = &Parameter{Value: b, Grad: b_grad}
+	}
+	return c, nil
+}
+
+func (c *Conv2DLayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	shape := input.Shape()
+	if len(shape) != 4 || shape[1] != c.Config.InChannels {
+		return nil, fmt.Errorf("conv2d: expected input (batch, %d, height, width) got %v", c.Config.InChannels, shape)
+	}
+	cfg := c.Config
+	outH, err := convOutSize(shape[2], cfg.KernelSize[0], cfg.Stride[0], cfg.Padding[0], cfg.Padding[0], cfg.Dilation[0])
+	if err != nil {
+		return nil, err
+	}
+	outW, err := convOutSize(shape[3], cfg.KernelSize[1], cfg.Stride[1], cfg.Padding[1], cfg.Padding[1], cfg.Dilation[1])
+	if err != nil {
+		return nil, err
+	}
+	c.geom = convGeometry{
+		inC: cfg.InChannels, outC: cfg.OutChannels, groups: cfg.Groups,
+		kH: cfg.KernelSize[0], kW: cfg.KernelSize[1],
+		strideH: cfg.Stride[0], strideW: cfg.Stride[1],
+		padTop: cfg.Padding[0], padLeft: cfg.Padding[1],
+		dilH: cfg.Dilation[0], dilW: cfg.Dilation[1],
+		inH: shape[2], inW: shape[3],
+		outH: outH, outW: outW,
+	}
+	var bias *tensor.Tensor
+	if c.Bias != nil {
+		bias = c.Bias.Value
+	}
+	out, cols, err := convForward(input, c.Weights.Value, bias, &c.geom)
+	if err != nil {
+		return nil, err
+	}
+	c.cols = cols
+	return out, nil
+}
+
+func (c *Conv2DLayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	if c.cols == nil {
+		return nil, fmt.Errorf("conv2d: backward called before forward")
+	}
+	g := &c.geom
+	batch := len(c.cols)
+	if !listEqual(gradOutput.Shape(), []int{batch, g.outC, g.outH, g.outW}) {
+		return nil, fmt.Errorf("conv2d: gradient shape %v does not match output (%d, %d, %d, %d)", gradOutput.Shape(), batch, g.outC, g.outH, g.outW)
+	}
+	dx, dw, db := convBackward(gradOutput, c.Weights.Value, c.cols, g)
+	var err error
+	c.Weights.Grad, err = tensorFrom(dw, c.Weights.Value.Shape()...)
+	if err != nil {
+		return nil, err
+	}
+	if c.Bias != nil {
+		c.Bias.Grad, err = tensorFrom(db, c.Bias.Value.Shape()...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tensorFrom(dx, batch, g.inC, g.inH, g.inW)
+}
+
+func (c *Conv2DLayer) GetParameters() []*Parameter {
+	if c.Bias == nil {
+		return []*Parameter{c.Weights}
+	}
+	return []*Parameter{c.Weights, c.Bias}
+}
+
+func (c *Conv2DLayer) GetWeights() []*tensor.Tensor {
+	return []*tensor.Tensor{c.Weights.Value}
+}
+
+func (c *Conv2DLayer) GetBiases() []*tensor.Tensor {
+	if c.Bias == nil {
+		return nil
+	}
+	return []*tensor.Tensor{c.Bias.Value}
+}
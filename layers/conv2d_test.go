@@ -0,0 +1,60 @@
+package layers_test
+
+import (
+	"fmt"
+	"nnscratch/gradcheck"
+	"nnscratch/layers"
+	"testing"
+)
+
+func TestConv2DGradients(t *testing.T) {
+	configs := []layers.Conv2DConfig{
+		{InChannels: 2, OutChannels: 3, KernelSize: [2]int{3, 3}},
+		{InChannels: 4, OutChannels: 2, KernelSize: [2]int{2, 3}, Stride: [2]int{2, 1}, Padding: [2]int{1, 2}, Dilation: [2]int{1, 2}, Groups: 2},
+		{InChannels: 2, OutChannels: 2, KernelSize: [2]int{3, 3}, Padding: [2]int{1, 1}, Groups: 2, NoBias: true},
+	}
+	for i, cfg := range configs {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			conv, err := layers.NewConv2DLayer(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkLayer(t, conv, randomInput(t, 2, cfg.InChannels, 5, 6), gradcheck.DefaultOptions())
+		})
+	}
+}
+
+func TestConv2DForward(t *testing.T) {
+	x := tensorOf(t, []float64{1, 2, 3, 4, 5, 6, 7, 8, 9}, 1, 1, 3, 3)
+	tests := []struct {
+		name string
+		cfg  layers.Conv2DConfig
+		want []float64
+	}{
+		// 1*x[i,j] + 2*x[i,j+1] + 3*x[i+1,j] + 4*x[i+1,j+1] + 0.5
+		{"valid", layers.Conv2DConfig{InChannels: 1, OutChannels: 1, KernelSize: [2]int{2, 2}}, []float64{37.5, 47.5, 67.5, 77.5}},
+		// the windows start at the padded corners (0, 0), (0, 2), (2, 0), (2, 2)
+		{"padded and strided", layers.Conv2DConfig{InChannels: 1, OutChannels: 1, KernelSize: [2]int{2, 2}, Stride: [2]int{2, 2}, Padding: [2]int{1, 1}}, []float64{4.5, 18.5, 36.5, 77.5}},
+		// taps two apart cover the corners of the image
+		{"dilated", layers.Conv2DConfig{InChannels: 1, OutChannels: 1, KernelSize: [2]int{2, 2}, Dilation: [2]int{2, 2}}, []float64{1 + 6 + 21 + 36 + 0.5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conv, err := layers.NewConv2DLayer(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			conv.Weights.Value = tensorOf(t, []float64{1, 2, 3, 4}, 1, 1, 2, 2)
+			conv.Bias.Value = tensorOf(t, []float64{0.5}, 1)
+			out, err := conv.Forward(x)
+			if err != nil {
+				t.Fatal(err)
+			}
+			side := 2
+			if len(tt.want) == 1 {
+				side = 1
+			}
+			expectValues(t, out, []int{1, 1, side, side}, tt.want)
+		})
+	}
+}
@@ -7,7 +7,8 @@ import (
 type DenseLayer struct {
 	Weights *Parameter
 	Bias    *Parameter
-	input   *tensor.Tensor
+	input   *tensor.Tensor // flattened to (rows, in)
+	shape   []int          // shape of the input
 }
 
 func NewDenseLayer(in_features int, out_features int) *DenseLayer {
@@ -24,7 +25,12 @@ func NewDenseLayer(in_features int, out_features int) *DenseLayer {
 
 }
 
+// Input is (..., in), leading dimensions are flattened into the batch
 func (d *DenseLayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	d.shape = input.Shape()
+	if len(d.shape) > 2 {
+		input, _ = input.Reshape(-1, d.shape[len(d.shape)-1])
+	}
 	d.input = input
 	w_t, _ := d.Weights.Value.Transpose()
 	res, err := tensor.Matmul(input, w_t)
@@ -35,10 +41,22 @@ func (d *DenseLayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
 	if err != nil {
 		return nil, err
 	}
+	if len(d.shape) > 2 {
+		outShape := append([]int(nil), d.shape...)
+		outShape[len(outShape)-1] = res.Shape()[1]
+		return res.Reshape(outShape...)
+	}
 	return res, nil
 }
 
 func (d *DenseLayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	if len(d.shape) > 2 {
+		var err error
+		gradOutput, err = gradOutput.Reshape(-1, gradOutput.Shape()[len(gradOutput.Shape())-1])
+		if err != nil {
+			return nil, err
+		}
+	}
 	go_t, _ := gradOutput.Transpose()
 	dW, err := tensor.Matmul(go_t, d.input)
 	if err != nil {
@@ -47,23 +65,19 @@ func (d *DenseLayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Te
 	d.Weights.Grad = dW
 
 	gradInput, _ := tensor.Matmul(gradOutput, d.Weights.Value)
-
-	batchSize := gradOutput.Shape()[0]
-	onesVector, err := tensor.NewTensorOnes(1, batchSize)
-	if err != nil {
-		return nil, err
-	}
-	db_raw, err := tensor.Matmul(onesVector, gradOutput)
-	if err != nil {
-		return nil, err
+	if len(d.shape) > 2 {
+		gradInput, err = gradInput.Reshape(d.shape...)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// Reshape to bias shape
-	db_adjusted, err := db_raw.Reshape(d.Bias.Value.Shape()...)
+	// bias gradient is the gradient summed over the batch, shaped like the bias (1, out)
+	db, err := gradOutput.SumAxis(true, 0)
 	if err != nil {
 		return nil, err
 	}
-	d.Bias.Grad = db_adjusted
+	d.Bias.Grad = db
 	return gradInput, nil
 }
 
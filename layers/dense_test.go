@@ -0,0 +1,23 @@
+package layers_test
+
+import (
+	"nnscratch/gradcheck"
+	"nnscratch/layers"
+	"testing"
+)
+
+func TestDenseFlattensLeadingDims(t *testing.T) {
+	dense := layers.NewDenseLayer(2, 1)
+	copy(dense.Weights.Value.Data(), []float64{1, -2})
+	copy(dense.Bias.Value.Data(), []float64{0.5})
+
+	// (2, 2, 2) is taken as 4 rows of 2 features
+	x := tensorOf(t, []float64{1, 2, 3, 4, 0, 1, -1, 0}, 2, 2, 2)
+	out, err := dense.Forward(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectValues(t, out, []int{2, 2, 1}, []float64{-2.5, -4.5, -1.5, -0.5})
+
+	checkLayer(t, layers.NewDenseLayer(3, 2), randomInput(t, 2, 4, 3), gradcheck.DefaultOptions())
+}
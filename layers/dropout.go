@@ -0,0 +1,228 @@
+package layers
+
+import (
+	"fmt"
+	"math"
+	"nnscratch/activations"
+	"nnscratch/random"
+	"nnscratch/tensor"
+)
+
+// Shared state of the dropout layers. They only drop values in training mode
+// and are the identity in eval mode
+type dropout struct {
+	P         float64           // probability of dropping a value
+	Generator *random.Generator // nil draws from random.Default()
+	training  bool
+	name      string
+	shape     []int
+	mask      *tensor.Tensor // scale of every value in the last forward, nil for the identity
+}
+
+func newDropout(name string, p float64, maxP float64) (dropout, error) {
+	if p < 0 || p > maxP || math.IsNaN(p) {
+		return dropout{}, fmt.Errorf("%s: probability must be in [0, %g] got %g", name, maxP, p)
+	}
+	return dropout{P: p, training: true, name: name}, nil
+}
+
+func (d *dropout) SetTraining(training bool) {
+	d.training = training
+}
+
+// Whether the layer is in training mode
+func (d *dropout) Training() bool {
+	return d.training
+}
+
+func (d *dropout) rng() *random.Generator {
+	if d.Generator == nil {
+		return random.Default()
+	}
+	return d.Generator
+}
+
+// Whether the next forward drops anything
+func (d *dropout) active() bool {
+	return d.training && d.P > 0
+}
+
+// Gives a mask of the given shape that is 0 with probability P and keep elsewhere
+func (d *dropout) drawMask(keep float64, shape ...int) (*tensor.Tensor, error) {
+	mask, err := tensor.NewTensor(shape...)
+	if err != nil {
+		return nil, err
+	}
+	rng := d.rng()
+	md := mask.Data()
+	for i := range md {
+		if rng.Float64() >= d.P {
+			md[i] = keep
+		}
+	}
+	return mask, nil
+}
+
+// dx = g * mask, the identity when nothing was dropped
+func (d *dropout) backward(gradOutput *tensor.Tensor) (*tensor.Tensor, error) {
+	if d.shape == nil {
+		return nil, fmt.Errorf("%s: backward called before forward", d.name)
+	}
+	if !listEqual(gradOutput.Shape(), d.shape) {
+		return nil, fmt.Errorf("%s: gradient shape %v does not match output %v", d.name, gradOutput.Shape(), d.shape)
+	}
+	if d.mask == nil {
+		return gradOutput, nil
+	}
+	return tensor.TensorMul(gradOutput, d.mask)
+}
+
+func (d *dropout) GetParameters() []*Parameter {
+	return []*Parameter{}
+}
+
+func (d *dropout) GetWeights() []*tensor.Tensor {
+	return nil
+}
+
+func (d *dropout) GetBiases() []*tensor.Tensor {
+	return nil
+}
+
+// Gives the scale of the kept values so the expected output equals the input
+func keepScale(p float64) float64 {
+	if p >= 1 {
+		return 0
+	}
+	return 1 / (1 - p)
+}
+
+// Inverted dropout, every value is zeroed with probability P and the kept
+// ones are scaled by 1 / (1 - P)
+type DropoutLayer struct {
+	dropout
+}
+
+func NewDropoutLayer(p float64) (*DropoutLayer, error) {
+	d, err := newDropout("dropout", p, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &DropoutLayer{d}, nil
+}
+
+func (d *DropoutLayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	d.shape = input.Shape()
+	d.mask = nil
+	if !d.active() {
+		return input, nil
+	}
+	mask, err := d.drawMask(keepScale(d.P), d.shape...)
+	if err != nil {
+		return nil, err
+	}
+	d.mask = mask
+	return tensor.TensorMul(input, mask)
+}
+
+func (d *DropoutLayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	return d.backward(gradOutput)
+}
+
+// Channel dropout over (batch, channels, ...) inputs, whole channels of a
+// sample are zeroed with probability P and the kept ones scaled by 1 / (1 - P)
+type Dropout2D struct {
+	dropout
+}
+
+func NewDropout2D(p float64) (*Dropout2D, error) {
+	d, err := newDropout("dropout2d", p, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &Dropout2D{d}, nil
+}
+
+func (d *Dropout2D) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	shape := input.Shape()
+	if len(shape) < 2 {
+		return nil, fmt.Errorf("dropout2d: expected input (batch, channels, ...) got %v", shape)
+	}
+	d.shape = shape
+	d.mask = nil
+	if !d.active() {
+		return input, nil
+	}
+	maskShape := make([]int, len(shape))
+	for i := range maskShape {
+		maskShape[i] = 1
+	}
+	maskShape[0], maskShape[1] = shape[0], shape[1]
+	channels, err := d.drawMask(keepScale(d.P), maskShape...)
+	if err != nil {
+		return nil, err
+	}
+	d.mask, err = channels.BroadcastTo(shape...)
+	if err != nil {
+		return nil, err
+	}
+	return tensor.TensorMul(input, d.mask)
+}
+
+func (d *Dropout2D) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	return d.backward(gradOutput)
+}
+
+// Dropout for self normalizing networks (SELU). Dropped values are set to the
+// SELU saturation value and the result is moved back to the mean and
+// variance of the input
+type AlphaDropout struct {
+	dropout
+}
+
+// Value SELU saturates to for very negative inputs, -scale * alpha
+const alphaPrime = -activations.SELUScale * activations.SELUAlpha
+
+func NewAlphaDropout(p float64) (*AlphaDropout, error) {
+	d, err := newDropout("alphaDropout", p, math.Nextafter(1, 0))
+	if err != nil {
+		return nil, err
+	}
+	return &AlphaDropout{d}, nil
+}
+
+// y = a * (x * keep + alpha' * (1 - keep)) + b with
+// a = (q + alpha'^2 * q * p)^-1/2 and b = -a * alpha' * p where q = 1 - p
+func (d *AlphaDropout) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	d.shape = input.Shape()
+	d.mask = nil
+	if !d.active() {
+		return input, nil
+	}
+	q := 1 - d.P
+	a := 1 / math.Sqrt(q+alphaPrime*alphaPrime*q*d.P)
+	b := -a * alphaPrime * d.P
+	mask, err := d.drawMask(a, d.shape...)
+	if err != nil {
+		return nil, err
+	}
+	shift, err := mask.Apply(func(m float64) float64 {
+		if m == 0 {
+			return a*alphaPrime + b
+		}
+		return b
+	})
+	if err != nil {
+		return nil, err
+	}
+	d.mask = mask
+	res, err := tensor.TensorMul(input, mask)
+	if err != nil {
+		return nil, err
+	}
+	return tensor.TensorAdd(res, shift)
+}
+
+func (d *AlphaDropout) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	return d.backward(gradOutput)
+}
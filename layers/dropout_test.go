@@ -0,0 +1,127 @@
+package layers_test
+
+import (
+	"math"
+	"nnscratch/gradcheck"
+	"nnscratch/layers"
+	"nnscratch/random"
+	"nnscratch/tensor"
+	"slices"
+	"testing"
+)
+
+// Every forward in training mode draws a new mask, so the gradients are
+// checked where the layers are deterministic, in eval mode and with p = 0
+func TestDropoutGradients(t *testing.T) {
+	x := randomInput(t, 3, 4, 2, 2)
+	tests := []struct {
+		name string
+		new  func(p float64) (layers.Layer, error)
+	}{
+		{"dropout", func(p float64) (layers.Layer, error) { return layers.NewDropoutLayer(p) }},
+		{"dropout 2d", func(p float64) (layers.Layer, error) { return layers.NewDropout2D(p) }},
+		{"alpha dropout", func(p float64) (layers.Layer, error) { return layers.NewAlphaDropout(p) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zero, err := tt.new(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkLayer(t, zero, x, gradcheck.DefaultOptions())
+			eval, err := tt.new(0.5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			layers.SetTraining(eval, false)
+			checkLayer(t, eval, x, gradcheck.DefaultOptions())
+		})
+	}
+}
+
+func TestDropoutMask(t *testing.T) {
+	x, _ := tensor.NewTensorOnes(200, 50)
+	d, err := layers.NewDropoutLayer(0.3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Generator = random.New(5)
+	out, err := d.Forward(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grad, err := d.Backward(x, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// kept values are scaled by 1/(1-p) and the gradient goes through the same mask
+	dropped := 0
+	for i, v := range out.Data() {
+		if v == 0 {
+			dropped++
+		} else if math.Abs(v-1/0.7) > 1e-12 {
+			t.Fatalf("kept value %v, expected %v", v, 1/0.7)
+		}
+		if grad.Data()[i] != v {
+			t.Fatalf("gradient %v where the output is %v", grad.Data()[i], v)
+		}
+	}
+	if rate := float64(dropped) / float64(x.Len()); math.Abs(rate-0.3) > 0.02 {
+		t.Errorf("dropped %v of the values, expected about 0.3", rate)
+	}
+
+	// the same seed draws the same mask
+	again, _ := layers.NewDropoutLayer(0.3)
+	again.Generator = random.New(5)
+	out2, _ := again.Forward(x)
+	if !slices.Equal(out.Data(), out2.Data()) {
+		t.Error("the same seed gave a different mask")
+	}
+}
+
+func TestAlphaDropoutKeepsStatistics(t *testing.T) {
+	d, err := layers.NewAlphaDropout(0.2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Generator = random.New(5)
+	out, err := d.Forward(randomInput(t, 200, 50))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mean, _ := out.Mean(false)
+	variance, _ := out.Var(false)
+	if math.Abs(mean.Data()[0]) > 0.05 || math.Abs(variance.Data()[0]-1) > 0.05 {
+		t.Errorf("mean %v and variance %v, expected about 0 and 1", mean.Data()[0], variance.Data()[0])
+	}
+}
+
+func TestDropout2DDropsChannels(t *testing.T) {
+	x, _ := tensor.NewTensorOnes(4, 6, 3, 3)
+	d, err := layers.NewDropout2D(0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Generator = random.New(3)
+	out, err := d.Forward(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every channel of every sample is either all dropped or all kept at 2
+	values := out.Data()
+	dropped := 0
+	for ch := 0; ch < 4*6; ch++ {
+		channel := values[ch*9 : (ch+1)*9]
+		if channel[0] == 0 {
+			dropped++
+		}
+		for _, v := range channel {
+			if v != channel[0] || (v != 0 && v != 2) {
+				t.Fatalf("channel %d holds %v", ch, channel)
+			}
+		}
+	}
+	if dropped == 0 || dropped == 4*6 {
+		t.Errorf("%d of %d channels dropped", dropped, 4*6)
+	}
+}
@@ -0,0 +1,152 @@
+package layers
+
+import (
+	"fmt"
+	"math"
+	"nnscratch/tensor"
+)
+
+// Lookup table mapping integer indices of any shape to rows of Weight, an
+// input (batch, seq) gives (batch, seq, dim)
+type EmbeddingLayer struct {
+	Weight     *Parameter // (numEmbeddings, dim)
+	PaddingIdx int        // row that stays zero and gets no gradient, -1 for none
+	MaxNorm    float64    // rows looked up with a larger l2 norm are scaled down to it, 0 to turn off
+	indices    []int
+	shape      []int
+}
+
+func NewEmbeddingLayer(numEmbeddings, dim, paddingIdx int) (*EmbeddingLayer, error) {
+	if numEmbeddings <= 0 || dim <= 0 {
+		return nil, fmt.Errorf("embedding: sizes (%d, %d) must be positive", numEmbeddings, dim)
+	}
+	if paddingIdx < -1 || paddingIdx >= numEmbeddings {
+		return nil, fmt.Errorf("embedding: padding index %d out of range for %d embeddings", paddingIdx, numEmbeddings)
+	}
+	w, _ := tensor.NewTensorRandom(numEmbeddings, dim)
+	w_grad, _ := tensor.NewTensor(numEmbeddings, dim)
+	if paddingIdx >= 0 {
+		row := w.Data()[paddingIdx*dim : (paddingIdx+1)*dim]
+		for i := range row {
+			row[i] = 0
+		}
+	}
+	return &EmbeddingLayer{
+		Weight:     &Parameter{Value: w, Grad: w_grad},
+		PaddingIdx: paddingIdx,
+	}, nil
+}
+
+func (e *EmbeddingLayer) dims() (int, int) {
+	shape := e.Weight.Value.Shape()
+	return shape[0], shape[1]
+}
+
+// Reads the indices out of input and checks they are whole and in range
+func (e *EmbeddingLayer) readIndices(input *tensor.Tensor) ([]int, error) {
+	num, _ := e.dims()
+	values := input.Contiguous().Data()
+	indices := make([]int, len(values))
+	for i, v := range values {
+		idx := int(v)
+		if float64(idx) != v || idx < 0 || idx >= num {
+			return nil, fmt.Errorf("embedding: index %g is not an integer in [0, %d)", v, num)
+		}
+		indices[i] = idx
+	}
+	return indices, nil
+}
+
+// Scales the looked up rows whose norm is over MaxNorm, in place like torch
+func (e *EmbeddingLayer) renorm(indices []int) {
+	_, dim := e.dims()
+	w := e.Weight.Value.Data()
+	done := make(map[int]bool)
+	for _, idx := range indices {
+		if done[idx] {
+			continue
+		}
+		done[idx] = true
+		row := w[idx*dim : (idx+1)*dim]
+		var norm float64
+		for _, v := range row {
+			norm += v * v
+		}
+		norm = math.Sqrt(norm)
+		if norm > e.MaxNorm {
+			scale := e.MaxNorm / (norm + 1e-7)
+			for i := range row {
+				row[i] *= scale
+			}
+		}
+	}
+}
+
+func (e *EmbeddingLayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	indices, err := e.readIndices(input)
+	if err != nil {
+		return nil, err
+	}
+	if !e.Weight.Value.IsContiguous() {
+		e.Weight.Value = e.Weight.Value.Contiguous()
+	}
+	if e.MaxNorm > 0 {
+		e.renorm(indices)
+	}
+	_, dim := e.dims()
+	e.indices = indices
+	e.shape = input.Shape()
+
+	out, err := tensor.NewTensor(append(input.Shape(), dim)...)
+	if err != nil {
+		return nil, err
+	}
+	w := e.Weight.Value.Data()
+	od := out.Data()
+	for i, idx := range indices {
+		copy(od[i*dim:(i+1)*dim], w[idx*dim:(idx+1)*dim])
+	}
+	return out, nil
+}
+
+// Adds the gradient of every looked up position into the row it came from,
+// untouched rows and the padding row get a zero gradient. The indices have no
+// gradient so a zero tensor is given back
+func (e *EmbeddingLayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	if e.indices == nil {
+		return nil, fmt.Errorf("embedding: backward called before forward")
+	}
+	num, dim := e.dims()
+	if !listEqual(gradOutput.Shape(), append(append([]int(nil), e.shape...), dim)) {
+		return nil, fmt.Errorf("embedding: gradient shape %v does not match output %v + (%d)", gradOutput.Shape(), e.shape, dim)
+	}
+	grad, err := tensor.NewTensor(num, dim)
+	if err != nil {
+		return nil, err
+	}
+	g := gradOutput.Contiguous().Data()
+	gd := grad.Data()
+	for i, idx := range e.indices {
+		if idx == e.PaddingIdx {
+			continue
+		}
+		row := gd[idx*dim : (idx+1)*dim]
+		for j, v := range g[i*dim : (i+1)*dim] {
+			row[j] += v
+		}
+	}
+	e.Weight.Grad = grad
+	return tensor.NewTensor(e.shape...)
+}
+
+func (e *EmbeddingLayer) GetParameters() []*Parameter {
+	return []*Parameter{e.Weight}
+}
+
+func (e *EmbeddingLayer) GetWeights() []*tensor.Tensor {
+	return []*tensor.Tensor{e.Weight.Value}
+}
+
+func (e *EmbeddingLayer) GetBiases() []*tensor.Tensor {
+	return nil
+}
@@ -0,0 +1,130 @@
+package layers_test
+
+import (
+	"nnscratch/gradcheck"
+	"nnscratch/layers"
+	"nnscratch/tensor"
+	"slices"
+	"testing"
+)
+
+// Looks up fixed indices whatever the input, the indices can't be nudged by
+// finite differences so this lets CheckLayer check the weight gradient
+type fixedLookup struct {
+	*layers.EmbeddingLayer
+	indices *tensor.Tensor
+}
+
+func (f fixedLookup) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	return f.EmbeddingLayer.Forward(f.indices)
+}
+
+func (f fixedLookup) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	if _, err := f.EmbeddingLayer.Backward(gradOutput, lr); err != nil {
+		return nil, err
+	}
+	return tensor.NewTensor(1)
+}
+
+// The padding row is used by forward but gets no gradient on purpose, so it
+// is left out here and checked on its own below
+func TestEmbeddingGradients(t *testing.T) {
+	e, err := layers.NewEmbeddingLayer(5, 3, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Weight.Value, _ = e.Weight.Value.MulScalar(100)
+	indices, _ := tensor.NewTensorInput([][]float64{{1, 0, 1}, {4, 2, 1}})
+	dummy, _ := tensor.NewTensor(1)
+	checkLayer(t, fixedLookup{e, indices}, dummy, gradcheck.DefaultOptions())
+}
+
+func TestEmbeddingPaddingRow(t *testing.T) {
+	e, err := layers.NewEmbeddingLayer(5, 3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indices, _ := tensor.NewTensorInput([][]float64{{1, 0, 1}, {4, 2, 0}})
+	out, err := e.Forward(indices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ones, _ := tensor.NewTensorOnes(out.Shape()...)
+	if _, err := e.Backward(ones, 0); err != nil {
+		t.Fatal(err)
+	}
+	// row 1 is looked up twice, row 3 never and row 0 is padding
+	want := []float64{0, 0, 0, 2, 2, 2, 1, 1, 1, 0, 0, 0, 1, 1, 1}
+	for i, g := range e.Weight.Grad.Data() {
+		if g != want[i] {
+			t.Fatalf("weight gradient %v, expected %v", e.Weight.Grad.Data(), want)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if v, _ := out.Get(0, 1, i); v != 0 {
+			t.Errorf("padding row looked up as %v", v)
+		}
+	}
+}
+
+func TestEmbeddingRejectsBadIndices(t *testing.T) {
+	e, _ := layers.NewEmbeddingLayer(5, 3, -1)
+	for _, v := range []float64{1.5, -1, 5} {
+		bad, _ := tensor.NewTensorInput([]float64{v})
+		if _, err := e.Forward(bad); err == nil {
+			t.Errorf("index %v was accepted", v)
+		}
+	}
+}
+
+func TestEmbeddingGradientIsFresh(t *testing.T) {
+	e, err := layers.NewEmbeddingLayer(6, 2, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backward := func(indices ...float64) []float64 {
+		t.Helper()
+		input, _ := tensor.NewTensorInput(indices)
+		out, err := e.Forward(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ones, _ := tensor.NewTensorOnes(out.Shape()...)
+		if _, err := e.Backward(ones, 0); err != nil {
+			t.Fatal(err)
+		}
+		return e.Weight.Grad.Data()
+	}
+
+	backward(0, 3, 3)
+	first := e.Weight.Grad
+	// nothing of the first call is left in the second one
+	got := backward(1, 3)
+	want := []float64{0, 0, 1, 1, 0, 0, 1, 1, 0, 0, 0, 0}
+	if !slices.Equal(got, want) {
+		t.Errorf("weight gradient %v, expected %v", got, want)
+	}
+	// and the gradient given out by the first call is left as it was
+	if want := []float64{1, 1, 0, 0, 0, 0, 2, 2, 0, 0, 0, 0}; !slices.Equal(first.Data(), want) {
+		t.Errorf("first gradient changed to %v, expected %v", first.Data(), want)
+	}
+}
+
+func TestEmbeddingMaxNorm(t *testing.T) {
+	e, err := layers.NewEmbeddingLayer(2, 2, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(e.Weight.Value.Data(), []float64{3, 4, 0.3, 0.4})
+	e.MaxNorm = 1
+	indices, _ := tensor.NewTensorInput([]float64{0, 1})
+	out, err := e.Forward(indices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// row 0 has a norm of 5 and is scaled down to 1 in place, row 1 is short enough
+	scale := 1 / (5 + 1e-7)
+	want := []float64{3 * scale, 4 * scale, 0.3, 0.4}
+	expectValues(t, out, []int{2, 2}, want)
+	expectValues(t, e.Weight.Value, []int{2, 2}, want)
+}
@@ -0,0 +1,53 @@
+package layers
+
+// Small matrix products over row major float slices for the layers that work
+// on raw data. They add into out so callers can accumulate
+
+// out(m, n) += a(m, k) * b(k, n)
+func gemm(out, a, b []float64, m, k, n int) {
+	for i := 0; i < m; i++ {
+		row := out[i*n : (i+1)*n]
+		for p := 0; p < k; p++ {
+			aip := a[i*k+p]
+			if aip == 0 {
+				continue
+			}
+			bp := b[p*n : (p+1)*n]
+			for j := range row {
+				row[j] += aip * bp[j]
+			}
+		}
+	}
+}
+
+// out(m, n) += a(m, k) * b(n, k)^T
+func gemmBT(out, a, b []float64, m, k, n int) {
+	for i := 0; i < m; i++ {
+		ai := a[i*k : (i+1)*k]
+		for j := 0; j < n; j++ {
+			bj := b[j*k : (j+1)*k]
+			val := 0.0
+			for p := range ai {
+				val += ai[p] * bj[p]
+			}
+			out[i*n+j] += val
+		}
+	}
+}
+
+// out(m, n) += a(k, m)^T * b(k, n)
+func gemmAT(out, a, b []float64, m, k, n int) {
+	for p := 0; p < k; p++ {
+		bp := b[p*n : (p+1)*n]
+		for i := 0; i < m; i++ {
+			api := a[p*m+i]
+			if api == 0 {
+				continue
+			}
+			row := out[i*n : (i+1)*n]
+			for j := range row {
+				row[j] += api * bp[j]
+			}
+		}
+	}
+}
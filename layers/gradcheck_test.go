@@ -0,0 +1,77 @@
+package layers_test
+
+import (
+	"math"
+	"math/rand"
+	"nnscratch/gradcheck"
+	"nnscratch/layers"
+	"nnscratch/tensor"
+	"slices"
+	"testing"
+)
+
+// Fails t when the gradients of l at input differ from finite differences
+func checkLayer(t *testing.T, l layers.Layer, input *tensor.Tensor, opts gradcheck.Options) {
+	t.Helper()
+	report, err := gradcheck.CheckLayer(l, input, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Passed() {
+		t.Errorf("gradients differ\n%s", report)
+	}
+}
+
+// Gives a tensor of N(0, 1) values, the same ones on every run
+func randomInput(t *testing.T, shape ...int) *tensor.Tensor {
+	t.Helper()
+	x, err := tensor.NewTensor(shape...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	data := x.Data()
+	for i := range data {
+		data[i] = rng.NormFloat64()
+	}
+	return x
+}
+
+// Gives a tensor of the given shape holding data
+func tensorOf(t *testing.T, data []float64, shape ...int) *tensor.Tensor {
+	t.Helper()
+	x, err := tensor.NewTensorInput(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, err = x.Reshape(shape...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return x
+}
+
+// Fails t when out does not hold want, up to rounding
+func expectValues(t *testing.T, out *tensor.Tensor, shape []int, want []float64) {
+	t.Helper()
+	if !slices.Equal(out.Shape(), shape) {
+		t.Fatalf("shape %v, expected %v", out.Shape(), shape)
+	}
+	for i, got := range out.Values() {
+		if math.Abs(got-want[i]) > 1e-9 {
+			t.Fatalf("got %v, expected %v", out.Values(), want)
+		}
+	}
+}
+
+// Fails t when the gradient of the loss at yPred differs from finite differences
+func checkLoss(t *testing.T, l layers.LossLayer, yPred, yActual *tensor.Tensor, opts gradcheck.Options) {
+	t.Helper()
+	report, err := gradcheck.CheckLoss(l, yPred, yActual, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Passed() {
+		t.Errorf("gradients differ\n%s", report)
+	}
+}
@@ -0,0 +1,613 @@
+package layers
+
+import (
+	"fmt"
+	"nnscratch/tensor"
+	"reflect"
+)
+
+// Layers that take several inputs, used as merge nodes of a GraphModel
+type MultiInputLayer interface {
+	ForwardMulti(inputs []*tensor.Tensor) (*tensor.Tensor, error)
+	BackwardMulti(gradOutput *tensor.Tensor, lr float64) ([]*tensor.Tensor, error)
+	GetParameters() []*Parameter
+	GetWeights() []*tensor.Tensor
+	GetBiases() []*tensor.Tensor
+}
+
+// One named node of a GraphModel, exactly one of layer and merge is set
+type graphNode struct {
+	name   string
+	layer  Layer
+	merge  MultiInputLayer
+	inputs []string
+}
+
+// The layer or merge layer of the node
+func (node *graphNode) module() any {
+	if node.layer != nil {
+		return node.layer
+	}
+	return node.merge
+}
+
+func (node *graphNode) parameters() []*Parameter {
+	if node.layer != nil {
+		return node.layer.GetParameters()
+	}
+	return node.merge.GetParameters()
+}
+
+func (node *graphNode) zeroGrads() error {
+	for _, p := range node.parameters() {
+		grad, err := tensor.NewTensor(p.Value.Shape()...)
+		if err != nil {
+			return err
+		}
+		p.Grad = grad
+	}
+	return nil
+}
+
+// Model output with its loss, the total loss is the weighted sum of the
+// output losses
+type graphOutput struct {
+	name   string
+	node   string
+	loss   LossLayer // nil for outputs that are only predicted
+	weight float64
+}
+
+// Model built as a directed acyclic graph of layers wired by name. Nodes run
+// in topological order on Forward and in reverse on Backward, a node feeding
+// several others gets the sum of their gradients. A layer must not be used by
+// more than one node since layers keep the state of their last forward
+type GraphModel struct {
+	inputs  []string
+	nodes   []*graphNode
+	byName  map[string]*graphNode
+	outputs []*graphOutput
+	order   []*graphNode // nil until worked out and after every change
+	values  map[string]*tensor.Tensor
+	losses  map[string]float64
+}
+
+func NewGraphModel() *GraphModel {
+	return &GraphModel{byName: make(map[string]*graphNode)}
+}
+
+func (g *GraphModel) nameTaken(name string) bool {
+	if _, ok := g.byName[name]; ok {
+		return true
+	}
+	for _, in := range g.inputs {
+		if in == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Adds a named input fed through the map given to Forward
+func (g *GraphModel) AddInput(name string) error {
+	if g.nameTaken(name) {
+		return fmt.Errorf("graph: name %q is already used", name)
+	}
+	g.inputs = append(g.inputs, name)
+	g.order = nil
+	return nil
+}
+
+// Check if a and b are the same layer. Pointers to distinct zero size layers
+// may compare equal, those keep no state so they are never taken as the same
+func sameLayer(a, b any) bool {
+	ta := reflect.TypeOf(a)
+	if ta != reflect.TypeOf(b) || !ta.Comparable() {
+		return false
+	}
+	if ta.Kind() == reflect.Pointer && ta.Elem().Size() == 0 {
+		return false
+	}
+	return a == b
+}
+
+func (g *GraphModel) addNode(node *graphNode) error {
+	if g.nameTaken(node.name) {
+		return fmt.Errorf("graph: name %q is already used", node.name)
+	}
+	for _, other := range g.nodes {
+		if sameLayer(node.module(), other.module()) {
+			return fmt.Errorf("graph: node %q uses the layer of node %q, a layer keeps the state of its last forward so it cannot be shared", node.name, other.name)
+		}
+	}
+	g.nodes = append(g.nodes, node)
+	g.byName[node.name] = node
+	g.order = nil
+	return nil
+}
+
+// Adds a node applying layer to the input or node called input. Names may
+// refer to nodes added later, and layer must not be used by another node
+func (g *GraphModel) AddNode(name string, layer Layer, input string) error {
+	return g.addNode(&graphNode{name: name, layer: layer, inputs: []string{input}})
+}
+
+// Adds a node applying a multi input layer to the named inputs or nodes in
+// order, the layer must not be used by another node
+func (g *GraphModel) AddMergeNode(name string, layer MultiInputLayer, inputs ...string) error {
+	if len(inputs) == 0 {
+		return fmt.Errorf("graph: merge node %q needs at least one input", name)
+	}
+	return g.addNode(&graphNode{name: name, merge: layer, inputs: append([]string(nil), inputs...)})
+}
+
+// Marks node as a model output called name. loss may be nil for an output
+// that is only predicted, otherwise its loss counts with the given weight
+func (g *GraphModel) AddOutput(name string, node string, loss LossLayer, weight float64) error {
+	for _, out := range g.outputs {
+		if out.name == name {
+			return fmt.Errorf("graph: output %q is already used", name)
+		}
+	}
+	g.outputs = append(g.outputs, &graphOutput{name: name, node: node, loss: loss, weight: weight})
+	g.order = nil
+	return nil
+}
+
+// Works out the order nodes run in with Kahn's algorithm, ties keep the
+// order nodes were added in
+func (g *GraphModel) topologicalOrder() ([]*graphNode, error) {
+	if g.order != nil {
+		return g.order, nil
+	}
+	isInput := make(map[string]bool)
+	for _, in := range g.inputs {
+		isInput[in] = true
+	}
+	pending := make(map[string]int)
+	consumers := make(map[string][]*graphNode)
+	for _, node := range g.nodes {
+		for _, in := range node.inputs {
+			if !isInput[in] && g.byName[in] == nil {
+				return nil, fmt.Errorf("graph: node %q reads unknown input %q", node.name, in)
+			}
+			if !isInput[in] {
+				pending[node.name]++
+			}
+			consumers[in] = append(consumers[in], node)
+		}
+	}
+	for _, out := range g.outputs {
+		if !isInput[out.node] && g.byName[out.node] == nil {
+			return nil, fmt.Errorf("graph: output %q reads unknown node %q", out.name, out.node)
+		}
+	}
+
+	var ready []*graphNode
+	for _, node := range g.nodes {
+		if pending[node.name] == 0 {
+			ready = append(ready, node)
+		}
+	}
+	order := make([]*graphNode, 0, len(g.nodes))
+	for len(ready) > 0 {
+		node := ready[0]
+		ready = ready[1:]
+		order = append(order, node)
+		for _, next := range consumers[node.name] {
+			pending[next.name]--
+			if pending[next.name] == 0 {
+				ready = append(ready, next)
+			}
+		}
+	}
+	if len(order) != len(g.nodes) {
+		return nil, fmt.Errorf("graph: the nodes contain a cycle")
+	}
+	g.order = order
+	return order, nil
+}
+
+// Runs the model on the named inputs and gives the outputs by name
+func (g *GraphModel) Forward(inputs map[string]*tensor.Tensor) (map[string]*tensor.Tensor, error) {
+	order, err := g.topologicalOrder()
+	if err != nil {
+		return nil, err
+	}
+	g.values = make(map[string]*tensor.Tensor)
+	for _, name := range g.inputs {
+		x, ok := inputs[name]
+		if !ok {
+			return nil, fmt.Errorf("graph: missing input %q", name)
+		}
+		g.values[name] = x
+	}
+	for _, node := range order {
+		args := make([]*tensor.Tensor, len(node.inputs))
+		for i, in := range node.inputs {
+			args[i] = g.values[in]
+		}
+		var out *tensor.Tensor
+		if node.merge != nil {
+			out, err = node.merge.ForwardMulti(args)
+		} else {
+			out, err = node.layer.Forward(args[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("graph: node %q: %w", node.name, err)
+		}
+		g.values[node.name] = out
+	}
+	outputs := make(map[string]*tensor.Tensor)
+	for _, out := range g.outputs {
+		outputs[out.name] = g.values[out.node]
+	}
+	return outputs, nil
+}
+
+// Weighted sum of the losses of the last forward outputs against the targets
+// given by output name
+func (g *GraphModel) Loss(targets map[string]*tensor.Tensor) (float64, error) {
+	if g.values == nil {
+		return 0, fmt.Errorf("graph: loss called before forward")
+	}
+	g.losses = make(map[string]float64)
+	total := 0.0
+	for _, out := range g.outputs {
+		if out.loss == nil {
+			continue
+		}
+		target, ok := targets[out.name]
+		if !ok {
+			return 0, fmt.Errorf("graph: missing target for output %q", out.name)
+		}
+		loss, err := out.loss.Loss(g.values[out.node], target)
+		if err != nil {
+			return 0, fmt.Errorf("graph: output %q: %w", out.name, err)
+		}
+		g.losses[out.name] = loss
+		total += out.weight * loss
+	}
+	return total, nil
+}
+
+// Unweighted loss of every output from the last call to Loss
+func (g *GraphModel) Losses() map[string]float64 {
+	return g.losses
+}
+
+// Adds grad into the gradient collected for name
+func accumulateGrad(grads map[string]*tensor.Tensor, name string, grad *tensor.Tensor) error {
+	if prev, ok := grads[name]; ok {
+		sum, err := tensor.TensorAdd(prev, grad)
+		if err != nil {
+			return err
+		}
+		grads[name] = sum
+		return nil
+	}
+	grads[name] = grad
+	return nil
+}
+
+// Backpropagates the weighted losses from the last call to Loss through the
+// graph and gives the gradient of every input that reaches a loss
+func (g *GraphModel) Backward(lr float64) (map[string]*tensor.Tensor, error) {
+	if g.losses == nil {
+		return nil, fmt.Errorf("graph: backward called before loss")
+	}
+	grads := make(map[string]*tensor.Tensor)
+	for _, out := range g.outputs {
+		if out.loss == nil {
+			continue
+		}
+		diff, err := out.loss.Diffrential()
+		if err != nil {
+			return nil, err
+		}
+		if out.weight != 1 {
+			diff, err = diff.MulScalar(out.weight)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := accumulateGrad(grads, out.node, diff); err != nil {
+			return nil, err
+		}
+	}
+	return g.backward(grads, lr)
+}
+
+// Backpropagates the given output node gradients, keyed by output name, for
+// training against something other than the output losses
+func (g *GraphModel) BackwardWithGrads(outputGrads map[string]*tensor.Tensor, lr float64) (map[string]*tensor.Tensor, error) {
+	grads := make(map[string]*tensor.Tensor)
+	for _, out := range g.outputs {
+		if grad, ok := outputGrads[out.name]; ok {
+			if err := accumulateGrad(grads, out.node, grad); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return g.backward(grads, lr)
+}
+
+func (g *GraphModel) backward(grads map[string]*tensor.Tensor, lr float64) (map[string]*tensor.Tensor, error) {
+	if g.values == nil {
+		return nil, fmt.Errorf("graph: backward called before forward")
+	}
+	order, err := g.topologicalOrder()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(order) - 1; i >= 0; i-- {
+		node := order[i]
+		grad, ok := grads[node.name]
+		if !ok {
+			// nothing downstream reaches a loss, so the parameters get a zero
+			// gradient instead of keeping the one from an earlier backward
+			if err := node.zeroGrads(); err != nil {
+				return nil, fmt.Errorf("graph: node %q: %w", node.name, err)
+			}
+			continue
+		}
+		var inGrads []*tensor.Tensor
+		if node.merge != nil {
+			inGrads, err = node.merge.BackwardMulti(grad, lr)
+		} else {
+			var dx *tensor.Tensor
+			dx, err = node.layer.Backward(grad, lr)
+			inGrads = []*tensor.Tensor{dx}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("graph: node %q: %w", node.name, err)
+		}
+		if len(inGrads) != len(node.inputs) {
+			return nil, fmt.Errorf("graph: node %q gave %d gradients for %d inputs", node.name, len(inGrads), len(node.inputs))
+		}
+		for j, in := range node.inputs {
+			if err := accumulateGrad(grads, in, inGrads[j]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	inputGrads := make(map[string]*tensor.Tensor)
+	for _, name := range g.inputs {
+		if grad, ok := grads[name]; ok {
+			inputGrads[name] = grad
+		}
+	}
+	return inputGrads, nil
+}
+
+// Sets the mode of every layer
+func (g *GraphModel) SetTraining(training bool) {
+	for _, node := range g.nodes {
+		if node.layer != nil {
+			SetTraining(node.layer, training)
+		} else if m, ok := node.merge.(ModeLayer); ok {
+			m.SetTraining(training)
+		}
+	}
+}
+
+// Puts every layer in training mode
+func (g *GraphModel) Train() {
+	g.SetTraining(true)
+}
+
+// Puts every layer in eval mode so running statistics are used
+func (g *GraphModel) Eval() {
+	g.SetTraining(false)
+}
+
+// Parameters of every node in the order the nodes were added
+func (g *GraphModel) GetParameters() []*Parameter {
+	params := []*Parameter{}
+	for _, node := range g.nodes {
+		params = append(params, node.parameters()...)
+	}
+	return params
+}
+
+func (g *GraphModel) GetWeights() []*tensor.Tensor {
+	var weights []*tensor.Tensor
+	for _, node := range g.nodes {
+		if node.layer != nil {
+			weights = append(weights, node.layer.GetWeights()...)
+		} else {
+			weights = append(weights, node.merge.GetWeights()...)
+		}
+	}
+	return weights
+}
+
+func (g *GraphModel) GetBiases() []*tensor.Tensor {
+	var biases []*tensor.Tensor
+	for _, node := range g.nodes {
+		if node.layer != nil {
+			biases = append(biases, node.layer.GetBiases()...)
+		} else {
+			biases = append(biases, node.merge.GetBiases()...)
+		}
+	}
+	return biases
+}
+
+func (g *GraphModel) GetBuffers() []*tensor.Tensor {
+	var buffers []*tensor.Tensor
+	for _, node := range g.nodes {
+		if b, ok := node.layer.(BufferLayer); ok {
+			buffers = append(buffers, b.GetBuffers()...)
+		}
+	}
+	return buffers
+}
+
+// Merge layer giving the elementwise sum of its inputs, which broadcast together
+type AddMergeLayer struct {
+	shapes [][]int
+}
+
+func NewAddMergeLayer() *AddMergeLayer {
+	return &AddMergeLayer{}
+}
+
+func (a *AddMergeLayer) ForwardMulti(inputs []*tensor.Tensor) (*tensor.Tensor, error) {
+	a.shapes = make([][]int, len(inputs))
+	sum := inputs[0]
+	a.shapes[0] = inputs[0].Shape()
+	var err error
+	for i, x := range inputs[1:] {
+		a.shapes[i+1] = x.Shape()
+		sum, err = tensor.TensorAdd(sum, x)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sum, nil
+}
+
+// Every input gets the gradient summed back to its own shape
+func (a *AddMergeLayer) BackwardMulti(gradOutput *tensor.Tensor, lr float64) ([]*tensor.Tensor, error) {
+	if a.shapes == nil {
+		return nil, fmt.Errorf("addMerge: backward called before forward")
+	}
+	grads := make([]*tensor.Tensor, len(a.shapes))
+	for i, shape := range a.shapes {
+		grad, err := gradOutput.SumTo(shape...)
+		if err != nil {
+			return nil, err
+		}
+		grads[i] = grad
+	}
+	return grads, nil
+}
+
+func (a *AddMergeLayer) GetParameters() []*Parameter {
+	return []*Parameter{}
+}
+
+func (a *AddMergeLayer) GetWeights() []*tensor.Tensor {
+	return nil
+}
+
+func (a *AddMergeLayer) GetBiases() []*tensor.Tensor {
+	return nil
+}
+
+// Merge layer giving the elementwise product of its inputs, which broadcast together
+type MultiplyMergeLayer struct {
+	inputs []*tensor.Tensor
+}
+
+func NewMultiplyMergeLayer() *MultiplyMergeLayer {
+	return &MultiplyMergeLayer{}
+}
+
+func (m *MultiplyMergeLayer) ForwardMulti(inputs []*tensor.Tensor) (*tensor.Tensor, error) {
+	m.inputs = inputs
+	prod := inputs[0]
+	var err error
+	for _, x := range inputs[1:] {
+		prod, err = tensor.TensorMul(prod, x)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return prod, nil
+}
+
+// The gradient of an input is the output gradient times every other input
+func (m *MultiplyMergeLayer) BackwardMulti(gradOutput *tensor.Tensor, lr float64) ([]*tensor.Tensor, error) {
+	if m.inputs == nil {
+		return nil, fmt.Errorf("multiplyMerge: backward called before forward")
+	}
+	grads := make([]*tensor.Tensor, len(m.inputs))
+	for i, x := range m.inputs {
+		grad := gradOutput
+		var err error
+		for j, other := range m.inputs {
+			if j == i {
+				continue
+			}
+			grad, err = tensor.TensorMul(grad, other)
+			if err != nil {
+				return nil, err
+			}
+		}
+		grads[i], err = grad.SumTo(x.Shape()...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return grads, nil
+}
+
+func (m *MultiplyMergeLayer) GetParameters() []*Parameter {
+	return []*Parameter{}
+}
+
+func (m *MultiplyMergeLayer) GetWeights() []*tensor.Tensor {
+	return nil
+}
+
+func (m *MultiplyMergeLayer) GetBiases() []*tensor.Tensor {
+	return nil
+}
+
+// Merge layer joining its inputs along Axis
+type ConcatMergeLayer struct {
+	Axis  int
+	sizes []int
+}
+
+func NewConcatMergeLayer(axis int) *ConcatMergeLayer {
+	return &ConcatMergeLayer{Axis: axis}
+}
+
+func (c *ConcatMergeLayer) ForwardMulti(inputs []*tensor.Tensor) (*tensor.Tensor, error) {
+	out, err := tensor.Concat(c.Axis, inputs...)
+	if err != nil {
+		return nil, err
+	}
+	axis := c.Axis
+	if axis < 0 {
+		axis += len(out.Shape())
+	}
+	c.sizes = make([]int, len(inputs))
+	for i, x := range inputs {
+		c.sizes[i] = x.Shape()[axis]
+	}
+	return out, nil
+}
+
+// Every input gets its part of the gradient along Axis
+func (c *ConcatMergeLayer) BackwardMulti(gradOutput *tensor.Tensor, lr float64) ([]*tensor.Tensor, error) {
+	if c.sizes == nil {
+		return nil, fmt.Errorf("concatMerge: backward called before forward")
+	}
+	grads := make([]*tensor.Tensor, len(c.sizes))
+	start := 0
+	for i, size := range c.sizes {
+		part, err := gradOutput.Narrow(c.Axis, start, size)
+		if err != nil {
+			return nil, err
+		}
+		grads[i] = part
+		start += size
+	}
+	return grads, nil
+}
+
+func (c *ConcatMergeLayer) GetParameters() []*Parameter {
+	return []*Parameter{}
+}
+
+func (c *ConcatMergeLayer) GetWeights() []*tensor.Tensor {
+	return nil
+}
+
+func (c *ConcatMergeLayer) GetBiases() []*tensor.Tensor {
+	return nil
+}
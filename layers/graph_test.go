@@ -0,0 +1,192 @@
+package layers_test
+
+import (
+	"math"
+	"nnscratch/layers"
+	"nnscratch/tensor"
+	"testing"
+)
+
+// Two inputs, two branches merged twice and two weighted losses, with a
+// node referring to ones added after it
+func newTestGraph(t *testing.T) *layers.GraphModel {
+	t.Helper()
+	g := layers.NewGraphModel()
+	for _, err := range []error{
+		g.AddInput("a"),
+		g.AddInput("b"),
+		g.AddMergeNode("concat", layers.NewConcatMergeLayer(1), "ha", "hb"),
+		g.AddNode("ha", layers.NewDenseLayer(3, 4), "a"),
+		g.AddNode("hb", layers.NewSequential(layers.NewDenseLayer(2, 4), &layers.TanhLayer{}), "b"),
+		g.AddMergeNode("product", layers.NewMultiplyMergeLayer(), "ha", "hb"),
+		g.AddMergeNode("sum", layers.NewAddMergeLayer(), "concat", "concat"),
+		g.AddNode("head1", layers.NewDenseLayer(8, 1), "sum"),
+		g.AddNode("head2", layers.NewDenseLayer(4, 2), "product"),
+		g.AddOutput("regression", "head1", &layers.MSELossLayer{}, 0.5),
+		g.AddOutput("aux", "head2", &layers.MSELossLayer{}, 2),
+		g.AddOutput("hidden", "hb", nil, 0),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range g.GetParameters() {
+		p.Value, _ = p.Value.MulScalar(80)
+	}
+	return g
+}
+
+func TestGraphGradients(t *testing.T) {
+	g := newTestGraph(t)
+	a := randomInput(t, 4, 3)
+	b := randomInput(t, 4, 2)
+	inputs := map[string]*tensor.Tensor{"a": a, "b": b}
+	y1, _ := tensor.NewTensorInput([][]float64{{0.1}, {-0.2}, {0.3}, {0}})
+	y2, _ := tensor.NewTensorInput([][]float64{{1, 0}, {0, 1}, {-1, 0}, {0, -1}})
+	targets := map[string]*tensor.Tensor{"regression": y1, "aux": y2}
+	loss := func() float64 {
+		t.Helper()
+		if _, err := g.Forward(inputs); err != nil {
+			t.Fatal(err)
+		}
+		l, err := g.Loss(targets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return l
+	}
+
+	loss()
+	grads, err := g.Backward(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// central differences of the total loss for every value of x
+	check := func(name string, x, analytic *tensor.Tensor) {
+		t.Helper()
+		const eps = 1e-6
+		for i, v := range x.Data() {
+			x.Data()[i] = v + eps
+			plus := loss()
+			x.Data()[i] = v - eps
+			minus := loss()
+			x.Data()[i] = v
+			numeric := (plus - minus) / (2 * eps)
+			if math.Abs(numeric-analytic.Data()[i]) > 1e-6*(1+math.Abs(numeric)) {
+				t.Errorf("%s[%d] gradient %v, finite differences give %v", name, i, analytic.Data()[i], numeric)
+			}
+		}
+	}
+	params := g.GetParameters()
+	paramGrads := make([]*tensor.Tensor, len(params))
+	for i, p := range params {
+		p.Value = p.Value.Contiguous()
+		paramGrads[i] = p.Grad.Contiguous().Copy()
+	}
+	check("a", a, grads["a"].Contiguous().Copy())
+	check("b", b, grads["b"].Contiguous().Copy())
+	for i, p := range params {
+		check("parameter", p.Value, paramGrads[i])
+	}
+}
+
+func TestGraphRejectsCycles(t *testing.T) {
+	g := layers.NewGraphModel()
+	g.AddInput("x")
+	g.AddNode("p", &layers.TanhLayer{}, "q")
+	g.AddNode("q", &layers.TanhLayer{}, "p")
+	x, _ := tensor.NewTensorOnes(2, 2)
+	if _, err := g.Forward(map[string]*tensor.Tensor{"x": x}); err == nil {
+		t.Error("a graph with a cycle ran")
+	}
+}
+
+func TestGraphClearsUnreachedGradients(t *testing.T) {
+	g := newTestGraph(t)
+	inputs := map[string]*tensor.Tensor{"a": randomInput(t, 4, 3), "b": randomInput(t, 4, 2)}
+	outputs, err := g.Forward(inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ones := func(x *tensor.Tensor) *tensor.Tensor {
+		o, _ := tensor.NewTensorOnes(x.Shape()...)
+		return o
+	}
+	all := map[string]*tensor.Tensor{"regression": ones(outputs["regression"]), "aux": ones(outputs["aux"])}
+	if _, err := g.BackwardWithGrads(all, 0); err != nil {
+		t.Fatal(err)
+	}
+	// head2 only feeds aux, so once aux gets no gradient its parameters must
+	// not keep the gradient of the first backward
+	only := map[string]*tensor.Tensor{"regression": all["regression"]}
+	if _, err := g.BackwardWithGrads(only, 0); err != nil {
+		t.Fatal(err)
+	}
+	params := g.GetParameters()
+	// ha, hb and head1 come first with two parameters each, head2 is last
+	for _, p := range params[len(params)-2:] {
+		for _, v := range p.Grad.Data() {
+			if v != 0 {
+				t.Fatalf("unreached parameter kept gradient %v", p.Grad.Data())
+			}
+		}
+	}
+}
+
+func TestGraphForward(t *testing.T) {
+	g := layers.NewGraphModel()
+	for _, err := range []error{
+		g.AddInput("a"),
+		g.AddInput("b"),
+		g.AddMergeNode("sum", layers.NewAddMergeLayer(), "a", "b"),
+		g.AddMergeNode("product", layers.NewMultiplyMergeLayer(), "a", "b"),
+		g.AddMergeNode("both", layers.NewConcatMergeLayer(1), "sum", "product"),
+		g.AddOutput("out", "both", nil, 0),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// b is (1, 2) and broadcasts over the rows of a
+	a := tensorOf(t, []float64{1, 2, 3, 4}, 2, 2)
+	b := tensorOf(t, []float64{10, -1}, 1, 2)
+	outputs, err := g.Forward(map[string]*tensor.Tensor{"a": a, "b": b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectValues(t, outputs["out"], []int{2, 4}, []float64{11, 1, 10, -2, 13, 3, 30, -4})
+
+	grads, err := g.BackwardWithGrads(map[string]*tensor.Tensor{"out": tensorOf(t, []float64{1, 1, 1, 1, 1, 1, 1, 1}, 2, 4)}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// d/da = 1 + b and d/db sums 1 + a over the rows
+	expectValues(t, grads["a"], []int{2, 2}, []float64{11, 0, 11, 0})
+	expectValues(t, grads["b"], []int{1, 2}, []float64{6, 8})
+}
+
+func TestGraphRejectsSharedLayers(t *testing.T) {
+	dense := layers.NewDenseLayer(2, 2)
+	merge := layers.NewAddMergeLayer()
+	g := layers.NewGraphModel()
+	g.AddInput("x")
+	if err := g.AddNode("first", dense, "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.AddNode("second", dense, "first"); err == nil {
+		t.Error("a layer was used by two nodes")
+	}
+	if err := g.AddMergeNode("sum", merge, "x", "first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.AddMergeNode("again", merge, "x", "sum"); err == nil {
+		t.Error("a merge layer was used by two nodes")
+	}
+	// separate layers of the same kind are fine
+	if err := g.AddNode("tanh1", &layers.TanhLayer{}, "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.AddNode("tanh2", &layers.TanhLayer{}, "tanh1"); err != nil {
+		t.Fatal(err)
+	}
+}
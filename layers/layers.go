@@ -17,6 +17,19 @@ type Layer interface {
 	GetBiases() []*tensor.Tensor
 }
 
+// Layers that behave differently while training, like batch norm. Layers
+// start in training mode
+type ModeLayer interface {
+	SetTraining(training bool)
+}
+
+// Puts a layer in training or eval mode, layers without a mode are left alone
+func SetTraining(l Layer, training bool) {
+	if m, ok := l.(ModeLayer); ok {
+		m.SetTraining(training)
+	}
+}
+
 type Sequential struct {
 	Layers    []Layer
 	LossLayer LossLayer
@@ -40,15 +53,33 @@ func (s *Sequential) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
 	return out, nil
 }
 
-func (s *Sequential) Backward(grad *tensor.Tensor, lr float64) error {
+// Backpropagates through the layers in reverse and gives the input gradient
+func (s *Sequential) Backward(grad *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
 	var err error
 	for i := len(s.Layers) - 1; i >= 0; i-- {
 		grad, err = s.Layers[i].Backward(grad, lr)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
-	return nil
+	return grad, nil
+}
+
+// Sets the mode of every layer
+func (s *Sequential) SetTraining(training bool) {
+	for _, layer := range s.Layers {
+		SetTraining(layer, training)
+	}
+}
+
+// Puts every layer in training mode
+func (s *Sequential) Train() {
+	s.SetTraining(true)
+}
+
+// Puts every layer in eval mode so running statistics are used
+func (s *Sequential) Eval() {
+	s.SetTraining(false)
 }
 
 func (s *Sequential) GetParameters() []*Parameter {
@@ -73,4 +104,8 @@ func (s *Sequential) GetBiases() []*tensor.Tensor {
 		biases = append(biases, layer.GetBiases()...)
 	}
 	return biases
-}
\ No newline at end of file
+}
+
+func (s *Sequential) GetBuffers() []*tensor.Tensor {
+	return collectBuffers(s.Layers)
+}
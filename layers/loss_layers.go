@@ -1,6 +1,8 @@
 package layers 
 
 import (
+	"fmt"
+	"math"
 	"nnscratch/tensor"
 	"nnscratch/loss"
 )
@@ -36,6 +38,7 @@ func (l *MSELossLayer) Diffrential() (*tensor.Tensor, error) {
 
 
 // BCE loss layer should always have a sigmoid function before it to make sure the input is less than 1
+// Like every loss layer it takes the prediction first and Diffrential is with respect to it
 type BCELossLayer struct {
 	y_pred   *tensor.Tensor
 	y_actual *tensor.Tensor
@@ -44,7 +47,7 @@ type BCELossLayer struct {
 func (l *BCELossLayer) Loss(y_pred *tensor.Tensor, y_actual *tensor.Tensor) (float64, error) {
 	l.y_actual = y_actual
 	l.y_pred = y_pred
-	res, err := loss.BCE(y_pred, y_actual)
+	res, err := loss.BCE(y_actual, y_pred)
 	if err != nil {
 		return 0, err
 	}
@@ -52,9 +55,169 @@ func (l *BCELossLayer) Loss(y_pred *tensor.Tensor, y_actual *tensor.Tensor) (flo
 }
 
 func (l *BCELossLayer) Diffrential() (*tensor.Tensor, error) {
-	res, err := loss.DiffBCE(l.y_pred, l.y_actual)
+	res, err := loss.DiffBCE(l.y_actual, l.y_pred)
 	if err != nil {
 		return nil, err
 	}
 	return res, nil
-}
\ No newline at end of file
+}
+
+// Cross entropy on raw scores (logits) of shape (batch, classes, ...) with the
+// softmax fused in, so Diffrential is simply softmax - target. The target is
+// either class indices shaped like the logits without the class axis, or
+// probabilities (one-hot or soft) shaped like the logits.
+// ClassWeights scales each class, when HasIgnoreIndex is set targets equal to
+// IgnoreIndex are left out and LabelSmoothing mixes the target with the
+// uniform distribution
+type CrossEntropyLossLayer struct {
+	ClassWeights   []float64
+	HasIgnoreIndex bool
+	IgnoreIndex    int
+	LabelSmoothing float64
+	y_pred         *tensor.Tensor
+	grad           *tensor.Tensor
+}
+
+// Ignores targets of -100 like PyTorch does, padding gets that class
+func NewCrossEntropyLossLayer() *CrossEntropyLossLayer {
+	return &CrossEntropyLossLayer{HasIgnoreIndex: true, IgnoreIndex: -100}
+}
+
+func (l *CrossEntropyLossLayer) Loss(y_pred *tensor.Tensor, y_actual *tensor.Tensor) (float64, error) {
+	shape := y_pred.Shape()
+	if len(shape) < 2 {
+		return 0, fmt.Errorf("crossEntropy: expected logits (batch, classes, ...) got %v", shape)
+	}
+	classes := shape[1]
+	if l.ClassWeights != nil && len(l.ClassWeights) != classes {
+		return 0, fmt.Errorf("crossEntropy: %d class weights for %d classes", len(l.ClassWeights), classes)
+	}
+	if l.LabelSmoothing < 0 || l.LabelSmoothing > 1 {
+		return 0, fmt.Errorf("crossEntropy: label smoothing must be in [0, 1] got %v", l.LabelSmoothing)
+	}
+
+	// move the class axis last so every row holds the scores of one prediction
+	perm := classLast(len(shape))
+	logits, err := y_pred.Permute(perm...)
+	if err != nil {
+		return 0, err
+	}
+	logp, err := logits.LogSumExp(true, -1)
+	if err != nil {
+		return 0, err
+	}
+	logp, err = tensor.TensorDiff(logits, logp)
+	if err != nil {
+		return 0, err
+	}
+	logpData := logp.Data()
+	rows := len(logpData) / classes
+
+	// coeff holds how much of -log p of each class goes into the loss
+	coeff := make([]float64, len(logpData))
+	norm := 0.0
+	eps := l.LabelSmoothing
+	switch {
+	case tensor.ShapesMatch(y_pred, y_actual):
+		target, err := y_actual.Permute(perm...)
+		if err != nil {
+			return 0, err
+		}
+		for i, t := range target.Values() {
+			coeff[i] = l.weight(i%classes) * ((1-eps)*t + eps/float64(classes))
+		}
+		norm = float64(rows)
+	case y_actual.Len() == rows && classTargetShape(shape, y_actual.Shape()):
+		for r, t := range y_actual.Values() {
+			class := int(math.Round(t))
+			if l.HasIgnoreIndex && class == l.IgnoreIndex {
+				continue
+			}
+			if class < 0 || class >= classes {
+				return 0, fmt.Errorf("crossEntropy: target class %d out of range for %d classes", class, classes)
+			}
+			row := coeff[r*classes : (r+1)*classes]
+			for c := range row {
+				row[c] = eps / float64(classes) * l.weight(c)
+			}
+			row[class] += (1 - eps) * l.weight(class)
+			norm += l.weight(class)
+		}
+	default:
+		return 0, fmt.Errorf("crossEntropy: target shape %v does not fit logits %v", y_actual.Shape(), shape)
+	}
+
+	loss := 0.0
+	grad, _ := tensor.NewTensor(logp.Shape()...)
+	gradData := grad.Data()
+	if norm > 0 {
+		for r := 0; r < rows; r++ {
+			row := coeff[r*classes : (r+1)*classes]
+			total := 0.0
+			for c, q := range row {
+				loss -= q * logpData[r*classes+c]
+				total += q
+			}
+			// d(-sum q log softmax)/dz = total * softmax - q
+			for c, q := range row {
+				gradData[r*classes+c] = (total*math.Exp(logpData[r*classes+c]) - q) / norm
+			}
+		}
+		loss /= norm
+	}
+
+	// put the class axis back where it came from
+	inverse := make([]int, len(perm))
+	for i, p := range perm {
+		inverse[p] = i
+	}
+	grad, err = grad.Permute(inverse...)
+	if err != nil {
+		return 0, err
+	}
+	l.y_pred = y_pred
+	l.grad = grad.Contiguous()
+	return loss, nil
+}
+
+func (l *CrossEntropyLossLayer) Diffrential() (*tensor.Tensor, error) {
+	if l.grad == nil {
+		return nil, fmt.Errorf("crossEntropy: diffrential called before loss")
+	}
+	return l.grad, nil
+}
+
+// Weight of a class, 1 when no weights are set
+func (l *CrossEntropyLossLayer) weight(class int) float64 {
+	if l.ClassWeights == nil {
+		return 1
+	}
+	return l.ClassWeights[class]
+}
+
+// Gives the permutation moving axis 1 to the end (N, C, d1, d2) -> (N, d1, d2, C)
+func classLast(rank int) []int {
+	perm := []int{0}
+	for i := 2; i < rank; i++ {
+		perm = append(perm, i)
+	}
+	return append(perm, 1)
+}
+
+// Check if target is the logits shape without the class axis, (N) or (N, 1)
+// are taken for (N, C) logits
+func classTargetShape(logits []int, target []int) bool {
+	want := append([]int{logits[0]}, logits[2:]...)
+	if len(logits) == 2 && len(target) == 2 && target[1] == 1 {
+		return target[0] == logits[0]
+	}
+	if len(want) != len(target) {
+		return false
+	}
+	for i := range want {
+		if want[i] != target[i] {
+			return false
+		}
+	}
+	return true
+}
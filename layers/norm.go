@@ -0,0 +1,409 @@
+package layers
+
+import (
+	"fmt"
+	"math"
+	"nnscratch/tensor"
+)
+
+// Normalization over features rather than the batch. The input is seen as
+// contiguous rows, every row is normalized on its own and the optional affine
+// parameters are looked up per element through an index function.
+
+// Normalizes every row of x to zero mean (when centered) and unit variance,
+// giving the normalized values and the inverse deviation of every row
+func normalizeRows(x []float64, rowLen int, center bool, eps float64) ([]float64, []float64) {
+	rows := len(x) / rowLen
+	xhat := make([]float64, len(x))
+	invstd := make([]float64, rows)
+	for r := 0; r < rows; r++ {
+		row := x[r*rowLen : (r+1)*rowLen]
+		var mean float64
+		if center {
+			for _, v := range row {
+				mean += v
+			}
+			mean /= float64(rowLen)
+		}
+		var variance float64
+		for _, v := range row {
+			variance += (v - mean) * (v - mean)
+		}
+		variance /= float64(rowLen)
+		inv := 1 / math.Sqrt(variance+eps)
+		invstd[r] = inv
+		for i, v := range row {
+			xhat[r*rowLen+i] = (v - mean) * inv
+		}
+	}
+	return xhat, invstd
+}
+
+// Gradient of normalizeRows. With centering
+// dx = invstd / d * (d * dxhat - sum(dxhat) - xhat * sum(dxhat * xhat)),
+// without it dx = invstd * (dxhat - xhat * sum(dxhat * xhat) / d)
+func normalizeRowsBackward(dxhat, xhat, invstd []float64, rowLen int, center bool) []float64 {
+	d := float64(rowLen)
+	dx := make([]float64, len(dxhat))
+	for r := range invstd {
+		start := r * rowLen
+		var sum, dot float64
+		for i := start; i < start+rowLen; i++ {
+			sum += dxhat[i]
+			dot += dxhat[i] * xhat[i]
+		}
+		if !center {
+			sum = 0
+		}
+		for i := start; i < start+rowLen; i++ {
+			dx[i] = invstd[r] / d * (d*dxhat[i] - sum - xhat[i]*dot)
+		}
+	}
+	return dx
+}
+
+// out = xhat * gamma + beta with both looked up through index, either may be nil
+func applyAffine(xhat []float64, gamma, beta *Parameter, index func(int) int) []float64 {
+	out := make([]float64, len(xhat))
+	copy(out, xhat)
+	if gamma != nil {
+		gd := gamma.Value.Contiguous().Data()
+		for i := range out {
+			out[i] *= gd[index(i)]
+		}
+	}
+	if beta != nil {
+		bd := beta.Value.Contiguous().Data()
+		for i := range out {
+			out[i] += bd[index(i)]
+		}
+	}
+	return out
+}
+
+// Sets the gamma and beta grads and gives the gradient of xhat
+func affineBackward(grad, xhat []float64, gamma, beta *Parameter, index func(int) int) ([]float64, error) {
+	if gamma == nil && beta == nil {
+		return grad, nil
+	}
+	dxhat := make([]float64, len(grad))
+	copy(dxhat, grad)
+	if gamma != nil {
+		gd := gamma.Value.Contiguous().Data()
+		dgamma := make([]float64, len(gd))
+		for i, g := range grad {
+			k := index(i)
+			dgamma[k] += g * xhat[i]
+			dxhat[i] = g * gd[k]
+		}
+		var err error
+		gamma.Grad, err = tensorFrom(dgamma, gamma.Value.Shape()...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if beta != nil {
+		dbeta := make([]float64, beta.Value.Len())
+		for i, g := range grad {
+			dbeta[index(i)] += g
+		}
+		var err error
+		beta.Grad, err = tensorFrom(dbeta, beta.Value.Shape()...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dxhat, nil
+}
+
+// Gives a parameter of the given shape filled with value
+func filledParameter(value float64, shape ...int) (*Parameter, error) {
+	v, err := tensor.NewTensor(shape...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range v.Data() {
+		v.Data()[i] = value
+	}
+	grad, _ := tensor.NewTensor(shape...)
+	return &Parameter{Value: v, Grad: grad}, nil
+}
+
+// Gives the gamma and beta of an affine norm, starting at 1 and 0
+func affineParameters(shape ...int) (*Parameter, *Parameter, error) {
+	gamma, err := filledParameter(1, shape...)
+	if err != nil {
+		return nil, nil, err
+	}
+	beta, err := filledParameter(0, shape...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return gamma, beta, nil
+}
+
+// Check the normalized shape of a norm layer has dimensions and all of them
+// are positive
+func checkNormalizedShape(name string, shape []int) error {
+	if len(shape) == 0 {
+		return fmt.Errorf("%s: the normalized shape cannot be empty", name)
+	}
+	for _, d := range shape {
+		if d <= 0 {
+			return fmt.Errorf("%s: dimensions of the normalized shape must be positive got %v", name, shape)
+		}
+	}
+	return nil
+}
+
+// Check the trailing dimensions of shape against normalized and give their size
+func trailingSize(name string, shape, normalized []int) (int, error) {
+	if len(shape) < len(normalized) || !listEqual(shape[len(shape)-len(normalized):], normalized) {
+		return 0, fmt.Errorf("%s: input %v does not end with the normalized shape %v", name, shape, normalized)
+	}
+	size := 1
+	for _, d := range normalized {
+		size *= d
+	}
+	return size, nil
+}
+
+// Layer normalization over the trailing NormalizedShape dimensions of the input
+type LayerNormLayer struct {
+	NormalizedShape []int
+	Gamma           *Parameter // NormalizedShape, nil when not affine
+	Beta            *Parameter // NormalizedShape, nil when not affine
+	Eps             float64
+	shape           []int
+	xhat            []float64
+	invstd          []float64
+}
+
+func NewLayerNormLayer(affine bool, normalizedShape ...int) (*LayerNormLayer, error) {
+	if err := checkNormalizedShape("layernorm", normalizedShape); err != nil {
+		return nil, err
+	}
+	l := &LayerNormLayer{
+		NormalizedShape: append([]int(nil), normalizedShape...),
+		Eps:             1e-5,
+	}
+	if affine {
+		var err error
+		l.Gamma, l.Beta, err = affineParameters(normalizedShape...)
+		if err != nil {
+			return nil, fmt.Errorf("layernorm: %w", err)
+		}
+	}
+	return l, nil
+}
+
+func (l *LayerNormLayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	d, err := trailingSize("layernorm", input.Shape(), l.NormalizedShape)
+	if err != nil {
+		return nil, err
+	}
+	l.shape = input.Shape()
+	l.xhat, l.invstd = normalizeRows(input.Contiguous().Data(), d, true, l.Eps)
+	index := func(i int) int { return i % d }
+	return tensorFrom(applyAffine(l.xhat, l.Gamma, l.Beta, index), l.shape...)
+}
+
+func (l *LayerNormLayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	if l.xhat == nil {
+		return nil, fmt.Errorf("layernorm: backward called before forward")
+	}
+	if !listEqual(gradOutput.Shape(), l.shape) {
+		return nil, fmt.Errorf("layernorm: gradient shape %v does not match output %v", gradOutput.Shape(), l.shape)
+	}
+	d := len(l.xhat) / len(l.invstd)
+	index := func(i int) int { return i % d }
+	dxhat, err := affineBackward(gradOutput.Contiguous().Data(), l.xhat, l.Gamma, l.Beta, index)
+	if err != nil {
+		return nil, err
+	}
+	return tensorFrom(normalizeRowsBackward(dxhat, l.xhat, l.invstd, d, true), l.shape...)
+}
+
+func (l *LayerNormLayer) GetParameters() []*Parameter {
+	if l.Gamma == nil {
+		return []*Parameter{}
+	}
+	return []*Parameter{l.Gamma, l.Beta}
+}
+
+func (l *LayerNormLayer) GetWeights() []*tensor.Tensor {
+	if l.Gamma == nil {
+		return nil
+	}
+	return []*tensor.Tensor{l.Gamma.Value}
+}
+
+func (l *LayerNormLayer) GetBiases() []*tensor.Tensor {
+	if l.Beta == nil {
+		return nil
+	}
+	return []*tensor.Tensor{l.Beta.Value}
+}
+
+// Group normalization over (batch, channels, ...) inputs. The channels are
+// split into NumGroups groups and every group of a sample is normalized
+// together with all of its trailing positions
+type GroupNormLayer struct {
+	NumGroups   int
+	NumChannels int
+	Gamma       *Parameter // (channels), nil when not affine
+	Beta        *Parameter // (channels), nil when not affine
+	Eps         float64
+	shape       []int
+	xhat        []float64
+	invstd      []float64
+}
+
+func NewGroupNormLayer(numGroups, numChannels int, affine bool) (*GroupNormLayer, error) {
+	if numGroups <= 0 || numChannels <= 0 || numChannels%numGroups != 0 {
+		return nil, fmt.Errorf("groupnorm: %d channels must be positive and divisible by %d groups", numChannels, numGroups)
+	}
+	l := &GroupNormLayer{
+		NumGroups:   numGroups,
+		NumChannels: numChannels,
+		Eps:         1e-5,
+	}
+	if affine {
+		var err error
+		l.Gamma, l.Beta, err = affineParameters(numChannels)
+		if err != nil {
+			return nil, fmt.Errorf("groupnorm: %w", err)
+		}
+	}
+	return l, nil
+}
+
+// Maps an element of a contiguous input of the given shape to its channel
+func (l *GroupNormLayer) channelIndex(shape []int) func(int) int {
+	spatial := 1
+	for _, d := range shape[2:] {
+		spatial *= d
+	}
+	return func(i int) int { return i / spatial % l.NumChannels }
+}
+
+func (l *GroupNormLayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	shape := input.Shape()
+	if len(shape) < 2 || shape[1] != l.NumChannels {
+		return nil, fmt.Errorf("groupnorm: expected input (batch, %d, ...) got %v", l.NumChannels, shape)
+	}
+	l.shape = shape
+	rowLen := input.Len() / (shape[0] * l.NumGroups)
+	l.xhat, l.invstd = normalizeRows(input.Contiguous().Data(), rowLen, true, l.Eps)
+	return tensorFrom(applyAffine(l.xhat, l.Gamma, l.Beta, l.channelIndex(shape)), shape...)
+}
+
+func (l *GroupNormLayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	if l.xhat == nil {
+		return nil, fmt.Errorf("groupnorm: backward called before forward")
+	}
+	if !listEqual(gradOutput.Shape(), l.shape) {
+		return nil, fmt.Errorf("groupnorm: gradient shape %v does not match output %v", gradOutput.Shape(), l.shape)
+	}
+	dxhat, err := affineBackward(gradOutput.Contiguous().Data(), l.xhat, l.Gamma, l.Beta, l.channelIndex(l.shape))
+	if err != nil {
+		return nil, err
+	}
+	rowLen := len(l.xhat) / len(l.invstd)
+	return tensorFrom(normalizeRowsBackward(dxhat, l.xhat, l.invstd, rowLen, true), l.shape...)
+}
+
+func (l *GroupNormLayer) GetParameters() []*Parameter {
+	if l.Gamma == nil {
+		return []*Parameter{}
+	}
+	return []*Parameter{l.Gamma, l.Beta}
+}
+
+func (l *GroupNormLayer) GetWeights() []*tensor.Tensor {
+	if l.Gamma == nil {
+		return nil
+	}
+	return []*tensor.Tensor{l.Gamma.Value}
+}
+
+func (l *GroupNormLayer) GetBiases() []*tensor.Tensor {
+	if l.Beta == nil {
+		return nil
+	}
+	return []*tensor.Tensor{l.Beta.Value}
+}
+
+// Root mean square normalization over the trailing NormalizedShape
+// dimensions, x / sqrt(mean(x^2) + eps) without centering or a bias
+type RMSNormLayer struct {
+	NormalizedShape []int
+	Gamma           *Parameter // NormalizedShape, nil when not affine
+	Eps             float64
+	shape           []int
+	xhat            []float64
+	invstd          []float64
+}
+
+func NewRMSNormLayer(affine bool, normalizedShape ...int) (*RMSNormLayer, error) {
+	if err := checkNormalizedShape("rmsnorm", normalizedShape); err != nil {
+		return nil, err
+	}
+	l := &RMSNormLayer{
+		NormalizedShape: append([]int(nil), normalizedShape...),
+		Eps:             1e-6,
+	}
+	if affine {
+		var err error
+		l.Gamma, err = filledParameter(1, normalizedShape...)
+		if err != nil {
+			return nil, fmt.Errorf("rmsnorm: %w", err)
+		}
+	}
+	return l, nil
+}
+
+func (l *RMSNormLayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	d, err := trailingSize("rmsnorm", input.Shape(), l.NormalizedShape)
+	if err != nil {
+		return nil, err
+	}
+	l.shape = input.Shape()
+	l.xhat, l.invstd = normalizeRows(input.Contiguous().Data(), d, false, l.Eps)
+	index := func(i int) int { return i % d }
+	return tensorFrom(applyAffine(l.xhat, l.Gamma, nil, index), l.shape...)
+}
+
+func (l *RMSNormLayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	if l.xhat == nil {
+		return nil, fmt.Errorf("rmsnorm: backward called before forward")
+	}
+	if !listEqual(gradOutput.Shape(), l.shape) {
+		return nil, fmt.Errorf("rmsnorm: gradient shape %v does not match output %v", gradOutput.Shape(), l.shape)
+	}
+	d := len(l.xhat) / len(l.invstd)
+	index := func(i int) int { return i % d }
+	dxhat, err := affineBackward(gradOutput.Contiguous().Data(), l.xhat, l.Gamma, nil, index)
+	if err != nil {
+		return nil, err
+	}
+	return tensorFrom(normalizeRowsBackward(dxhat, l.xhat, l.invstd, d, false), l.shape...)
+}
+
+func (l *RMSNormLayer) GetParameters() []*Parameter {
+	if l.Gamma == nil {
+		return []*Parameter{}
+	}
+	return []*Parameter{l.Gamma}
+}
+
+func (l *RMSNormLayer) GetWeights() []*tensor.Tensor {
+	if l.Gamma == nil {
+		return nil
+	}
+	return []*tensor.Tensor{l.Gamma.Value}
+}
+
+func (l *RMSNormLayer) GetBiases() []*tensor.Tensor {
+	return nil
+}
@@ -0,0 +1,103 @@
+package layers_test
+
+import (
+	"math"
+	"nnscratch/gradcheck"
+	"nnscratch/layers"
+	"testing"
+)
+
+func TestNormGradients(t *testing.T) {
+	ln, err := layers.NewLayerNormLayer(true, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.Gamma.Value.Data()[2] = 1.7
+	ln.Beta.Value.Data()[1] = 0.3
+	lnPlain, err := layers.NewLayerNormLayer(false, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gn, err := layers.NewGroupNormLayer(2, 4, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gn.Gamma.Value.Data()[3] = -0.5
+	rms, err := layers.NewRMSNormLayer(true, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rms.Gamma.Value.Data()[1] = 1.3
+	rmsPlain, err := layers.NewRMSNormLayer(false, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		layer layers.Layer
+	}{
+		{"layer norm", ln},
+		{"layer norm without affine", lnPlain},
+		{"group norm", gn},
+		{"rms norm", rms},
+		{"rms norm without affine", rmsPlain},
+	}
+	x := randomInput(t, 2, 4, 3, 2)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkLayer(t, tt.layer, x, gradcheck.DefaultOptions())
+		})
+	}
+}
+
+func TestNormForward(t *testing.T) {
+	// [1, 2, 3, 6] has mean 3 and variance 3.5, [3, 4] has a mean square of 12.5
+	ln, _ := layers.NewLayerNormLayer(false, 4)
+	ln.Eps = 0
+	out, err := ln.Forward(tensorOf(t, []float64{1, 2, 3, 6}, 1, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := math.Sqrt(3.5)
+	expectValues(t, out, []int{1, 4}, []float64{-2 / s, -1 / s, 0, 3 / s})
+
+	rms, _ := layers.NewRMSNormLayer(true, 2)
+	rms.Eps = 0
+	rms.Gamma.Value.Data()[1] = 2
+	out, err = rms.Forward(tensorOf(t, []float64{3, 4}, 1, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := math.Sqrt(12.5)
+	expectValues(t, out, []int{1, 2}, []float64{3 / r, 8 / r})
+
+	// channels [1, 3] and [0, 4] make the two groups, each becomes [-1, 1]
+	// before the per channel gamma [1, 2, 1, -1] and beta 0.5
+	gn, _ := layers.NewGroupNormLayer(2, 4, true)
+	gn.Eps = 0
+	copy(gn.Gamma.Value.Data(), []float64{1, 2, 1, -1})
+	copy(gn.Beta.Value.Data(), []float64{0.5, 0.5, 0.5, 0.5})
+	out, err = gn.Forward(tensorOf(t, []float64{1, 3, 0, 4}, 1, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectValues(t, out, []int{1, 4}, []float64{-0.5, 2.5, -0.5, -0.5})
+}
+
+func TestNormConstructorErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		make func() error
+	}{
+		{"layer norm without a shape", func() error { _, err := layers.NewLayerNormLayer(true); return err }},
+		{"layer norm with a zero size", func() error { _, err := layers.NewLayerNormLayer(false, 3, 0); return err }},
+		{"rms norm without a shape", func() error { _, err := layers.NewRMSNormLayer(false); return err }},
+		{"rms norm with a negative size", func() error { _, err := layers.NewRMSNormLayer(true, -2); return err }},
+		{"group norm with uneven groups", func() error { _, err := layers.NewGroupNormLayer(2, 3, true); return err }},
+	}
+	for _, tt := range tests {
+		if tt.make() == nil {
+			t.Errorf("%s gave no error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package layers
+
+import (
+	"fmt"
+	"math"
+	"nnscratch/tensor"
+)
+
+// Pooling layers over NCHW tensors (batch, channels, height, width)
+
+// Sizes shared by the pooling layers
+type poolGeometry struct {
+	batch, channels int
+	inH, inW        int
+	outH, outW      int
+}
+
+// Gives the input rows [h0, h1) and columns [w0, w1) under an output position
+// and the number to divide their sum by for an average
+type poolWindow func(oh, ow int) (h0, h1, w0, w1 int, divisor float64)
+
+// Checks the input is NCHW and gives its sizes
+func poolInput(name string, input *tensor.Tensor) (poolGeometry, error) {
+	shape := input.Shape()
+	if len(shape) != 4 {
+		return poolGeometry{}, fmt.Errorf("%s: expected input (batch, channels, height, width) got %v", name, shape)
+	}
+	return poolGeometry{batch: shape[0], channels: shape[1], inH: shape[2], inW: shape[3]}, nil
+}
+
+// Works out the window sizes, a stride of 0 means the kernel size
+func poolSizes(name string, g *poolGeometry, kernel, stride, padding [2]int) ([2]int, error) {
+	for i := range 2 {
+		if stride[i] == 0 {
+			stride[i] = kernel[i]
+		}
+		if kernel[i] <= 0 || stride[i] < 0 || padding[i] < 0 || 2*padding[i] > kernel[i] {
+			return stride, fmt.Errorf("%s: kernel %v and stride %v must be positive and padding %v at most half the kernel", name, kernel, stride, padding)
+		}
+	}
+	var err error
+	g.outH, err = convOutSize(g.inH, kernel[0], stride[0], padding[0], padding[0], 1)
+	if err != nil {
+		return stride, err
+	}
+	g.outW, err = convOutSize(g.inW, kernel[1], stride[1], padding[1], padding[1], 1)
+	return stride, err
+}
+
+// Averages every window of every channel
+func avgPoolForward(input *tensor.Tensor, g poolGeometry, window poolWindow) (*tensor.Tensor, error) {
+	out, err := tensor.NewTensor(g.batch, g.channels, g.outH, g.outW)
+	if err != nil {
+		return nil, err
+	}
+	x := input.Contiguous().Data()
+	od := out.Data()
+	for nc := 0; nc < g.batch*g.channels; nc++ {
+		plane := x[nc*g.inH*g.inW : (nc+1)*g.inH*g.inW]
+		for oh := 0; oh < g.outH; oh++ {
+			for ow := 0; ow < g.outW; ow++ {
+				h0, h1, w0, w1, div := window(oh, ow)
+				sum := 0.0
+				for h := h0; h < h1; h++ {
+					for w := w0; w < w1; w++ {
+						sum += plane[h*g.inW+w]
+					}
+				}
+				od[(nc*g.outH+oh)*g.outW+ow] = sum / div
+			}
+		}
+	}
+	return out, nil
+}
+
+// Spreads the gradient of every window evenly back over it
+func avgPoolBackward(gradOutput *tensor.Tensor, g poolGeometry, window poolWindow) (*tensor.Tensor, error) {
+	if !listEqual(gradOutput.Shape(), []int{g.batch, g.channels, g.outH, g.outW}) {
+		return nil, fmt.Errorf("pool: gradient shape %v does not match output (%d, %d, %d, %d)", gradOutput.Shape(), g.batch, g.channels, g.outH, g.outW)
+	}
+	dx, err := tensor.NewTensor(g.batch, g.channels, g.inH, g.inW)
+	if err != nil {
+		return nil, err
+	}
+	gd := gradOutput.Contiguous().Data()
+	dd := dx.Data()
+	for nc := 0; nc < g.batch*g.channels; nc++ {
+		plane := dd[nc*g.inH*g.inW : (nc+1)*g.inH*g.inW]
+		for oh := 0; oh < g.outH; oh++ {
+			for ow := 0; ow < g.outW; ow++ {
+				h0, h1, w0, w1, div := window(oh, ow)
+				share := gd[(nc*g.outH+oh)*g.outW+ow] / div
+				for h := h0; h < h1; h++ {
+					for w := w0; w < w1; w++ {
+						plane[h*g.inW+w] += share
+					}
+				}
+			}
+		}
+	}
+	return dx, nil
+}
+
+// Gives the window of a strided kernel clipped to the input
+func kernelWindow(g *poolGeometry, kernel, stride, padding [2]int, countPadding bool) poolWindow {
+	return func(oh, ow int) (int, int, int, int, float64) {
+		h0, w0 := oh*stride[0]-padding[0], ow*stride[1]-padding[1]
+		h1, w1 := h0+kernel[0], w0+kernel[1]
+		h0, w0 = max(h0, 0), max(w0, 0)
+		h1, w1 = min(h1, g.inH), min(w1, g.inW)
+		if countPadding {
+			return h0, h1, w0, w1, float64(kernel[0] * kernel[1])
+		}
+		return h0, h1, w0, w1, float64((h1 - h0) * (w1 - w0))
+	}
+}
+
+// Max pooling, Backward sends each gradient to the input that was the max
+type MaxPool2DLayer struct {
+	KernelSize [2]int
+	Stride     [2]int // 0 means the kernel size
+	Padding    [2]int
+	geom       poolGeometry
+	argmax     []int
+}
+
+func NewMaxPool2DLayer(kernelSize, stride, padding int) *MaxPool2DLayer {
+	return &MaxPool2DLayer{
+		KernelSize: [2]int{kernelSize, kernelSize},
+		Stride:     [2]int{stride, stride},
+		Padding:    [2]int{padding, padding},
+	}
+}
+
+func (m *MaxPool2DLayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	g, err := poolInput("maxPool2d", input)
+	if err != nil {
+		return nil, err
+	}
+	stride, err := poolSizes("maxPool2d", &g, m.KernelSize, m.Stride, m.Padding)
+	if err != nil {
+		return nil, err
+	}
+	out, err := tensor.NewTensor(g.batch, g.channels, g.outH, g.outW)
+	if err != nil {
+		return nil, err
+	}
+	window := kernelWindow(&g, m.KernelSize, stride, m.Padding, false)
+	x := input.Contiguous().Data()
+	od := out.Data()
+	m.argmax = make([]int, len(od))
+	for nc := 0; nc < g.batch*g.channels; nc++ {
+		base := nc * g.inH * g.inW
+		for oh := 0; oh < g.outH; oh++ {
+			for ow := 0; ow < g.outW; ow++ {
+				h0, h1, w0, w1, _ := window(oh, ow)
+				best, bestIdx := math.Inf(-1), base+h0*g.inW+w0
+				for h := h0; h < h1; h++ {
+					for w := w0; w < w1; w++ {
+						idx := base + h*g.inW + w
+						if x[idx] > best {
+							best, bestIdx = x[idx], idx
+						}
+					}
+				}
+				o := (nc*g.outH+oh)*g.outW + ow
+				od[o] = best
+				m.argmax[o] = bestIdx
+			}
+		}
+	}
+	m.geom = g
+	return out, nil
+}
+
+func (m *MaxPool2DLayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	g := m.geom
+	if m.argmax == nil {
+		return nil, fmt.Errorf("maxPool2d: backward called before forward")
+	}
+	if !listEqual(gradOutput.Shape(), []int{g.batch, g.channels, g.outH, g.outW}) {
+		return nil, fmt.Errorf("maxPool2d: gradient shape %v does not match output (%d, %d, %d, %d)", gradOutput.Shape(), g.batch, g.channels, g.outH, g.outW)
+	}
+	dx, err := tensor.NewTensor(g.batch, g.channels, g.inH, g.inW)
+	if err != nil {
+		return nil, err
+	}
+	dd := dx.Data()
+	for o, v := range gradOutput.Contiguous().Data() {
+		dd[m.argmax[o]] += v
+	}
+	return dx, nil
+}
+
+func (m *MaxPool2DLayer) GetParameters() []*Parameter {
+	return []*Parameter{}
+}
+
+func (m *MaxPool2DLayer) GetWeights() []*tensor.Tensor {
+	return nil
+}
+
+func (m *MaxPool2DLayer) GetBiases() []*tensor.Tensor {
+	return nil
+}
+
+// Average pooling, padded positions count towards the divisor unless
+// CountIncludePad is turned off
+type AvgPool2DLayer struct {
+	KernelSize      [2]int
+	Stride          [2]int // 0 means the kernel size
+	Padding         [2]int
+	CountIncludePad bool
+	geom            poolGeometry
+	window          poolWindow
+}
+
+func NewAvgPool2DLayer(kernelSize, stride, padding int) *AvgPool2DLayer {
+	return &AvgPool2DLayer{
+		KernelSize:      [2]int{kernelSize, kernelSize},
+		Stride:          [2]int{stride, stride},
+		Padding:         [2]int{padding, padding},
+		CountIncludePad: true,
+	}
+}
+
+func (a *AvgPool2DLayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	g, err := poolInput("avgPool2d", input)
+	if err != nil {
+		return nil, err
+	}
+	stride, err := poolSizes("avgPool2d", &g, a.KernelSize, a.Stride, a.Padding)
+	if err != nil {
+		return nil, err
+	}
+	a.geom = g
+	a.window = kernelWindow(&a.geom, a.KernelSize, stride, a.Padding, a.CountIncludePad)
+	return avgPoolForward(input, g, a.window)
+}
+
+func (a *AvgPool2DLayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	if a.window == nil {
+		return nil, fmt.Errorf("avgPool2d: backward called before forward")
+	}
+	return avgPoolBackward(gradOutput, a.geom, a.window)
+}
+
+func (a *AvgPool2DLayer) GetParameters() []*Parameter {
+	return []*Parameter{}
+}
+
+func (a *AvgPool2DLayer) GetWeights() []*tensor.Tensor {
+	return nil
+}
+
+func (a *AvgPool2DLayer) GetBiases() []*tensor.Tensor {
+	return nil
+}
+
+// Adaptive average pooling picks the windows so the output is always
+// OutputSize (height, width) whatever the input size
+type AdaptiveAvgPool2DLayer struct {
+	OutputSize [2]int
+	geom       poolGeometry
+	window     poolWindow
+}
+
+func NewAdaptiveAvgPool2DLayer(outH, outW int) *AdaptiveAvgPool2DLayer {
+	return &AdaptiveAvgPool2DLayer{OutputSize: [2]int{outH, outW}}
+}
+
+func (a *AdaptiveAvgPool2DLayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	g, err := poolInput("adaptiveAvgPool2d", input)
+	if err != nil {
+		return nil, err
+	}
+	if a.OutputSize[0] <= 0 || a.OutputSize[1] <= 0 {
+		return nil, fmt.Errorf("adaptiveAvgPool2d: output size must be positive got %v", a.OutputSize)
+	}
+	g.outH, g.outW = a.OutputSize[0], a.OutputSize[1]
+	a.geom = g
+	// bin i covers [floor(i*in/out), ceil((i+1)*in/out))
+	a.window = func(oh, ow int) (int, int, int, int, float64) {
+		h0, h1 := oh*g.inH/g.outH, ((oh+1)*g.inH+g.outH-1)/g.outH
+		w0, w1 := ow*g.inW/g.outW, ((ow+1)*g.inW+g.outW-1)/g.outW
+		return h0, h1, w0, w1, float64((h1 - h0) * (w1 - w0))
+	}
+	return avgPoolForward(input, g, a.window)
+}
+
+func (a *AdaptiveAvgPool2DLayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	if a.window == nil {
+		return nil, fmt.Errorf("adaptiveAvgPool2d: backward called before forward")
+	}
+	return avgPoolBackward(gradOutput, a.geom, a.window)
+}
+
+func (a *AdaptiveAvgPool2DLayer) GetParameters() []*Parameter {
+	return []*Parameter{}
+}
+
+func (a *AdaptiveAvgPool2DLayer) GetWeights() []*tensor.Tensor {
+	return nil
+}
+
+func (a *AdaptiveAvgPool2DLayer) GetBiases() []*tensor.Tensor {
+	return nil
+}
+
+// Global average pooling gives the mean of every channel as (batch, channels),
+// or (batch, channels, 1, 1) with KeepDims
+type GlobalAvgPool2DLayer struct {
+	KeepDims bool
+	geom     poolGeometry
+}
+
+func (a *GlobalAvgPool2DLayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	g, err := poolInput("globalAvgPool2d", input)
+	if err != nil {
+		return nil, err
+	}
+	a.geom = g
+	return input.Mean(a.KeepDims, 2, 3)
+}
+
+func (a *GlobalAvgPool2DLayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	g := a.geom
+	if g.batch == 0 {
+		return nil, fmt.Errorf("globalAvgPool2d: backward called before forward")
+	}
+	grad, err := gradOutput.Reshape(g.batch, g.channels, 1, 1)
+	if err != nil {
+		return nil, fmt.Errorf("globalAvgPool2d: gradient shape %v does not match output (%d, %d)", gradOutput.Shape(), g.batch, g.channels)
+	}
+	grad, err = grad.MulScalar(1.0 / float64(g.inH*g.inW))
+	if err != nil {
+		return nil, err
+	}
+	grad, err = grad.Expand(g.batch, g.channels, g.inH, g.inW)
+	if err != nil {
+		return nil, err
+	}
+	return grad.Contiguous(), nil
+}
+
+func (a *GlobalAvgPool2DLayer) GetParameters() []*Parameter {
+	return []*Parameter{}
+}
+
+func (a *GlobalAvgPool2DLayer) GetWeights() []*tensor.Tensor {
+	return nil
+}
+
+func (a *GlobalAvgPool2DLayer) GetBiases() []*tensor.Tensor {
+	return nil
+}
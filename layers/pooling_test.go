@@ -0,0 +1,87 @@
+package layers_test
+
+import (
+	"nnscratch/gradcheck"
+	"nnscratch/layers"
+	"nnscratch/tensor"
+	"testing"
+)
+
+func TestPoolingGradients(t *testing.T) {
+	avgNoPad := layers.NewAvgPool2DLayer(3, 2, 1)
+	avgNoPad.CountIncludePad = false
+	tests := []struct {
+		name  string
+		layer layers.Layer
+	}{
+		{"max", layers.NewMaxPool2DLayer(2, 0, 0)},
+		{"max padded", layers.NewMaxPool2DLayer(3, 2, 1)},
+		{"avg", layers.NewAvgPool2DLayer(3, 2, 1)},
+		{"avg without pad", avgNoPad},
+		{"adaptive avg", layers.NewAdaptiveAvgPool2DLayer(3, 2)},
+		{"global avg", &layers.GlobalAvgPool2DLayer{}},
+		{"global avg keep dims", &layers.GlobalAvgPool2DLayer{KeepDims: true}},
+	}
+	x := randomInput(t, 2, 3, 7, 5)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkLayer(t, tt.layer, x, gradcheck.DefaultOptions())
+		})
+	}
+}
+
+func poolingInput(t *testing.T) *tensor.Tensor {
+	t.Helper()
+	return tensorOf(t, []float64{
+		1, 3, 2, 0,
+		4, 2, 1, 5,
+		0, 6, 7, 1,
+		2, 1, 3, 8,
+	}, 1, 1, 4, 4)
+}
+
+func TestPoolingForward(t *testing.T) {
+	avgNoPad := layers.NewAvgPool2DLayer(3, 2, 1)
+	avgNoPad.CountIncludePad = false
+	tests := []struct {
+		name  string
+		layer layers.Layer
+		shape []int
+		want  []float64
+	}{
+		{"max", layers.NewMaxPool2DLayer(2, 0, 0), []int{1, 1, 2, 2}, []float64{4, 5, 6, 8}},
+		// the 3x3 windows hang over the padding by one row and column
+		{"avg", layers.NewAvgPool2DLayer(3, 2, 1), []int{1, 1, 2, 2}, []float64{10.0 / 9, 13.0 / 9, 15.0 / 9, 34.0 / 9}},
+		{"avg without pad", avgNoPad, []int{1, 1, 2, 2}, []float64{10.0 / 4, 13.0 / 6, 15.0 / 6, 34.0 / 9}},
+		{"adaptive avg", layers.NewAdaptiveAvgPool2DLayer(2, 2), []int{1, 1, 2, 2}, []float64{10.0 / 4, 8.0 / 4, 9.0 / 4, 19.0 / 4}},
+		{"global avg", &layers.GlobalAvgPool2DLayer{}, []int{1, 1}, []float64{46.0 / 16}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := tt.layer.Forward(poolingInput(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectValues(t, out, tt.shape, tt.want)
+		})
+	}
+}
+
+func TestMaxPoolRoutesToArgmax(t *testing.T) {
+	pool := layers.NewMaxPool2DLayer(2, 0, 0)
+	if _, err := pool.Forward(poolingInput(t)); err != nil {
+		t.Fatal(err)
+	}
+	grad, err := pool.Backward(tensorOf(t, []float64{1, 2, 3, 4}, 1, 1, 2, 2), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// each gradient lands on the max of its window, 4 at (1, 0), 5 at (1, 3),
+	// 6 at (2, 1) and 8 at (3, 3)
+	expectValues(t, grad, []int{1, 1, 4, 4}, []float64{
+		0, 0, 0, 0,
+		1, 0, 0, 2,
+		0, 3, 0, 0,
+		0, 0, 0, 4,
+	})
+}
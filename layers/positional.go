@@ -0,0 +1,121 @@
+package layers
+
+import (
+	"fmt"
+	"math"
+	"nnscratch/tensor"
+)
+
+// Fixed sinusoidal position encoding added to (batch, seq, dim) inputs,
+// pe(pos, 2i) = sin(pos / 10000^(2i/dim)) and pe(pos, 2i+1) the cosine
+type SinusoidalPositionalEncoding struct {
+	MaxLen int
+	Dim    int
+	table  *tensor.Tensor // (maxLen, dim)
+}
+
+func NewSinusoidalPositionalEncoding(maxLen, dim int) (*SinusoidalPositionalEncoding, error) {
+	if maxLen <= 0 || dim <= 0 {
+		return nil, fmt.Errorf("positional: sizes (%d, %d) must be positive", maxLen, dim)
+	}
+	table, _ := tensor.NewTensor(maxLen, dim)
+	td := table.Data()
+	for pos := 0; pos < maxLen; pos++ {
+		for i := 0; i < dim; i++ {
+			angle := float64(pos) / math.Pow(10000, float64(i-i%2)/float64(dim))
+			if i%2 == 0 {
+				td[pos*dim+i] = math.Sin(angle)
+			} else {
+				td[pos*dim+i] = math.Cos(angle)
+			}
+		}
+	}
+	return &SinusoidalPositionalEncoding{MaxLen: maxLen, Dim: dim, table: table}, nil
+}
+
+// Gives the first seq rows of table after checking input is (batch, seq, dim)
+func positionRows(name string, table, input *tensor.Tensor) (*tensor.Tensor, error) {
+	shape := input.Shape()
+	limits := table.Shape()
+	if len(shape) != 3 || shape[1] > limits[0] || shape[2] != limits[1] {
+		return nil, fmt.Errorf("%s: expected input (batch, seq <= %d, %d) got %v", name, limits[0], limits[1], shape)
+	}
+	return table.Narrow(0, 0, shape[1])
+}
+
+func (p *SinusoidalPositionalEncoding) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	rows, err := positionRows("positional", p.table, input)
+	if err != nil {
+		return nil, err
+	}
+	return tensor.TensorAdd(input, rows)
+}
+
+func (p *SinusoidalPositionalEncoding) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	return gradOutput, nil
+}
+
+func (p *SinusoidalPositionalEncoding) GetParameters() []*Parameter {
+	return []*Parameter{}
+}
+
+func (p *SinusoidalPositionalEncoding) GetWeights() []*tensor.Tensor {
+	return nil
+}
+
+func (p *SinusoidalPositionalEncoding) GetBiases() []*tensor.Tensor {
+	return nil
+}
+
+// Learned position encoding, a trainable row per position added to
+// (batch, seq, dim) inputs
+type LearnedPositionalEncoding struct {
+	Weight *Parameter // (maxLen, dim)
+	seq    int
+}
+
+func NewLearnedPositionalEncoding(maxLen, dim int) (*LearnedPositionalEncoding, error) {
+	if maxLen <= 0 || dim <= 0 {
+		return nil, fmt.Errorf("learnedPositional: sizes (%d, %d) must be positive", maxLen, dim)
+	}
+	return &LearnedPositionalEncoding{Weight: randomParameter(maxLen, dim)}, nil
+}
+
+func (p *LearnedPositionalEncoding) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	rows, err := positionRows("learnedPositional", p.Weight.Value, input)
+	if err != nil {
+		return nil, err
+	}
+	p.seq = input.Shape()[1]
+	return tensor.TensorAdd(input, rows)
+}
+
+// The used rows get the gradient summed over the batch, the rest get zero
+func (p *LearnedPositionalEncoding) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	if p.seq == 0 {
+		return nil, fmt.Errorf("learnedPositional: backward called before forward")
+	}
+	sum, err := gradOutput.SumAxis(false, 0)
+	if err != nil {
+		return nil, err
+	}
+	grad, err := tensor.NewTensor(p.Weight.Value.Shape()...)
+	if err != nil {
+		return nil, err
+	}
+	copy(grad.Data(), sum.Contiguous().Data())
+	p.Weight.Grad = grad
+	return gradOutput, nil
+}
+
+func (p *LearnedPositionalEncoding) GetParameters() []*Parameter {
+	return []*Parameter{p.Weight}
+}
+
+func (p *LearnedPositionalEncoding) GetWeights() []*tensor.Tensor {
+	return []*tensor.Tensor{p.Weight.Value}
+}
+
+func (p *LearnedPositionalEncoding) GetBiases() []*tensor.Tensor {
+	return nil
+}
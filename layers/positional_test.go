@@ -0,0 +1,58 @@
+package layers_test
+
+import (
+	"math"
+	"nnscratch/gradcheck"
+	"nnscratch/layers"
+	"testing"
+)
+
+func TestPositionalEncodingGradients(t *testing.T) {
+	sinusoidal, err := layers.NewSinusoidalPositionalEncoding(10, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	learned, err := layers.NewLearnedPositionalEncoding(10, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scaleParameters(t, learned, 50)
+	tests := []struct {
+		name  string
+		layer layers.Layer
+	}{
+		{"sinusoidal", sinusoidal},
+		{"learned", learned},
+	}
+	x := randomInput(t, 2, 4, 6)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkLayer(t, tt.layer, x, gradcheck.DefaultOptions())
+		})
+	}
+}
+
+func TestPositionalEncodingForward(t *testing.T) {
+	sinusoidal, err := layers.NewSinusoidalPositionalEncoding(5, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// on zeros the output is the table, the second pair of dims runs 100
+	// times slower than the first
+	out, err := sinusoidal.Forward(tensorOf(t, make([]float64, 8), 1, 2, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectValues(t, out, []int{1, 2, 4}, []float64{0, 1, 0, 1, math.Sin(1), math.Cos(1), math.Sin(0.01), math.Cos(0.01)})
+
+	learned, err := layers.NewLearnedPositionalEncoding(3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(learned.Weight.Value.Data(), []float64{1, 2, 3, 4, 5, 6})
+	out, err = learned.Forward(tensorOf(t, []float64{1, 1, 0, 0, -1, 0, 0, 1}, 2, 2, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectValues(t, out, []int{2, 2, 2}, []float64{2, 3, 3, 4, 0, 2, 3, 5})
+}
@@ -0,0 +1,530 @@
+package layers
+
+import (
+	"fmt"
+	"math"
+	"nnscratch/activations"
+	"nnscratch/tensor"
+)
+
+// Shared engine of the recurrent layers. Inputs are (batch, seq, features)
+// and every layer and direction runs its own cell over the sequence with the
+// gate equations torch uses. Work is done on raw slices with the gemm helpers.
+
+// Settings of the recurrent layers. Stacked layers feed each other their full
+// output sequence and a bidirectional layer concatenates the forward and the
+// backward hidden states, giving 2 * HiddenSize features
+type RecurrentConfig struct {
+	InputSize       int
+	HiddenSize      int
+	NumLayers       int    // defaults to 1
+	Bidirectional   bool
+	ReturnSequences bool   // give every hidden state (batch, seq, dirs*hidden) instead of the last (batch, dirs*hidden)
+	TruncateSteps   int    // carry gradients back through at most this many steps at a time, 0 for full BPTT
+	Nonlinearity    string // "tanh" (default) or "relu", only used by RNNLayer
+}
+
+// Parameters of one layer and direction, the gates are stacked along the rows
+type RecurrentWeights struct {
+	Wih *Parameter // (gates*hidden, input)
+	Whh *Parameter // (gates*hidden, hidden)
+	Bih *Parameter // (gates*hidden)
+	Bhh *Parameter // (gates*hidden)
+}
+
+type cellKind int
+
+const (
+	cellTanh cellKind = iota
+	cellReLU
+	cellLSTM
+	cellGRU
+)
+
+// Number of stacked gates of a cell
+func (k cellKind) gates() int {
+	switch k {
+	case cellLSTM:
+		return 4
+	case cellGRU:
+		return 3
+	}
+	return 1
+}
+
+// What one direction of one layer keeps from the forward pass, indexed by
+// the step in processing order
+type recurrentCache struct {
+	hPrev [][]float64 // (batch, hidden)
+	cPrev [][]float64 // lstm cell state before the step
+	c     [][]float64 // lstm cell state after the step
+	gates [][]float64 // (batch, gates*hidden) after their activations
+	hn    [][]float64 // gru Whn*h + bhn
+}
+
+type recurrent struct {
+	Config  RecurrentConfig
+	Weights []RecurrentWeights // layer major, Weights[layer*dirs+dir]
+	kind    cellKind
+	name    string
+	caches  []recurrentCache
+	inputs  [][]float64 // input of every layer
+	batch   int
+	steps   int
+}
+
+func newRecurrent(name string, kind cellKind, cfg RecurrentConfig) (recurrent, error) {
+	if cfg.NumLayers == 0 {
+		cfg.NumLayers = 1
+	}
+	if cfg.InputSize <= 0 || cfg.HiddenSize <= 0 || cfg.NumLayers < 0 || cfg.TruncateSteps < 0 {
+		return recurrent{}, fmt.Errorf("%s: sizes and truncation must be positive got %+v", name, cfg)
+	}
+	r := recurrent{Config: cfg, kind: kind, name: name}
+	dirs := r.dirs()
+	gh := kind.gates() * cfg.HiddenSize
+	for l := 0; l < cfg.NumLayers; l++ {
+		in := cfg.InputSize
+		if l > 0 {
+			in = dirs * cfg.HiddenSize
+		}
+		for d := 0; d < dirs; d++ {
+			r.Weights = append(r.Weights, RecurrentWeights{
+				Wih: randomParameter(gh, in),
+				Whh: randomParameter(gh, cfg.HiddenSize),
+				Bih: randomParameter(gh),
+				Bhh: randomParameter(gh),
+			})
+		}
+	}
+	return r, nil
+}
+
+// Gives a parameter of random values and a zero grad
+func randomParameter(shape ...int) *Parameter {
+	v, _ := tensor.NewTensorRandom(shape...)
+	grad, _ := tensor.NewTensor(shape...)
+	return &Parameter{Value: v, Grad: grad}
+}
+
+func (r *recurrent) dirs() int {
+	if r.Config.Bidirectional {
+		return 2
+	}
+	return 1
+}
+
+// Copies step t of x (batch, steps, width) into dst (batch, width)
+func gatherStep(x, dst []float64, batch, steps, width, t int) {
+	for b := 0; b < batch; b++ {
+		copy(dst[b*width:(b+1)*width], x[(b*steps+t)*width:(b*steps+t+1)*width])
+	}
+}
+
+// Adds src (batch, width) into step t of x (batch, steps, stride) starting at column offset
+func scatterStep(x, src []float64, batch, steps, stride, offset, width, t int) {
+	for b := 0; b < batch; b++ {
+		row := x[(b*steps+t)*stride+offset : (b*steps+t)*stride+offset+width]
+		for j, v := range src[b*width : (b+1)*width] {
+			row[j] += v
+		}
+	}
+}
+
+// Adds bias to every row of m
+func addRows(m, bias []float64) {
+	for i := range m {
+		m[i] += bias[i%len(bias)]
+	}
+}
+
+// Adds the column sums of m (rows, len(out)) into out
+func sumRows(out, m []float64) {
+	for i, v := range m {
+		out[i%len(out)] += v
+	}
+}
+
+func (r *recurrent) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	shape := input.Shape()
+	if len(shape) != 3 || shape[1] == 0 || shape[2] != r.Config.InputSize {
+		return nil, fmt.Errorf("%s: expected input (batch, seq, %d) got %v", r.name, r.Config.InputSize, shape)
+	}
+	batch, steps := shape[0], shape[1]
+	dirs := r.dirs()
+	hidden := r.Config.HiddenSize
+	r.batch, r.steps = batch, steps
+	r.caches = make([]recurrentCache, len(r.Weights))
+	r.inputs = make([][]float64, r.Config.NumLayers)
+
+	x := input.Contiguous().Data()
+	width := r.Config.InputSize
+	for l := 0; l < r.Config.NumLayers; l++ {
+		r.inputs[l] = x
+		out := make([]float64, batch*steps*dirs*hidden)
+		for d := 0; d < dirs; d++ {
+			r.forwardDirection(l, d, x, width, out)
+		}
+		x, width = out, dirs*hidden
+	}
+
+	if r.Config.ReturnSequences {
+		return tensorFrom(x, batch, steps, width)
+	}
+	// the last state of every direction, step seq-1 going forward and 0 going back
+	last := make([]float64, batch*width)
+	for b := 0; b < batch; b++ {
+		for d := 0; d < dirs; d++ {
+			t := steps - 1
+			if d == 1 {
+				t = 0
+			}
+			copy(last[b*width+d*hidden:b*width+(d+1)*hidden], x[(b*steps+t)*width+d*hidden:(b*steps+t)*width+(d+1)*hidden])
+		}
+	}
+	return tensorFrom(last, batch, width)
+}
+
+// Runs direction d of layer l over x (batch, steps, width) and writes the
+// hidden states into its columns of out
+func (r *recurrent) forwardDirection(l, d int, x []float64, width int, out []float64) {
+	batch, steps, hidden := r.batch, r.steps, r.Config.HiddenSize
+	gh := r.kind.gates() * hidden
+	w := r.Weights[l*r.dirs()+d]
+	wih := w.Wih.Value.Contiguous().Data()
+	whh := w.Whh.Value.Contiguous().Data()
+	bih := w.Bih.Value.Contiguous().Data()
+	bhh := w.Bhh.Value.Contiguous().Data()
+
+	cache := &r.caches[l*r.dirs()+d]
+	*cache = recurrentCache{
+		hPrev: make([][]float64, steps),
+		cPrev: make([][]float64, steps),
+		c:     make([][]float64, steps),
+		gates: make([][]float64, steps),
+		hn:    make([][]float64, steps),
+	}
+	h := make([]float64, batch*hidden)
+	c := make([]float64, batch*hidden)
+	xt := make([]float64, batch*width)
+	for s := 0; s < steps; s++ {
+		t := s
+		if d == 1 {
+			t = steps - 1 - s
+		}
+		gatherStep(x, xt, batch, steps, width, t)
+		xg := make([]float64, batch*gh)
+		gemmBT(xg, xt, wih, batch, width, gh)
+		addRows(xg, bih)
+		hg := make([]float64, batch*gh)
+		gemmBT(hg, h, whh, batch, hidden, gh)
+		addRows(hg, bhh)
+
+		cache.hPrev[s] = h
+		h, c = r.cellForward(xg, hg, h, c, cache, s)
+		scatterStep(out, h, batch, steps, r.dirs()*hidden, d*hidden, hidden, t)
+	}
+}
+
+// One step of the cell from the input and hidden projections, gives the new
+// hidden and cell state
+func (r *recurrent) cellForward(xg, hg, h, c []float64, cache *recurrentCache, s int) ([]float64, []float64) {
+	hidden := r.Config.HiddenSize
+	gh := r.kind.gates() * hidden
+	rows := len(h) / hidden
+	hNew := make([]float64, len(h))
+	gates := make([]float64, len(xg))
+	cache.gates[s] = gates
+
+	switch r.kind {
+	case cellTanh, cellReLU:
+		for i := range hNew {
+			a := xg[i] + hg[i]
+			if r.kind == cellTanh {
+				hNew[i] = math.Tanh(a)
+			} else {
+				hNew[i] = math.Max(a, 0)
+			}
+			gates[i] = hNew[i]
+		}
+		return hNew, c
+
+	case cellLSTM:
+		// i, f, g, o; c = f*c + i*g and h = o*tanh(c)
+		cNew := make([]float64, len(c))
+		for b := 0; b < rows; b++ {
+			for j := 0; j < hidden; j++ {
+				k := b*gh + j
+				i := activations.Sigmoid(xg[k] + hg[k])
+				f := activations.Sigmoid(xg[k+hidden] + hg[k+hidden])
+				g := math.Tanh(xg[k+2*hidden] + hg[k+2*hidden])
+				o := activations.Sigmoid(xg[k+3*hidden] + hg[k+3*hidden])
+				gates[k], gates[k+hidden], gates[k+2*hidden], gates[k+3*hidden] = i, f, g, o
+				cNew[b*hidden+j] = f*c[b*hidden+j] + i*g
+				hNew[b*hidden+j] = o * math.Tanh(cNew[b*hidden+j])
+			}
+		}
+		cache.cPrev[s], cache.c[s] = c, cNew
+		return hNew, cNew
+
+	default:
+		// r, z, n; n = tanh(xn + r*(Whn*h + bhn)) and h = (1-z)*n + z*h
+		hn := make([]float64, len(h))
+		for b := 0; b < rows; b++ {
+			for j := 0; j < hidden; j++ {
+				k := b*gh + j
+				rg := activations.Sigmoid(xg[k] + hg[k])
+				z := activations.Sigmoid(xg[k+hidden] + hg[k+hidden])
+				hn[b*hidden+j] = hg[k+2*hidden]
+				n := math.Tanh(xg[k+2*hidden] + rg*hg[k+2*hidden])
+				gates[k], gates[k+hidden], gates[k+2*hidden] = rg, z, n
+				hNew[b*hidden+j] = (1-z)*n + z*h[b*hidden+j]
+			}
+		}
+		cache.hn[s] = hn
+		return hNew, c
+	}
+}
+
+func (r *recurrent) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	if r.inputs == nil {
+		return nil, fmt.Errorf("%s: backward called before forward", r.name)
+	}
+	batch, steps, hidden, dirs := r.batch, r.steps, r.Config.HiddenSize, r.dirs()
+	width := dirs * hidden
+	g := gradOutput.Contiguous().Data()
+	var dOut []float64
+	if r.Config.ReturnSequences {
+		if !listEqual(gradOutput.Shape(), []int{batch, steps, width}) {
+			return nil, fmt.Errorf("%s: gradient shape %v does not match output (%d, %d, %d)", r.name, gradOutput.Shape(), batch, steps, width)
+		}
+		dOut = g
+	} else {
+		if !listEqual(gradOutput.Shape(), []int{batch, width}) {
+			return nil, fmt.Errorf("%s: gradient shape %v does not match output (%d, %d)", r.name, gradOutput.Shape(), batch, width)
+		}
+		dOut = make([]float64, batch*steps*width)
+		for d := 0; d < dirs; d++ {
+			t := steps - 1
+			if d == 1 {
+				t = 0
+			}
+			for b := 0; b < batch; b++ {
+				copy(dOut[(b*steps+t)*width+d*hidden:(b*steps+t)*width+(d+1)*hidden], g[b*width+d*hidden:b*width+(d+1)*hidden])
+			}
+		}
+	}
+
+	for l := r.Config.NumLayers - 1; l >= 0; l-- {
+		in := r.Config.InputSize
+		if l > 0 {
+			in = width
+		}
+		dx := make([]float64, batch*steps*in)
+		for d := 0; d < dirs; d++ {
+			if err := r.backwardDirection(l, d, dOut, in, dx); err != nil {
+				return nil, err
+			}
+		}
+		dOut = dx
+	}
+	return tensorFrom(dOut, batch, steps, r.Config.InputSize)
+}
+
+// Backpropagates direction d of layer l, sets its parameter grads and adds
+// the input gradient into dx (batch, steps, in). With TruncateSteps the
+// carried gradient is dropped every TruncateSteps steps
+func (r *recurrent) backwardDirection(l, d int, dOut []float64, in int, dx []float64) error {
+	batch, steps, hidden, dirs := r.batch, r.steps, r.Config.HiddenSize, r.dirs()
+	gh := r.kind.gates() * hidden
+	w := r.Weights[l*dirs+d]
+	wih := w.Wih.Value.Contiguous().Data()
+	whh := w.Whh.Value.Contiguous().Data()
+	cache := &r.caches[l*dirs+d]
+	x := r.inputs[l]
+
+	dWih := make([]float64, gh*in)
+	dWhh := make([]float64, gh*hidden)
+	dBih := make([]float64, gh)
+	dBhh := make([]float64, gh)
+	dh := make([]float64, batch*hidden)
+	dc := make([]float64, batch*hidden)
+	xt := make([]float64, batch*in)
+	for s := steps - 1; s >= 0; s-- {
+		t := s
+		if d == 1 {
+			t = steps - 1 - s
+		}
+		for b := 0; b < batch; b++ {
+			row := dOut[(b*steps+t)*dirs*hidden+d*hidden:]
+			for j := 0; j < hidden; j++ {
+				dh[b*hidden+j] += row[j]
+			}
+		}
+		dxg, dhg, dhPrev, dcPrev := r.cellBackward(dh, dc, cache, s)
+
+		gatherStep(x, xt, batch, steps, in, t)
+		gemmAT(dWih, dxg, xt, gh, batch, in)
+		sumRows(dBih, dxg)
+		dxt := make([]float64, batch*in)
+		gemm(dxt, dxg, wih, batch, gh, in)
+		scatterStep(dx, dxt, batch, steps, in, 0, in, t)
+
+		gemmAT(dWhh, dhg, cache.hPrev[s], gh, batch, hidden)
+		sumRows(dBhh, dhg)
+		gemm(dhPrev, dhg, whh, batch, gh, hidden)
+
+		dh, dc = dhPrev, dcPrev
+		if k := r.Config.TruncateSteps; k > 0 && s%k == 0 {
+			dh = make([]float64, batch*hidden)
+			dc = make([]float64, batch*hidden)
+		}
+	}
+
+	var err error
+	if w.Wih.Grad, err = tensorFrom(dWih, gh, in); err != nil {
+		return err
+	}
+	if w.Whh.Grad, err = tensorFrom(dWhh, gh, hidden); err != nil {
+		return err
+	}
+	if w.Bih.Grad, err = tensorFrom(dBih, gh); err != nil {
+		return err
+	}
+	w.Bhh.Grad, err = tensorFrom(dBhh, gh)
+	return err
+}
+
+// Gradients of one step for the hidden gradient dh and cell gradient dc.
+// Gives the gradient of the input projection, of the hidden projection, the
+// part of the previous hidden gradient that skips Whh and the previous cell
+// gradient
+func (r *recurrent) cellBackward(dh, dc []float64, cache *recurrentCache, s int) (dxg, dhg, dhPrev, dcPrev []float64) {
+	hidden := r.Config.HiddenSize
+	gh := r.kind.gates() * hidden
+	rows := len(dh) / hidden
+	gates := cache.gates[s]
+	dhPrev = make([]float64, len(dh))
+	dcPrev = make([]float64, len(dc))
+
+	switch r.kind {
+	case cellTanh, cellReLU:
+		dxg = make([]float64, len(dh))
+		for i, h := range gates {
+			if r.kind == cellTanh {
+				dxg[i] = dh[i] * (1 - h*h)
+			} else if h > 0 {
+				dxg[i] = dh[i]
+			}
+		}
+		return dxg, dxg, dhPrev, dcPrev
+
+	case cellLSTM:
+		dxg = make([]float64, rows*gh)
+		for b := 0; b < rows; b++ {
+			for j := 0; j < hidden; j++ {
+				k := b*gh + j
+				m := b*hidden + j
+				i, f, g, o := gates[k], gates[k+hidden], gates[k+2*hidden], gates[k+3*hidden]
+				tc := math.Tanh(cache.c[s][m])
+				dct := dc[m] + dh[m]*o*(1-tc*tc)
+				dxg[k] = dct * g * i * (1 - i)
+				dxg[k+hidden] = dct * cache.cPrev[s][m] * f * (1 - f)
+				dxg[k+2*hidden] = dct * i * (1 - g*g)
+				dxg[k+3*hidden] = dh[m] * tc * o * (1 - o)
+				dcPrev[m] = dct * f
+			}
+		}
+		return dxg, dxg, dhPrev, dcPrev
+
+	default:
+		dxg = make([]float64, rows*gh)
+		dhg = make([]float64, rows*gh)
+		hPrev := cache.hPrev[s]
+		for b := 0; b < rows; b++ {
+			for j := 0; j < hidden; j++ {
+				k := b*gh + j
+				m := b*hidden + j
+				rg, z, n := gates[k], gates[k+hidden], gates[k+2*hidden]
+				dan := dh[m] * (1 - z) * (1 - n*n)
+				dar := dan * cache.hn[s][m] * rg * (1 - rg)
+				daz := dh[m] * (hPrev[m] - n) * z * (1 - z)
+				dxg[k], dxg[k+hidden], dxg[k+2*hidden] = dar, daz, dan
+				dhg[k], dhg[k+hidden], dhg[k+2*hidden] = dar, daz, dan*rg
+				dhPrev[m] = dh[m] * z
+			}
+		}
+		return dxg, dhg, dhPrev, dcPrev
+	}
+}
+
+func (r *recurrent) GetParameters() []*Parameter {
+	params := []*Parameter{}
+	for _, w := range r.Weights {
+		params = append(params, w.Wih, w.Whh, w.Bih, w.Bhh)
+	}
+	return params
+}
+
+func (r *recurrent) GetWeights() []*tensor.Tensor {
+	var weights []*tensor.Tensor
+	for _, w := range r.Weights {
+		weights = append(weights, w.Wih.Value, w.Whh.Value)
+	}
+	return weights
+}
+
+func (r *recurrent) GetBiases() []*tensor.Tensor {
+	var biases []*tensor.Tensor
+	for _, w := range r.Weights {
+		biases = append(biases, w.Bih.Value, w.Bhh.Value)
+	}
+	return biases
+}
+
+// Elman recurrent layer, h = act(Wih*x + bih + Whh*h + bhh)
+type RNNLayer struct {
+	recurrent
+}
+
+func NewRNNLayer(cfg RecurrentConfig) (*RNNLayer, error) {
+	kind := cellTanh
+	switch cfg.Nonlinearity {
+	case "", "tanh":
+	case "relu":
+		kind = cellReLU
+	default:
+		return nil, fmt.Errorf("rnn: unknown nonlinearity %q", cfg.Nonlinearity)
+	}
+	r, err := newRecurrent("rnn", kind, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &RNNLayer{r}, nil
+}
+
+// Long short-term memory layer with input, forget, cell and output gates
+type LSTMLayer struct {
+	recurrent
+}
+
+func NewLSTMLayer(cfg RecurrentConfig) (*LSTMLayer, error) {
+	r, err := newRecurrent("lstm", cellLSTM, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &LSTMLayer{r}, nil
+}
+
+// Gated recurrent unit layer with reset, update and new gates
+type GRULayer struct {
+	recurrent
+}
+
+func NewGRULayer(cfg RecurrentConfig) (*GRULayer, error) {
+	r, err := newRecurrent("gru", cellGRU, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &GRULayer{r}, nil
+}
@@ -0,0 +1,155 @@
+package layers_test
+
+import (
+	"fmt"
+	"math"
+	"nnscratch/gradcheck"
+	"nnscratch/layers"
+	"nnscratch/tensor"
+	"slices"
+	"testing"
+)
+
+// The default initialisation is small enough that the gates are nearly
+// linear, so the parameters are scaled up to check the nonlinear parts too
+func scaleParameters(t *testing.T, l layers.Layer, s float64) {
+	t.Helper()
+	for _, p := range l.GetParameters() {
+		value, err := p.Value.MulScalar(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Value = value
+	}
+}
+
+func TestRecurrentGradients(t *testing.T) {
+	configs := []layers.RecurrentConfig{
+		{InputSize: 3, HiddenSize: 4},
+		{InputSize: 3, HiddenSize: 4, ReturnSequences: true, Bidirectional: true, NumLayers: 2},
+		{InputSize: 3, HiddenSize: 2, Bidirectional: true, NumLayers: 3},
+	}
+	constructors := []struct {
+		name string
+		new  func(layers.RecurrentConfig) (layers.Layer, error)
+	}{
+		{"rnn", func(c layers.RecurrentConfig) (layers.Layer, error) { return layers.NewRNNLayer(c) }},
+		{"lstm", func(c layers.RecurrentConfig) (layers.Layer, error) { return layers.NewLSTMLayer(c) }},
+		{"gru", func(c layers.RecurrentConfig) (layers.Layer, error) { return layers.NewGRULayer(c) }},
+	}
+	x := randomInput(t, 2, 5, 3)
+	for i, cfg := range configs {
+		for _, c := range constructors {
+			t.Run(fmt.Sprintf("%s %d", c.name, i), func(t *testing.T) {
+				l, err := c.new(cfg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				scaleParameters(t, l, 60)
+				checkLayer(t, l, x, gradcheck.DefaultOptions())
+			})
+		}
+	}
+}
+
+func TestRecurrentTruncation(t *testing.T) {
+	x := randomInput(t, 2, 5, 3)
+	l, err := layers.NewLSTMLayer(layers.RecurrentConfig{InputSize: 3, HiddenSize: 4, ReturnSequences: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scaleParameters(t, l, 60)
+	inputGrad := func(truncate int) *tensor.Tensor {
+		t.Helper()
+		l.Config.TruncateSteps = truncate
+		out, err := l.Forward(x)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ones, _ := tensor.NewTensorOnes(out.Shape()...)
+		grad, err := l.Backward(ones, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return grad
+	}
+	full, truncated := inputGrad(0), inputGrad(2)
+	if !slices.Equal(truncated.Shape(), x.Shape()) {
+		t.Fatalf("gradient shape %v, expected %v", truncated.Shape(), x.Shape())
+	}
+	// the last step only gets the gradient of its own output either way,
+	// the first one loses what came back from later steps
+	last := func(g *tensor.Tensor) []float64 {
+		s, _ := g.Slice(0, 4)
+		return s.Contiguous().Data()
+	}
+	first := func(g *tensor.Tensor) []float64 {
+		s, _ := g.Slice(0, 0)
+		return s.Contiguous().Data()
+	}
+	if !slices.Equal(last(full), last(truncated)) {
+		t.Errorf("last step gradient %v with truncation, expected %v", last(truncated), last(full))
+	}
+	if slices.Equal(first(full), first(truncated)) {
+		t.Error("truncation left the gradient of the first step as it was")
+	}
+}
+
+// Sets the weights of a one layer, one direction cell with one hidden unit,
+// the gates are stacked in the order torch uses
+func setCell(t *testing.T, w layers.RecurrentWeights, wih, whh, bih, bhh []float64) {
+	t.Helper()
+	for _, p := range []struct {
+		param  *layers.Parameter
+		values []float64
+	}{{w.Wih, wih}, {w.Whh, whh}, {w.Bih, bih}, {w.Bhh, bhh}} {
+		if p.param.Value.Len() != len(p.values) {
+			t.Fatalf("parameter of shape %v set to %v", p.param.Value.Shape(), p.values)
+		}
+		copy(p.param.Value.Data(), p.values)
+	}
+}
+
+// Two steps of one hidden unit against values worked out by hand from the
+// gate equations
+func TestRecurrentForward(t *testing.T) {
+	cfg := layers.RecurrentConfig{InputSize: 1, HiddenSize: 1, ReturnSequences: true}
+	x := tensorOf(t, []float64{1, -2}, 1, 2, 1)
+
+	lstm, err := layers.NewLSTMLayer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// i, f, g, o
+	setCell(t, lstm.Weights[0], []float64{0.5, -0.3, 0.8, 0.2}, []float64{0.1, 0.4, -0.6, 0.7}, []float64{0.05, 0.1, -0.1, 0.2}, []float64{0, 0, 0, 0})
+	out, err := lstm.Forward(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectValues(t, out, []int{1, 2, 1}, []float64{0.2188368296704452, -0.0027926889765337265})
+
+	gru, err := layers.NewGRULayer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// r, z, n with a hidden bias on n that r gates
+	setCell(t, gru.Weights[0], []float64{0.5, -0.3, 0.8}, []float64{0.1, 0.4, -0.6}, []float64{0.05, 0.1, -0.1}, []float64{0, 0, 0.3})
+	out, err = gru.Forward(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectValues(t, out, []int{1, 2, 1}, []float64{0.3912138096007659, -0.0035082242361342275})
+
+	rnn, err := layers.NewRNNLayer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// h1 = tanh(0.5 + 0.1) and h2 = tanh(-1 + 0.1 + 2*h1)
+	setCell(t, rnn.Weights[0], []float64{0.5}, []float64{2}, []float64{0.1}, []float64{0})
+	out, err = rnn.Forward(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h1 := math.Tanh(0.6)
+	expectValues(t, out, []int{1, 2, 1}, []float64{h1, math.Tanh(-0.9 + 2*h1)})
+}
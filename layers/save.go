@@ -0,0 +1,196 @@
+package layers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"nnscratch/internal/binfmt"
+	"nnscratch/tensor"
+	"reflect"
+)
+
+// Model files start with this magic, the version goes up whenever the
+// layout of the payload changes
+const (
+	modelMagic   = "NNSC"
+	ModelVersion = 1
+)
+
+// Layers with state that is not a Parameter but must be saved, like the
+// running statistics of batch norm. Containers give the buffers of their
+// layers. Load copies into the tensors in place
+type BufferLayer interface {
+	GetBuffers() []*tensor.Tensor
+}
+
+// Saves and rebuilds one layer type. Config gives what Build needs to make an
+// equal layer with fresh parameters, like its sizes, plus the child layers of
+// a container. The config is stored as JSON. Load copies the saved parameters
+// and buffers into the rebuilt layer, so a layer with children must not have
+// parameters of its own
+type LayerCodec struct {
+	Config func(l Layer) (config any, children []Layer, err error)
+	Build  func(config []byte, children []Layer) (Layer, error)
+}
+
+var (
+	codecs     = make(map[string]LayerCodec)
+	codecNames = make(map[reflect.Type]string)
+)
+
+// Registers how layers of the prototype's type are saved under name. The
+// built in layers are registered already, custom layers register in an init
+func RegisterLayer(name string, prototype Layer, codec LayerCodec) {
+	if _, ok := codecs[name]; ok {
+		panic(fmt.Sprintf("layers: layer name %q registered twice", name))
+	}
+	codecs[name] = codec
+	codecNames[reflect.TypeOf(prototype)] = name
+}
+
+// Writes the architecture and every parameter of model
+func Save(w io.Writer, model Layer) error {
+	enc := &binfmt.Writer{}
+	if err := encodeLayer(enc, model); err != nil {
+		return err
+	}
+	return binfmt.WriteFramed(w, modelMagic, ModelVersion, enc.Payload())
+}
+
+// Reads a model written by Save, ready to run
+func Load(r io.Reader) (Layer, error) {
+	version, payload, err := binfmt.ReadFramed(r, modelMagic)
+	if err != nil {
+		return nil, fmt.Errorf("load: %w", err)
+	}
+	if version != ModelVersion {
+		return nil, fmt.Errorf("load: unsupported model version %d, expected %d", version, ModelVersion)
+	}
+	dec := binfmt.NewReader(payload)
+	return decodeLayer(dec)
+}
+
+// Saves the layers of the model, the loss layer is not saved
+func (s *Sequential) Save(w io.Writer) error {
+	return Save(w, s)
+}
+
+// Replaces the layers of the model with the ones saved in r, which must hold
+// a Sequential. The loss layer is kept
+func (s *Sequential) Load(r io.Reader) error {
+	model, err := Load(r)
+	if err != nil {
+		return err
+	}
+	loaded, ok := model.(*Sequential)
+	if !ok {
+		return fmt.Errorf("load: expected a Sequential got %T", model)
+	}
+	s.Layers = loaded.Layers
+	return nil
+}
+
+// Own tensors of l, containers save none since their children hold them
+func ownTensors(l Layer, children []Layer) ([]*Parameter, []*tensor.Tensor) {
+	if len(children) > 0 {
+		return nil, nil
+	}
+	var buffers []*tensor.Tensor
+	if b, ok := l.(BufferLayer); ok {
+		buffers = b.GetBuffers()
+	}
+	return l.GetParameters(), buffers
+}
+
+// Fewest bytes a saved tensor and a saved layer can take, a tensor is at least
+// its rank and a layer at least the lengths of its name and config and its
+// three counts
+const (
+	minTensorSize = 4
+	minLayerSize  = 8 + 8 + 3*4
+)
+
+// A layer is its name, JSON config, parameters, buffers and children
+func encodeLayer(enc *binfmt.Writer, l Layer) error {
+	name, ok := codecNames[reflect.TypeOf(l)]
+	if !ok {
+		return fmt.Errorf("save: layer type %T is not registered", l)
+	}
+	config, children, err := codecs[name].Config(l)
+	if err != nil {
+		return fmt.Errorf("save: %s: %w", name, err)
+	}
+	raw, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("save: %s: %w", name, err)
+	}
+	params, buffers := ownTensors(l, children)
+	enc.WriteString(name)
+	enc.WriteBytes(raw)
+	enc.WriteUint32(uint32(len(params)))
+	for _, p := range params {
+		enc.WriteTensor(p.Value)
+	}
+	enc.WriteUint32(uint32(len(buffers)))
+	for _, b := range buffers {
+		enc.WriteTensor(b)
+	}
+	enc.WriteUint32(uint32(len(children)))
+	for _, child := range children {
+		if err := encodeLayer(enc, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeLayer(dec *binfmt.Reader) (Layer, error) {
+	name := dec.ReadString()
+	raw := dec.ReadBytes()
+	values := make([]*tensor.Tensor, dec.ReadCount(minTensorSize))
+	for i := range values {
+		values[i] = dec.ReadTensor()
+	}
+	buffers := make([]*tensor.Tensor, dec.ReadCount(minTensorSize))
+	for i := range buffers {
+		buffers[i] = dec.ReadTensor()
+	}
+	children := make([]Layer, dec.ReadCount(minLayerSize))
+	if err := dec.Err(); err != nil {
+		return nil, fmt.Errorf("load: %w", err)
+	}
+	for i := range children {
+		child, err := decodeLayer(dec)
+		if err != nil {
+			return nil, err
+		}
+		children[i] = child
+	}
+
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("load: layer type %q is not registered", name)
+	}
+	l, err := codec.Build(raw, children)
+	if err != nil {
+		return nil, fmt.Errorf("load: %s: %w", name, err)
+	}
+	params, lBuffers := ownTensors(l, children)
+	if len(params) != len(values) || len(lBuffers) != len(buffers) {
+		return nil, fmt.Errorf("load: %s has %d parameters and %d buffers but %d and %d were saved", name, len(params), len(lBuffers), len(values), len(buffers))
+	}
+	for i, p := range params {
+		if !tensor.ShapesMatch(p.Value, values[i]) {
+			return nil, fmt.Errorf("load: %s parameter %d has shape %v but %v was saved", name, i, p.Value.Shape(), values[i].Shape())
+		}
+		p.Value = values[i]
+		p.Grad, _ = tensor.NewTensor(values[i].Shape()...)
+	}
+	for i, b := range lBuffers {
+		if !tensor.ShapesMatch(b, buffers[i]) || !b.IsContiguous() {
+			return nil, fmt.Errorf("load: %s buffer %d has shape %v but %v was saved", name, i, b.Shape(), buffers[i].Shape())
+		}
+		copy(b.Data(), buffers[i].Data())
+	}
+	return l, nil
+}
@@ -0,0 +1,173 @@
+package layers_test
+
+import (
+	"bytes"
+	"math"
+	"nnscratch/internal/binfmt"
+	"nnscratch/layers"
+	"nnscratch/tensor"
+	"strings"
+	"testing"
+)
+
+func saveAndLoad(t *testing.T, model layers.Layer, input *tensor.Tensor) {
+	t.Helper()
+	layers.SetTraining(model, false)
+	want, err := model.Forward(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = want.Copy()
+	var buf bytes.Buffer
+	if err := layers.Save(&buf, model); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := layers.Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers.SetTraining(loaded, false)
+	got, err := loaded.Forward(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotValues := got.Values()
+	for i, v := range want.Values() {
+		if math.Abs(v-gotValues[i]) > 1e-12 {
+			t.Fatalf("%T output %d is %v after loading, expected %v", model, i, gotValues[i], v)
+		}
+	}
+}
+
+func TestSaveRoundTrip(t *testing.T) {
+	x := randomInput(t, 4, 8)
+	bn := newBatchNorm1d(t, 8)
+	bn.Forward(x)
+	layerNorm, _ := layers.NewLayerNormLayer(true, 8)
+	rmsNorm, _ := layers.NewRMSNormLayer(false, 8)
+	dropout, _ := layers.NewDropoutLayer(0.3)
+	residual := layers.NewResidual(layers.NewDenseLayer(8, 8))
+	residual.Shortcut = layers.NewDenseLayer(8, 8)
+	saveAndLoad(t, layers.NewSequential(
+		layers.NewDenseLayer(8, 8), bn, newPReLU(t, 8, 0.1), dropout,
+		layerNorm, rmsNorm, residual,
+		layers.NewResidual(&layers.TanhLayer{}),
+		layers.NewParallel(&layers.TanhLayer{}, layers.NewLeakyReLULayer(0.2)),
+		layers.NewConcat(1, &layers.GELULayer{}, layers.NewELULayer(0.5)),
+		layers.NewSoftmaxLayer(-1)), x)
+
+	conv, _ := layers.NewConv2DLayer(layers.Conv2DConfig{InChannels: 3, OutChannels: 4, KernelSize: [2]int{3, 3}, Padding: [2]int{1, 1}})
+	bn2d, _ := layers.NewBatchNorm2dLayer(4)
+	gn, _ := layers.NewGroupNormLayer(2, 4, true)
+	saveAndLoad(t, layers.NewSequential(conv, bn2d, gn,
+		layers.NewMaxPool2DLayer(2, 0, 0), layers.NewAvgPool2DLayer(2, 1, 0), &layers.GlobalAvgPool2DLayer{}),
+		randomInput(t, 2, 3, 6, 6))
+
+	block, _ := layers.NewTransformerEncoderBlock(8, 2, 16, 0.1, true)
+	sinusoidal, _ := layers.NewSinusoidalPositionalEncoding(10, 8)
+	learned, _ := layers.NewLearnedPositionalEncoding(10, 8)
+	lstm, _ := layers.NewLSTMLayer(layers.RecurrentConfig{InputSize: 8, HiddenSize: 3, NumLayers: 2, Bidirectional: true, ReturnSequences: true})
+	saveAndLoad(t, layers.NewSequential(sinusoidal, learned, block, lstm), randomInput(t, 2, 5, 8))
+
+	indices, _ := tensor.NewTensorInput([][]float64{{0, 1, 2}, {3, 4, 0}})
+	embedding, _ := layers.NewEmbeddingLayer(5, 4, 0)
+	embedding.MaxNorm = 1
+	gru, _ := layers.NewGRULayer(layers.RecurrentConfig{InputSize: 4, HiddenSize: 3})
+	saveAndLoad(t, layers.NewSequential(embedding, gru), indices)
+}
+
+func TestLoadKeepsValues(t *testing.T) {
+	dense := layers.NewDenseLayer(2, 1)
+	copy(dense.Weights.Value.Data(), []float64{1, 2})
+	copy(dense.Bias.Value.Data(), []float64{3})
+	var buf bytes.Buffer
+	if err := layers.Save(&buf, dense); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := layers.Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1*1 + 2*-1 + 3
+	out, err := loaded.Forward(tensorOf(t, []float64{1, -1}, 1, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectValues(t, out, []int{1, 1}, []float64{2})
+}
+
+func TestSequentialLoadKeepsLoss(t *testing.T) {
+	var buf bytes.Buffer
+	if err := layers.NewSequential(layers.NewDenseLayer(3, 3)).Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	s := layers.NewSequential(layers.NewDenseLayer(3, 2))
+	s.LossLayer = &layers.MSELossLayer{}
+	if err := s.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Layers) != 1 || s.LossLayer == nil {
+		t.Errorf("got %d layers and loss %v, expected the loaded layer and the old loss", len(s.Layers), s.LossLayer)
+	}
+}
+
+// Frames a hand written payload like Save does
+func modelFile(enc *binfmt.Writer) *bytes.Reader {
+	var buf bytes.Buffer
+	binfmt.WriteFramed(&buf, "NNSC", layers.ModelVersion, enc.Payload())
+	return bytes.NewReader(buf.Bytes())
+}
+
+func writeLayerHeader(enc *binfmt.Writer, name, config string, params, buffers, children uint32) {
+	enc.WriteString(name)
+	enc.WriteBytes([]byte(config))
+	enc.WriteUint32(params)
+	enc.WriteUint32(buffers)
+	enc.WriteUint32(children)
+}
+
+func TestLoadRejectsBadFiles(t *testing.T) {
+	var buf bytes.Buffer
+	if err := layers.Save(&buf, layers.NewSequential(layers.NewLambdaLayer(nil, nil))); err == nil || !strings.Contains(err.Error(), "not registered") {
+		t.Errorf("saving a lambda layer gave %v, expected a not registered error", err)
+	}
+
+	buf.Reset()
+	layers.Save(&buf, layers.NewSequential(layers.NewDenseLayer(3, 2)))
+	corrupt := buf.Bytes()
+	corrupt[len(corrupt)-3] ^= 1
+
+	// a residual that claims a shortcut but only has its body
+	shortcutless := &binfmt.Writer{}
+	writeLayerHeader(shortcutless, "residual", `{"HasShortcut":true}`, 0, 0, 1)
+	writeLayerHeader(shortcutless, "tanh", `{}`, 0, 0, 0)
+	// and one without a shortcut that has two layers
+	extra := &binfmt.Writer{}
+	writeLayerHeader(extra, "residual", `{"HasShortcut":false}`, 0, 0, 2)
+	writeLayerHeader(extra, "tanh", `{}`, 0, 0, 0)
+	writeLayerHeader(extra, "tanh", `{}`, 0, 0, 0)
+	// counts far larger than the file must fail before allocating
+	manyParams := &binfmt.Writer{}
+	writeLayerHeader(manyParams, "dense", `{}`, math.MaxUint32, 0, 0)
+	manyChildren := &binfmt.Writer{}
+	writeLayerHeader(manyChildren, "sequential", `{}`, 0, 0, math.MaxUint32)
+
+	tests := []struct {
+		name string
+		file *bytes.Reader
+	}{
+		{"corrupt", bytes.NewReader(corrupt)},
+		{"bad magic", bytes.NewReader([]byte("garbage data here"))},
+		{"missing shortcut", modelFile(shortcutless)},
+		{"extra residual layer", modelFile(extra)},
+		{"parameter count", modelFile(manyParams)},
+		{"child count", modelFile(manyChildren)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := layers.Load(tt.file); err == nil {
+				t.Error("the file loaded")
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package layers
+
+import (
+	"fmt"
+	"math"
+	"nnscratch/tensor"
+)
+
+// Softmax over Axis, shifted by the max so large inputs do not overflow
+type SoftmaxLayer struct {
+	Axis   int // -1 is the last axis
+	output *tensor.Tensor
+}
+
+func NewSoftmaxLayer(axis int) *SoftmaxLayer {
+	return &SoftmaxLayer{Axis: axis}
+}
+
+func (s *SoftmaxLayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	res, err := softmax(input, s.Axis)
+	if err != nil {
+		return nil, err
+	}
+	s.output = res
+	return res, nil
+}
+
+// dx = y * (g - sum(g * y))
+func (s *SoftmaxLayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	if s.output == nil {
+		return nil, fmt.Errorf("softmax: backward called before forward")
+	}
+	gy, err := tensor.TensorMul(gradOutput, s.output)
+	if err != nil {
+		return nil, err
+	}
+	dot, err := gy.SumAxis(true, s.Axis)
+	if err != nil {
+		return nil, err
+	}
+	centered, err := tensor.TensorDiff(gradOutput, dot)
+	if err != nil {
+		return nil, err
+	}
+	return tensor.TensorMul(s.output, centered)
+}
+
+func (s *SoftmaxLayer) GetParameters() []*Parameter {
+	return []*Parameter{}
+}
+
+func (s *SoftmaxLayer) GetWeights() []*tensor.Tensor {
+	return nil
+}
+
+func (s *SoftmaxLayer) GetBiases() []*tensor.Tensor {
+	return nil
+}
+
+// Log of the softmax over Axis computed as x - logsumexp(x)
+type LogSoftmaxLayer struct {
+	Axis   int // -1 is the last axis
+	output *tensor.Tensor
+}
+
+func NewLogSoftmaxLayer(axis int) *LogSoftmaxLayer {
+	return &LogSoftmaxLayer{Axis: axis}
+}
+
+func (s *LogSoftmaxLayer) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	lse, err := input.LogSumExp(true, s.Axis)
+	if err != nil {
+		return nil, err
+	}
+	res, err := tensor.TensorDiff(input, lse)
+	if err != nil {
+		return nil, err
+	}
+	s.output = res
+	return res, nil
+}
+
+// dx = g - softmax * sum(g)
+func (s *LogSoftmaxLayer) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	if s.output == nil {
+		return nil, fmt.Errorf("logSoftmax: backward called before forward")
+	}
+	sum, err := gradOutput.SumAxis(true, s.Axis)
+	if err != nil {
+		return nil, err
+	}
+	probs, err := s.output.Apply(math.Exp)
+	if err != nil {
+		return nil, err
+	}
+	scaled, err := tensor.TensorMul(probs, sum)
+	if err != nil {
+		return nil, err
+	}
+	return tensor.TensorDiff(gradOutput, scaled)
+}
+
+func (s *LogSoftmaxLayer) GetParameters() []*Parameter {
+	return []*Parameter{}
+}
+
+func (s *LogSoftmaxLayer) GetWeights() []*tensor.Tensor {
+	return nil
+}
+
+func (s *LogSoftmaxLayer) GetBiases() []*tensor.Tensor {
+	return nil
+}
+
+// Softmax of t over axis
+func softmax(t *tensor.Tensor, axis int) (*tensor.Tensor, error) {
+	shift, err := t.Max(true, axis)
+	if err != nil {
+		return nil, err
+	}
+	shifted, err := tensor.TensorDiff(t, shift)
+	if err != nil {
+		return nil, err
+	}
+	exp, err := shifted.Apply(math.Exp)
+	if err != nil {
+		return nil, err
+	}
+	sum, err := exp.SumAxis(true, axis)
+	if err != nil {
+		return nil, err
+	}
+	return tensor.TensorDiv(exp, sum)
+}
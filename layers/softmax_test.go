@@ -0,0 +1,118 @@
+package layers_test
+
+import (
+	"fmt"
+	"math"
+	"nnscratch/gradcheck"
+	"nnscratch/layers"
+	"nnscratch/tensor"
+	"testing"
+)
+
+func TestSoftmaxGradients(t *testing.T) {
+	x, _ := randomInput(t, 3, 4, 2).MulScalar(2)
+	tests := []struct {
+		name  string
+		layer layers.Layer
+	}{
+		{"softmax", layers.NewSoftmaxLayer(1)},
+		{"log softmax", layers.NewLogSoftmaxLayer(-1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkLayer(t, tt.layer, x, gradcheck.DefaultOptions())
+		})
+	}
+}
+
+func TestCrossEntropyLoss(t *testing.T) {
+	logits, _ := tensor.NewTensorInput([][]float64{{1, 2, 0.5}, {0.1, -1, 2}})
+	indices, _ := tensor.NewTensorInput([]float64{1, 2})
+	oneHot, _ := tensor.NewTensorInput([][]float64{{0, 1, 0}, {0, 0, 1}})
+
+	want := 0.0
+	for r, c := range []int{1, 2} {
+		row := logits.Data()[r*3 : r*3+3]
+		sum := 0.0
+		for _, z := range row {
+			sum += math.Exp(z)
+		}
+		want -= (row[c] - math.Log(sum)) / 2
+	}
+	ce := layers.NewCrossEntropyLossLayer()
+	for name, target := range map[string]*tensor.Tensor{"indices": indices, "one hot": oneHot} {
+		got, err := ce.Loss(logits, target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(got-want) > 1e-12 {
+			t.Errorf("loss with %s targets %v, expected %v", name, got, want)
+		}
+	}
+}
+
+func TestCrossEntropyGradients(t *testing.T) {
+	logits, _ := tensor.NewTensorInput([][]float64{{1, 2, 0.5}, {0.1, -1, 2}})
+	indices, _ := tensor.NewTensorInput([]float64{1, 2})
+	oneHot, _ := tensor.NewTensorInput([][]float64{{0, 1, 0}, {0, 0, 1}})
+	losses := []*layers.CrossEntropyLossLayer{
+		layers.NewCrossEntropyLossLayer(),
+		{ClassWeights: []float64{0.2, 1, 3}, LabelSmoothing: 0.1},
+		{ClassWeights: []float64{0.2, 1, 3}, HasIgnoreIndex: true, IgnoreIndex: -100, LabelSmoothing: 0.3},
+	}
+	for i, ce := range losses {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			checkLoss(t, ce, logits, indices, gradcheck.DefaultOptions())
+			checkLoss(t, ce, logits, oneHot, gradcheck.DefaultOptions())
+		})
+	}
+
+	// (N, C, L) logits with a padded target that is ignored
+	sequence := randomInput(t, 2, 3, 4)
+	targets, _ := tensor.NewTensorInput([][]float64{{0, 1, 2, 1}, {2, 2, 0, -100}})
+	checkLoss(t, losses[2], sequence, targets, gradcheck.DefaultOptions())
+}
+
+func TestSoftmaxForward(t *testing.T) {
+	// exp of these is 1, 2, 3 so the softmax is 1/6, 2/6, 3/6
+	x := tensorOf(t, []float64{0, math.Log(2), math.Log(3), 5, 5, 5}, 2, 3)
+	out, err := layers.NewSoftmaxLayer(1).Forward(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectValues(t, out, []int{2, 3}, []float64{1.0 / 6, 2.0 / 6, 3.0 / 6, 1.0 / 3, 1.0 / 3, 1.0 / 3})
+
+	out, err = layers.NewLogSoftmaxLayer(-1).Forward(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	third := math.Log(1.0 / 3)
+	expectValues(t, out, []int{2, 3}, []float64{math.Log(1.0 / 6), math.Log(2.0 / 6), math.Log(3.0 / 6), third, third, third})
+}
+
+func TestCrossEntropyIgnoreIndex(t *testing.T) {
+	// exp of the scores is 1, 2, 3 in both rows
+	logits := tensorOf(t, []float64{0, math.Log(2), math.Log(3), 0, math.Log(2), math.Log(3)}, 2, 3)
+	targets := tensorOf(t, []float64{0, 2}, 2)
+	tests := []struct {
+		name string
+		ce   *layers.CrossEntropyLossLayer
+		want float64
+	}{
+		// the zero value ignores nothing, so class 0 counts
+		{"ignore nothing", &layers.CrossEntropyLossLayer{}, -(math.Log(1.0/6) + math.Log(3.0/6)) / 2},
+		{"ignore class 0", &layers.CrossEntropyLossLayer{HasIgnoreIndex: true}, -math.Log(3.0 / 6)},
+		{"ignore class 2", &layers.CrossEntropyLossLayer{HasIgnoreIndex: true, IgnoreIndex: 2}, -math.Log(1.0 / 6)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.ce.Loss(logits, targets)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("loss %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
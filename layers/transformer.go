@@ -0,0 +1,150 @@
+package layers
+
+import (
+	"fmt"
+	"nnscratch/tensor"
+)
+
+// Post-norm transformer encoder block over (batch, seq, embed) inputs,
+// h = norm1(x + attention(x)) and out = norm2(h + ff(h)) where the feed
+// forward network is dense -> gelu -> dense. Both residual branches go through
+// dropout
+type TransformerEncoderBlock struct {
+	Attention *MultiHeadAttention
+	Norm1     *LayerNormLayer
+	FF1       *DenseLayer
+	FFAct     *GELULayer
+	FF2       *DenseLayer
+	Norm2     *LayerNormLayer
+	Dropout1  *DropoutLayer
+	Dropout2  *DropoutLayer
+}
+
+func NewTransformerEncoderBlock(embedDim, numHeads, ffDim int, dropout float64, causal bool) (*TransformerEncoderBlock, error) {
+	if ffDim <= 0 {
+		return nil, fmt.Errorf("transformer: feed forward dim must be positive got %d", ffDim)
+	}
+	attention, err := NewMultiHeadAttention(embedDim, numHeads, causal)
+	if err != nil {
+		return nil, err
+	}
+	drop1, err := NewDropoutLayer(dropout)
+	if err != nil {
+		return nil, err
+	}
+	drop2, _ := NewDropoutLayer(dropout)
+	norm1, err := NewLayerNormLayer(true, embedDim)
+	if err != nil {
+		return nil, fmt.Errorf("transformer: %w", err)
+	}
+	norm2, _ := NewLayerNormLayer(true, embedDim)
+	return &TransformerEncoderBlock{
+		Attention: attention,
+		Norm1:     norm1,
+		FF1:       NewDenseLayer(embedDim, ffDim),
+		FFAct:     &GELULayer{},
+		FF2:       NewDenseLayer(ffDim, embedDim),
+		Norm2:     norm2,
+		Dropout1:  drop1,
+		Dropout2:  drop2,
+	}, nil
+}
+
+// Passes the key padding mask on to the attention
+func (t *TransformerEncoderBlock) SetKeyPaddingMask(mask *tensor.Tensor) {
+	t.Attention.SetKeyPaddingMask(mask)
+}
+
+func (t *TransformerEncoderBlock) SetTraining(training bool) {
+	t.Dropout1.SetTraining(training)
+	t.Dropout2.SetTraining(training)
+}
+
+// Runs the layers one after another
+func forwardChain(input *tensor.Tensor, chain ...Layer) (*tensor.Tensor, error) {
+	out := input
+	var err error
+	for _, layer := range chain {
+		out, err = layer.Forward(out)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// Backpropagates through the layers of forwardChain in reverse
+func backwardChain(grad *tensor.Tensor, lr float64, chain ...Layer) (*tensor.Tensor, error) {
+	var err error
+	for i := len(chain) - 1; i >= 0; i-- {
+		grad, err = chain[i].Backward(grad, lr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return grad, nil
+}
+
+func (t *TransformerEncoderBlock) Forward(input *tensor.Tensor) (*tensor.Tensor, error) {
+	attended, err := forwardChain(input, t.Attention, t.Dropout1)
+	if err != nil {
+		return nil, err
+	}
+	h, err := tensor.TensorAdd(input, attended)
+	if err != nil {
+		return nil, err
+	}
+	h, err = t.Norm1.Forward(h)
+	if err != nil {
+		return nil, err
+	}
+	ff, err := forwardChain(h, t.FF1, t.FFAct, t.FF2, t.Dropout2)
+	if err != nil {
+		return nil, err
+	}
+	out, err := tensor.TensorAdd(h, ff)
+	if err != nil {
+		return nil, err
+	}
+	return t.Norm2.Forward(out)
+}
+
+func (t *TransformerEncoderBlock) Backward(gradOutput *tensor.Tensor, lr float64) (*tensor.Tensor, error) {
+	grad, err := t.Norm2.Backward(gradOutput, lr)
+	if err != nil {
+		return nil, err
+	}
+	dff, err := backwardChain(grad, lr, t.FF1, t.FFAct, t.FF2, t.Dropout2)
+	if err != nil {
+		return nil, err
+	}
+	grad, err = tensor.TensorAdd(grad, dff)
+	if err != nil {
+		return nil, err
+	}
+	grad, err = t.Norm1.Backward(grad, lr)
+	if err != nil {
+		return nil, err
+	}
+	dAttention, err := backwardChain(grad, lr, t.Attention, t.Dropout1)
+	if err != nil {
+		return nil, err
+	}
+	return tensor.TensorAdd(grad, dAttention)
+}
+
+func (t *TransformerEncoderBlock) layers() []Layer {
+	return []Layer{t.Attention, t.Norm1, t.FF1, t.FF2, t.Norm2}
+}
+
+func (t *TransformerEncoderBlock) GetParameters() []*Parameter {
+	return collectParameters(t.layers())
+}
+
+func (t *TransformerEncoderBlock) GetWeights() []*tensor.Tensor {
+	return collectWeights(t.layers())
+}
+
+func (t *TransformerEncoderBlock) GetBiases() []*tensor.Tensor {
+	return collectBiases(t.layers())
+}
@@ -0,0 +1,41 @@
+package layers_test
+
+import (
+	"nnscratch/gradcheck"
+	"nnscratch/layers"
+	"testing"
+)
+
+func TestTransformerEncoderBlockGradients(t *testing.T) {
+	// the key bias has no effect through the softmax, its exactly zero
+	// gradient is compared with finite differences of a deep stack that
+	// round to about 1e-7
+	opts := gradcheck.DefaultOptions()
+	opts.AbsTolerance = 1e-6
+	for _, causal := range []bool{false, true} {
+		block, err := layers.NewTransformerEncoderBlock(6, 2, 8, 0, causal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scaleParameters(t, block, 50)
+		checkLayer(t, block, randomInput(t, 2, 4, 6), opts)
+	}
+}
+
+func TestTransformerEncoderBlockForward(t *testing.T) {
+	block, err := layers.NewTransformerEncoderBlock(2, 1, 3, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// with the attention and the feed forward network zeroed both residual
+	// branches add nothing and the block is two layer norms
+	scaleParameters(t, block.Attention, 0)
+	scaleParameters(t, block.FF1, 0)
+	scaleParameters(t, block.FF2, 0)
+	block.Norm1.Eps, block.Norm2.Eps = 0, 0
+	out, err := block.Forward(tensorOf(t, []float64{1, 3, 0, -4}, 1, 2, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectValues(t, out, []int{1, 2, 2}, []float64{-1, 1, 1, -1})
+}
@@ -73,23 +73,26 @@ func BCE(a *tensor.Tensor, b *tensor.Tensor) (float64, error) {
 	return result, nil
 }
 
+// Diffrention of the BCE function with respect to the prediction b
 func DiffBCE(a *tensor.Tensor, b *tensor.Tensor) (*tensor.Tensor, error) {
 	result, err := tensor.NewTensor(a.Shape()...)
 	if err != nil {
 		return nil, err
 	}
-	for i := range a.Data() {
-		if a.Data()[i] > 1 || b.Data()[i] > 1 {
+	actual, pred := a.Values(), b.Values()
+	for i := range actual {
+		if actual[i] > 1 || pred[i] > 1 {
 			return nil, fmt.Errorf("diffBCE: The value in either tensor is more than one")
 		}
-		y := a.Data()[i]
-		y_pred := b.Data()[i]
+		y := actual[i]
+		y_pred := pred[i]
 		if y_pred < 1e-9 {
 			y_pred = 1e-9
 		} else if y_pred > 1-1e-9 {
 			y_pred = 1 - 1e-9
 		}
-		result.Data()[i] = (y_pred - y) / (y_pred * (1 - y_pred))
+		// BCE is a mean so every term is divided by the number of values
+		result.Data()[i] = (y_pred - y) / (y_pred * (1 - y_pred)) / float64(a.Len())
 	}
 	return result, nil
 }
@@ -102,14 +102,14 @@ func main() {
 			if err != nil {
 				panic(err)
 			}
-			loss, err := model.LossLayer.Loss(yBatch, prediction)
+			loss, err := model.LossLayer.Loss(prediction, yBatch)
 			sumloss += loss
 			if err != nil {
 				panic(err)
 			}
 
 			diff, _ := model.LossLayer.Diffrential()
-			err = model.Backward(diff, 0)
+			_, err = model.Backward(diff, 0)
 			if err != nil {
 				panic(err)
 			}
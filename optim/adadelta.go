@@ -0,0 +1,97 @@
+package optim
+
+import (
+	"math"
+	"nnscratch/layers"
+	"nnscratch/tensor"
+)
+
+// Adadelta scales the gradient by the ratio of the running root mean squares
+// of past updates and past gradients, so the step size needs little tuning and
+// LR is usually left at 1
+type Adadelta struct {
+	Parameters  []*layers.Parameter
+	LR          float64
+	Rho         float64
+	Epsilon     float64
+	WeightDecay float64
+	SquareAvg   []*tensor.Tensor // running average of squared gradients
+	DeltaAvg    []*tensor.Tensor // running average of squared updates
+}
+
+// Defaults to rho 0.9 and epsilon 1e-6, takes WithRho, WithEpsilon and
+// WithWeightDecay
+func NewAdadelta(params []*layers.Parameter, lr float64, opts ...Option) *Adadelta {
+	o := applyOptions(options{rho: 0.9, epsilon: 1e-6}, opts)
+	return &Adadelta{
+		Parameters:  params,
+		LR:          lr,
+		Rho:         o.rho,
+		Epsilon:     o.epsilon,
+		WeightDecay: o.weightDecay,
+		SquareAvg:   filledLike(params, 0),
+		DeltaAvg:    filledLike(params, 0),
+	}
+}
+
+func (a *Adadelta) Step() error {
+	for i, p := range a.Parameters {
+		if p.Grad == nil {
+			continue
+		}
+		value, err := paramData(p)
+		if err != nil {
+			return err
+		}
+		sq, acc := a.SquareAvg[i].Data(), a.DeltaAvg[i].Data()
+		for j, g := range p.Grad.Values() {
+			g += a.WeightDecay * value[j]
+			sq[j] = a.Rho*sq[j] + (1-a.Rho)*g*g
+			delta := math.Sqrt(acc[j]+a.Epsilon) / math.Sqrt(sq[j]+a.Epsilon) * g
+			acc[j] = a.Rho*acc[j] + (1-a.Rho)*delta*delta
+			value[j] -= a.LR * delta
+		}
+	}
+	return nil
+}
+
+func (a *Adadelta) ZeroGrad() {
+	zeroGrads(a.Parameters)
+}
+
+func (a *Adadelta) GetLR() float64 {
+	return a.LR
+}
+
+func (a *Adadelta) SetLR(lr float64) {
+	a.LR = lr
+}
+
+func (a *Adadelta) StateDict() State {
+	state := newState()
+	state.Scalars["lr"] = a.LR
+	state.Scalars["rho"] = a.Rho
+	state.Scalars["epsilon"] = a.Epsilon
+	state.Scalars["weightDecay"] = a.WeightDecay
+	state.Tensors["squareAvg"] = cloneTensors(a.SquareAvg)
+	state.Tensors["deltaAvg"] = cloneTensors(a.DeltaAvg)
+	return state
+}
+
+func (a *Adadelta) LoadStateDict(state State) error {
+	scalars, err := state.scalars("lr", "rho", "epsilon", "weightDecay")
+	if err != nil {
+		return err
+	}
+	sq, err := state.tensors("squareAvg", a.Parameters)
+	if err != nil {
+		return err
+	}
+	acc, err := state.tensors("deltaAvg", a.Parameters)
+	if err != nil {
+		return err
+	}
+	a.LR, a.Rho, a.Epsilon, a.WeightDecay = scalars[0], scalars[1], scalars[2], scalars[3]
+	a.SquareAvg, a.DeltaAvg = sq, acc
+	return nil
+}
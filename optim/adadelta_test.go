@@ -0,0 +1,39 @@
+package optim
+
+import (
+	"math"
+	"nnscratch/layers"
+	"testing"
+)
+
+func TestAdadeltaFirstStep(t *testing.T) {
+	// with g = 2 the square average is 2, the update is
+	// sqrt(0 + 0.25) / sqrt(2 + 0.25) * 2 = 2/3
+	p := param(t, 2)
+	minimize(t, NewAdadelta([]*layers.Parameter{p}, 1, WithRho(0.5), WithEpsilon(0.25)), p, 1)
+	expectClose(t, p.Value.Data(), []float64{4.0 / 3}, 1e-15)
+}
+
+func TestAdadeltaMatchesReference(t *testing.T) {
+	p := param(t, 1, -2)
+	minimize(t, NewAdadelta([]*layers.Parameter{p}, 0.5, WithWeightDecay(0.1)), p, 5)
+
+	x := []float64{1, -2}
+	sq, acc := make([]float64, 2), make([]float64, 2)
+	for step := 0; step < 5; step++ {
+		for j := range x {
+			g := x[j] + 0.1*x[j]
+			sq[j] = 0.9*sq[j] + 0.1*g*g
+			delta := math.Sqrt(acc[j]+1e-6) / math.Sqrt(sq[j]+1e-6) * g
+			acc[j] = 0.9*acc[j] + 0.1*delta*delta
+			x[j] -= 0.5 * delta
+		}
+	}
+	expectClose(t, p.Value.Data(), x, 1e-15)
+}
+
+func TestAdadeltaStateDict(t *testing.T) {
+	expectStateRoundTrip(t, func(params []*layers.Parameter) Optimizer {
+		return NewAdadelta(params, 1)
+	})
+}
@@ -0,0 +1,92 @@
+package optim
+
+import (
+	"math"
+	"nnscratch/layers"
+	"nnscratch/tensor"
+)
+
+// Adagrad divides the gradient by the root of the sum of all past squared
+// gradients, so often updated weights take smaller steps
+type Adagrad struct {
+	Parameters  []*layers.Parameter
+	LR          float64
+	LRDecay     float64
+	Epsilon     float64
+	WeightDecay float64
+	T           int
+	Sum         []*tensor.Tensor
+}
+
+// Defaults to epsilon 1e-10, no learning rate decay and sums starting at 0,
+// takes WithLRDecay, WithInitialAccumulator, WithEpsilon and WithWeightDecay
+func NewAdagrad(params []*layers.Parameter, lr float64, opts ...Option) *Adagrad {
+	o := applyOptions(options{epsilon: 1e-10}, opts)
+	return &Adagrad{
+		Parameters:  params,
+		LR:          lr,
+		LRDecay:     o.lrDecay,
+		Epsilon:     o.epsilon,
+		WeightDecay: o.weightDecay,
+		Sum:         filledLike(params, o.initialSum),
+	}
+}
+
+func (a *Adagrad) Step() error {
+	a.T++
+	lr := a.LR / (1 + float64(a.T-1)*a.LRDecay)
+	for i, p := range a.Parameters {
+		if p.Grad == nil {
+			continue
+		}
+		value, err := paramData(p)
+		if err != nil {
+			return err
+		}
+		sum := a.Sum[i].Data()
+		for j, g := range p.Grad.Values() {
+			g += a.WeightDecay * value[j]
+			sum[j] += g * g
+			value[j] -= lr * g / (math.Sqrt(sum[j]) + a.Epsilon)
+		}
+	}
+	return nil
+}
+
+func (a *Adagrad) ZeroGrad() {
+	zeroGrads(a.Parameters)
+}
+
+func (a *Adagrad) GetLR() float64 {
+	return a.LR
+}
+
+func (a *Adagrad) SetLR(lr float64) {
+	a.LR = lr
+}
+
+func (a *Adagrad) StateDict() State {
+	state := newState()
+	state.Scalars["lr"] = a.LR
+	state.Scalars["lrDecay"] = a.LRDecay
+	state.Scalars["epsilon"] = a.Epsilon
+	state.Scalars["weightDecay"] = a.WeightDecay
+	state.Scalars["t"] = float64(a.T)
+	state.Tensors["sum"] = cloneTensors(a.Sum)
+	return state
+}
+
+func (a *Adagrad) LoadStateDict(state State) error {
+	scalars, err := state.scalars("lr", "lrDecay", "epsilon", "weightDecay", "t")
+	if err != nil {
+		return err
+	}
+	sum, err := state.tensors("sum", a.Parameters)
+	if err != nil {
+		return err
+	}
+	a.LR, a.LRDecay, a.Epsilon, a.WeightDecay = scalars[0], scalars[1], scalars[2], scalars[3]
+	a.T = int(scalars[4])
+	a.Sum = sum
+	return nil
+}
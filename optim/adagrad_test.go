@@ -0,0 +1,37 @@
+package optim
+
+import (
+	"math"
+	"nnscratch/layers"
+	"testing"
+)
+
+func TestAdagradFirstStep(t *testing.T) {
+	// the sum is g^2, so the first step is lr * sign(g)
+	p := param(t, 1, -2)
+	minimize(t, NewAdagrad([]*layers.Parameter{p}, 0.5, WithEpsilon(0)), p, 1)
+	expectClose(t, p.Value.Data(), []float64{0.5, -1.5}, 1e-15)
+}
+
+func TestAdagradMatchesReference(t *testing.T) {
+	p := param(t, 1, -2)
+	minimize(t, NewAdagrad([]*layers.Parameter{p}, 0.5, WithLRDecay(0.1), WithInitialAccumulator(0.2), WithWeightDecay(0.1)), p, 5)
+
+	x := []float64{1, -2}
+	sum := []float64{0.2, 0.2}
+	for step := 1; step <= 5; step++ {
+		lr := 0.5 / (1 + float64(step-1)*0.1)
+		for j := range x {
+			g := x[j] + 0.1*x[j]
+			sum[j] += g * g
+			x[j] -= lr * g / (math.Sqrt(sum[j]) + 1e-10)
+		}
+	}
+	expectClose(t, p.Value.Data(), x, 1e-15)
+}
+
+func TestAdagradStateDict(t *testing.T) {
+	expectStateRoundTrip(t, func(params []*layers.Parameter) Optimizer {
+		return NewAdagrad(params, 0.5, WithLRDecay(0.1))
+	})
+}
@@ -1,78 +1,155 @@
 package optim 
 
 import (
+	"math"
 	"nnscratch/layers"
 	"nnscratch/tensor"
-	"nnscratch/maths"
 )
 
 
+// Adam with bias corrected moments. WeightDecay is an L2 penalty added to the
+// gradient, unless Decoupled where, as in AdamW, the weights shrink by
+// lr*WeightDecay apart from the adaptive step. AMSGrad divides by the largest
+// second moment seen so far
 type Adam struct {
 	Parameters []*layers.Parameter
 	LR float64
 	Beta_1 float64
 	Beta_2 float64
-	epsilon float64
+	Epsilon float64
+	WeightDecay float64
+	Decoupled bool
+	AMSGrad bool
 	T int 
 	M []*tensor.Tensor
 	V []*tensor.Tensor
+	MaxV []*tensor.Tensor // nil without AMSGrad
 }
 
-func NewAdam(params []*layers.Parameter, lr float64) *Adam {
-	m := make([]*tensor.Tensor, len(params))
-	v := make([]*tensor.Tensor, len(params))
-	for i, p := range params {
-		m[i], _ = tensor.NewTensor(p.Value.Shape()...)
-		v[i], _ = tensor.NewTensor(p.Value.Shape()...)
-	}
-	return &Adam{
+// Defaults to betas 0.9 and 0.999, epsilon 1e-8 and no weight decay, takes
+// WithBetas, WithEpsilon, WithWeightDecay and WithAMSGrad
+func NewAdam(params []*layers.Parameter, lr float64, opts ...Option) *Adam {
+	return newAdam(params, lr, false, applyOptions(options{beta1: 0.9, beta2: 0.999, epsilon: 1e-8}, opts))
+}
+
+// AdamW, Adam with decoupled weight decay. Defaults like NewAdam but with a
+// weight decay of 0.01
+func NewAdamW(params []*layers.Parameter, lr float64, opts ...Option) *Adam {
+	return newAdam(params, lr, true, applyOptions(options{beta1: 0.9, beta2: 0.999, epsilon: 1e-8, weightDecay: 0.01}, opts))
+}
+
+func newAdam(params []*layers.Parameter, lr float64, decoupled bool, o options) *Adam {
+	a := &Adam{
 		Parameters: params,
 		LR: lr,
-		Beta_1: 0.9,
-		Beta_2: 0.99,
-		epsilon: 1e-8,
+		Beta_1: o.beta1,
+		Beta_2: o.beta2,
+		Epsilon: o.epsilon,
+		WeightDecay: o.weightDecay,
+		Decoupled: decoupled,
+		AMSGrad: o.amsgrad,
 		T: 0,
-		M: m,
-		V: v,
+		M: filledLike(params, 0),
+		V: filledLike(params, 0),
+	}
+	if a.AMSGrad {
+		a.MaxV = filledLike(params, 0)
 	}
+	return a
 }
 
 func (a *Adam) Step() error {
 	a.T++ 
+	step := a.LR / (1 - math.Pow(a.Beta_1, float64(a.T)))
+	correction2 := math.Sqrt(1 - math.Pow(a.Beta_2, float64(a.T)))
+	if a.AMSGrad && len(a.MaxV) != len(a.Parameters) {
+		a.MaxV = filledLike(a.Parameters, 0)
+	}
 	for i, p := range a.Parameters {
-		term1m, _ := a.M[i].MulScalar(a.Beta_1) 
-		term2m, _ := p.Grad.MulScalar(1-a.Beta_1)
-		a.M[i], _ = tensor.TensorAdd(term1m, term2m)
-
-		term1v, _ := a.V[i].MulScalar(a.Beta_2)
-		grad_square, _ := p.Grad.Power(2)
-		term2v, _ := grad_square.MulScalar(1-a.Beta_2)
-		a.V[i], _ = tensor.TensorAdd(term1v, term2v)
-		
-		mcap, _ := a.M[i].MulScalar(1.0/(1 - maths.Power(a.Beta_1, float64(a.T))))
-		vcap, _ := a.V[i].MulScalar(1.0/(1 - maths.Power(a.Beta_2, float64(a.T))))
-		
-		vroot, _ := vcap.Power(0.5)
-		vroot, _ = vroot.AddScalar(a.epsilon)
-		division, _ := tensor.TensorDiv(mcap, vroot)
-		update, err := division.MulScalar(a.LR)
-		if err != nil {
-			return err
+		if p.Grad == nil {
+			continue
 		}
-		p.Value, err = tensor.TensorDiff(p.Value, update)
+		value, err := paramData(p)
 		if err != nil {
 			return err
-		}	
+		}
+		m, v := a.M[i].Data(), a.V[i].Data()
+		var maxV []float64
+		if a.AMSGrad {
+			maxV = a.MaxV[i].Data()
+		}
+		for j, g := range p.Grad.Values() {
+			if a.Decoupled {
+				value[j] *= 1 - a.LR*a.WeightDecay
+			} else {
+				g += a.WeightDecay * value[j]
+			}
+			m[j] = a.Beta_1*m[j] + (1-a.Beta_1)*g
+			v[j] = a.Beta_2*v[j] + (1-a.Beta_2)*g*g
+			second := v[j]
+			if a.AMSGrad {
+				maxV[j] = math.Max(maxV[j], v[j])
+				second = maxV[j]
+			}
+			value[j] -= step * m[j] / (math.Sqrt(second)/correction2 + a.Epsilon)
+		}
 	}
 	return nil
 }
 
 func (a *Adam) ZeroGrad() {
-		for _, p := range a.Parameters {
-		if p.Grad != nil {
-			for i := range p.Grad.Data() {
-				p.Grad.Data()[i] = 0
-			}
+	zeroGrads(a.Parameters)
+}
+
+func (a *Adam) GetLR() float64 {
+	return a.LR
+}
+
+func (a *Adam) SetLR(lr float64) {
+	a.LR = lr
+}
+
+func (a *Adam) StateDict() State {
+	state := newState()
+	state.Scalars["lr"] = a.LR
+	state.Scalars["beta1"] = a.Beta_1
+	state.Scalars["beta2"] = a.Beta_2
+	state.Scalars["epsilon"] = a.Epsilon
+	state.Scalars["weightDecay"] = a.WeightDecay
+	state.Scalars["decoupled"] = flag(a.Decoupled)
+	state.Scalars["amsgrad"] = flag(a.AMSGrad)
+	state.Scalars["t"] = float64(a.T)
+	state.Tensors["m"] = cloneTensors(a.M)
+	state.Tensors["v"] = cloneTensors(a.V)
+	if a.AMSGrad {
+		state.Tensors["maxV"] = cloneTensors(a.MaxV)
+	}
+	return state
+}
+
+func (a *Adam) LoadStateDict(state State) error {
+	scalars, err := state.scalars("lr", "beta1", "beta2", "epsilon", "weightDecay", "decoupled", "amsgrad", "t")
+	if err != nil {
+		return err
+	}
+	m, err := state.tensors("m", a.Parameters)
+	if err != nil {
+		return err
+	}
+	v, err := state.tensors("v", a.Parameters)
+	if err != nil {
+		return err
+	}
+	var maxV []*tensor.Tensor
+	if scalars[6] != 0 {
+		maxV, err = state.tensors("maxV", a.Parameters)
+		if err != nil {
+			return err
 		}
 	}
+	a.LR, a.Beta_1, a.Beta_2, a.Epsilon, a.WeightDecay = scalars[0], scalars[1], scalars[2], scalars[3], scalars[4]
+	a.Decoupled, a.AMSGrad = scalars[5] != 0, scalars[6] != 0
+	a.T = int(scalars[7])
+	a.M, a.V, a.MaxV = m, v, maxV
+	return nil
 }
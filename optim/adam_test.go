@@ -0,0 +1,116 @@
+package optim
+
+import (
+	"math"
+	"nnscratch/layers"
+	"testing"
+)
+
+func TestAdamDefaults(t *testing.T) {
+	adam := NewAdam(nil, 0.1)
+	if adam.Beta_1 != 0.9 || adam.Beta_2 != 0.999 || adam.Epsilon != 1e-8 || adam.WeightDecay != 0 || adam.Decoupled || adam.AMSGrad {
+		t.Errorf("adam defaults %+v", adam)
+	}
+	adamW := NewAdamW(nil, 0.1)
+	if adamW.Beta_1 != 0.9 || adamW.Beta_2 != 0.999 || adamW.Epsilon != 1e-8 || adamW.WeightDecay != 0.01 || !adamW.Decoupled || adamW.AMSGrad {
+		t.Errorf("adamW defaults %+v", adamW)
+	}
+}
+
+func TestAdamFirstStep(t *testing.T) {
+	// the bias corrected moments are g and g^2, so the step is lr * sign(g)
+	p := param(t, 1, -2)
+	minimize(t, NewAdam([]*layers.Parameter{p}, 0.1, WithEpsilon(0)), p, 1)
+	expectClose(t, p.Value.Data(), []float64{0.9, -1.9}, 1e-15)
+
+	// AdamW shrinks the weights by 1 - lr*decay first
+	p = param(t, 1, -2)
+	minimize(t, NewAdamW([]*layers.Parameter{p}, 0.1, WithEpsilon(0), WithWeightDecay(0.5)), p, 1)
+	expectClose(t, p.Value.Data(), []float64{0.85, -1.8}, 1e-15)
+}
+
+func TestAdamMatchesReference(t *testing.T) {
+	tests := []struct {
+		name    string
+		amsgrad bool
+		adamW   bool
+	}{
+		{"adam", false, false},
+		{"amsgrad", true, false},
+		{"adamW", false, true},
+		{"adamW with amsgrad", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []Option{WithBetas(0.8, 0.95), WithEpsilon(1e-6)}
+			if tt.amsgrad {
+				opts = append(opts, WithAMSGrad())
+			}
+			p := param(t, 1, -2)
+			var adam *Adam
+			if tt.adamW {
+				adam = NewAdamW([]*layers.Parameter{p}, 0.1, opts...)
+			} else {
+				adam = NewAdam([]*layers.Parameter{p}, 0.1, append(opts, WithWeightDecay(0.05))...)
+			}
+
+			x := []float64{1, -2}
+			m, v, maxV := make([]float64, 2), make([]float64, 2), make([]float64, 2)
+			for step := 1; step <= 20; step++ {
+				// gradients that shrink and grow, so the largest second
+				// moment is not the latest one
+				grads := make([]float64, 2)
+				for j := range grads {
+					grads[j] = math.Sin(float64(step*(j+1))) * p.Value.Data()[j]
+				}
+				copy(p.Grad.Data(), grads)
+				if err := adam.Step(); err != nil {
+					t.Fatal(err)
+				}
+				for j, g := range grads {
+					if tt.adamW {
+						x[j] *= 1 - 0.1*0.01
+					} else {
+						g += 0.05 * x[j]
+					}
+					m[j] = 0.8*m[j] + 0.2*g
+					v[j] = 0.95*v[j] + 0.05*g*g
+					maxV[j] = math.Max(maxV[j], v[j])
+					second := v[j]
+					if tt.amsgrad {
+						second = maxV[j]
+					}
+					mHat := m[j] / (1 - math.Pow(0.8, float64(step)))
+					vHat := second / (1 - math.Pow(0.95, float64(step)))
+					x[j] -= 0.1 * mHat / (math.Sqrt(vHat) + 1e-6)
+				}
+			}
+			expectClose(t, p.Value.Data(), x, 1e-12)
+		})
+	}
+}
+
+func TestAdamKeepsMaxVOnlyWithAMSGrad(t *testing.T) {
+	p := param(t, 1, -2)
+	adam := NewAdam([]*layers.Parameter{p}, 0.1)
+	minimize(t, adam, p, 2)
+	if _, ok := adam.StateDict().Tensors["maxV"]; adam.MaxV != nil || ok {
+		t.Errorf("adam without amsgrad keeps a max second moment")
+	}
+
+	amsgrad := NewAdam([]*layers.Parameter{p}, 0.1, WithAMSGrad())
+	minimize(t, amsgrad, p, 2)
+	if _, ok := amsgrad.StateDict().Tensors["maxV"]; len(amsgrad.MaxV) != 1 || !ok {
+		t.Errorf("amsgrad does not keep its max second moment")
+	}
+}
+
+func TestAdamStateDict(t *testing.T) {
+	for _, amsgrad := range []bool{false, true} {
+		expectStateRoundTrip(t, func(params []*layers.Parameter) Optimizer {
+			adam := NewAdamW(params, 0.1)
+			adam.AMSGrad = amsgrad
+			return adam
+		})
+	}
+}
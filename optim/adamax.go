@@ -0,0 +1,103 @@
+package optim
+
+import (
+	"math"
+	"nnscratch/layers"
+	"nnscratch/tensor"
+)
+
+// Adamax is Adam with the second moment replaced by an exponentially weighted
+// infinity norm of the gradients, u = max(beta2*u, |g|)
+type Adamax struct {
+	Parameters  []*layers.Parameter
+	LR          float64
+	Beta1       float64
+	Beta2       float64
+	Epsilon     float64
+	WeightDecay float64
+	T           int
+	M           []*tensor.Tensor
+	U           []*tensor.Tensor
+}
+
+// Defaults to betas 0.9 and 0.999 and epsilon 1e-8, takes WithBetas,
+// WithEpsilon and WithWeightDecay
+func NewAdamax(params []*layers.Parameter, lr float64, opts ...Option) *Adamax {
+	o := applyOptions(options{beta1: 0.9, beta2: 0.999, epsilon: 1e-8}, opts)
+	return &Adamax{
+		Parameters:  params,
+		LR:          lr,
+		Beta1:       o.beta1,
+		Beta2:       o.beta2,
+		Epsilon:     o.epsilon,
+		WeightDecay: o.weightDecay,
+		M:           filledLike(params, 0),
+		U:           filledLike(params, 0),
+	}
+}
+
+func (a *Adamax) Step() error {
+	a.T++
+	lr := a.LR / (1 - math.Pow(a.Beta1, float64(a.T)))
+	for i, p := range a.Parameters {
+		if p.Grad == nil {
+			continue
+		}
+		value, err := paramData(p)
+		if err != nil {
+			return err
+		}
+		m, u := a.M[i].Data(), a.U[i].Data()
+		for j, g := range p.Grad.Values() {
+			g += a.WeightDecay * value[j]
+			m[j] = a.Beta1*m[j] + (1-a.Beta1)*g
+			u[j] = math.Max(a.Beta2*u[j], math.Abs(g)+a.Epsilon)
+			value[j] -= lr * m[j] / u[j]
+		}
+	}
+	return nil
+}
+
+func (a *Adamax) ZeroGrad() {
+	zeroGrads(a.Parameters)
+}
+
+func (a *Adamax) GetLR() float64 {
+	return a.LR
+}
+
+func (a *Adamax) SetLR(lr float64) {
+	a.LR = lr
+}
+
+func (a *Adamax) StateDict() State {
+	state := newState()
+	state.Scalars["lr"] = a.LR
+	state.Scalars["beta1"] = a.Beta1
+	state.Scalars["beta2"] = a.Beta2
+	state.Scalars["epsilon"] = a.Epsilon
+	state.Scalars["weightDecay"] = a.WeightDecay
+	state.Scalars["t"] = float64(a.T)
+	state.Tensors["m"] = cloneTensors(a.M)
+	state.Tensors["u"] = cloneTensors(a.U)
+	return state
+}
+
+func (a *Adamax) LoadStateDict(state State) error {
+	scalars, err := state.scalars("lr", "beta1", "beta2", "epsilon", "weightDecay", "t")
+	if err != nil {
+		return err
+	}
+	m, err := state.tensors("m", a.Parameters)
+	if err != nil {
+		return err
+	}
+	u, err := state.tensors("u", a.Parameters)
+	if err != nil {
+		return err
+	}
+	a.LR, a.Beta1, a.Beta2, a.Epsilon, a.WeightDecay = scalars[0], scalars[1], scalars[2], scalars[3], scalars[4]
+	a.T = int(scalars[5])
+	a.M, a.U = m, u
+	return nil
+}
@@ -0,0 +1,37 @@
+package optim
+
+import (
+	"math"
+	"nnscratch/layers"
+	"testing"
+)
+
+func TestAdamaxFirstStep(t *testing.T) {
+	// after bias correction the first step is lr * g / |g|
+	p := param(t, 1, -2)
+	minimize(t, NewAdamax([]*layers.Parameter{p}, 0.05, WithEpsilon(0)), p, 1)
+	expectClose(t, p.Value.Data(), []float64{0.95, -1.95}, 1e-15)
+}
+
+func TestAdamaxMatchesReference(t *testing.T) {
+	p := param(t, 1, -2)
+	minimize(t, NewAdamax([]*layers.Parameter{p}, 0.05, WithBetas(0.8, 0.9), WithWeightDecay(0.1)), p, 5)
+
+	x := []float64{1, -2}
+	m, u := make([]float64, 2), make([]float64, 2)
+	for step := 1; step <= 5; step++ {
+		for j := range x {
+			g := x[j] + 0.1*x[j]
+			m[j] = 0.8*m[j] + 0.2*g
+			u[j] = math.Max(0.9*u[j], math.Abs(g)+1e-8)
+			x[j] -= 0.05 / (1 - math.Pow(0.8, float64(step))) * m[j] / u[j]
+		}
+	}
+	expectClose(t, p.Value.Data(), x, 1e-15)
+}
+
+func TestAdamaxStateDict(t *testing.T) {
+	expectStateRoundTrip(t, func(params []*layers.Parameter) Optimizer {
+		return NewAdamax(params, 0.05)
+	})
+}
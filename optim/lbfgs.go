@@ -0,0 +1,516 @@
+package optim
+
+import (
+	"fmt"
+	"math"
+	"nnscratch/layers"
+	"nnscratch/tensor"
+)
+
+// Limited memory BFGS. It builds its search direction from the last
+// HistorySize parameter and gradient changes and, with LineSearch, picks the
+// step length with a strong Wolfe line search. Every step calls the closure
+// several times, so it suits small full batch problems. All parameters are
+// handled as one flat vector
+type LBFGS struct {
+	Parameters      []*layers.Parameter
+	LR              float64
+	MaxIter         int // iterations per step
+	MaxEval         int // closure calls per step
+	HistorySize     int // below 1 keeps no history
+	ToleranceGrad   float64
+	ToleranceChange float64
+	LineSearch      bool // strong Wolfe line search, otherwise steps of LR
+	NIter           int  // iterations over all steps
+	FuncEvals       int  // closure calls over all steps
+
+	// kept between steps
+	dir      []float64
+	stepLen  float64
+	oldDirs  [][]float64 // gradient changes y
+	oldSteps [][]float64 // parameter changes s
+	ro       []float64   // 1/(y.s)
+	hDiag    float64
+	prevGrad []float64
+	prevLoss float64
+}
+
+// Defaults to 20 iterations, 25 evaluations, a history of 100, tolerances
+// 1e-7 and 1e-9 and the line search on. Takes WithMaxIter, WithMaxEval,
+// WithHistorySize and WithTolerances
+func NewLBFGS(params []*layers.Parameter, lr float64, opts ...Option) *LBFGS {
+	o := applyOptions(options{maxIter: 20, historySize: 100, toleranceGrad: 1e-7, toleranceChange: 1e-9}, opts)
+	if o.maxEval == 0 {
+		o.maxEval = o.maxIter * 5 / 4
+	}
+	return &LBFGS{
+		Parameters:      params,
+		LR:              lr,
+		MaxIter:         o.maxIter,
+		MaxEval:         o.maxEval,
+		HistorySize:     o.historySize,
+		ToleranceGrad:   o.toleranceGrad,
+		ToleranceChange: o.toleranceChange,
+		LineSearch:      true,
+		hDiag:           1,
+	}
+}
+
+func (l *LBFGS) numel() int {
+	n := 0
+	for _, p := range l.Parameters {
+		n += p.Value.Len()
+	}
+	return n
+}
+
+// Gradients of all parameters as one vector, zero for missing ones
+func (l *LBFGS) flatGrad() ([]float64, error) {
+	flat := make([]float64, 0, l.numel())
+	for _, p := range l.Parameters {
+		if p.Grad == nil {
+			flat = append(flat, make([]float64, p.Value.Len())...)
+			continue
+		}
+		if p.Grad.Len() != p.Value.Len() {
+			return nil, fmt.Errorf("lbfgs: gradient of shape %v for parameter of shape %v", p.Grad.Shape(), p.Value.Shape())
+		}
+		flat = append(flat, p.Grad.Values()...)
+	}
+	return flat, nil
+}
+
+func (l *LBFGS) flatParams() []float64 {
+	flat := make([]float64, 0, l.numel())
+	for _, p := range l.Parameters {
+		flat = append(flat, p.Value.Values()...)
+	}
+	return flat
+}
+
+// Sets the parameters to x + t*d
+func (l *LBFGS) setParams(x []float64, t float64, d []float64) {
+	offset := 0
+	for _, p := range l.Parameters {
+		if !p.Value.IsContiguous() {
+			p.Value = p.Value.Contiguous()
+		}
+		value := p.Value.Data()
+		for j := range value {
+			value[j] = x[offset+j] + t*d[offset+j]
+		}
+		offset += len(value)
+	}
+}
+
+func dot(a, b []float64) float64 {
+	sum := 0.0
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+func maxAbs(a []float64) float64 {
+	m := 0.0
+	for _, v := range a {
+		m = math.Max(m, math.Abs(v))
+	}
+	return m
+}
+
+// Runs up to MaxIter iterations and gives the loss from before them. The
+// closure must leave the gradient of the loss in every Parameter.Grad
+func (l *LBFGS) Step(closure Closure) (float64, error) {
+	loss, err := closure()
+	if err != nil {
+		return 0, err
+	}
+	origLoss := loss
+	evals := 1
+	l.FuncEvals++
+	grad, err := l.flatGrad()
+	if err != nil {
+		return 0, err
+	}
+	if maxAbs(grad) <= l.ToleranceGrad {
+		return origLoss, nil
+	}
+
+	for iter := 1; ; iter++ {
+		l.NIter++
+		if l.NIter == 1 {
+			l.dir = make([]float64, len(grad))
+			for i, g := range grad {
+				l.dir[i] = -g
+			}
+			l.oldDirs, l.oldSteps, l.ro = nil, nil, nil
+			l.hDiag = 1
+		} else {
+			l.updateHistory(grad)
+			l.twoLoop(grad)
+		}
+		l.prevGrad = append(l.prevGrad[:0], grad...)
+		l.prevLoss = loss
+
+		if l.NIter == 1 {
+			l.stepLen = math.Min(1, 1/sumAbs(grad)) * l.LR
+		} else {
+			l.stepLen = l.LR
+		}
+		gtd := dot(grad, l.dir)
+		// not a descent direction
+		if gtd > -l.ToleranceChange {
+			break
+		}
+
+		lsEvals := 0
+		if l.LineSearch {
+			x := l.flatParams()
+			eval := func(t float64) (float64, []float64, error) {
+				l.setParams(x, t, l.dir)
+				f, err := closure()
+				if err != nil {
+					return 0, nil, err
+				}
+				g, err := l.flatGrad()
+				return f, g, err
+			}
+			loss, grad, l.stepLen, lsEvals, err = strongWolfe(eval, l.stepLen, l.dir, loss, grad, gtd, l.ToleranceChange)
+			if err != nil {
+				l.setParams(x, 0, l.dir)
+				return 0, err
+			}
+			l.setParams(x, l.stepLen, l.dir)
+		} else {
+			l.setParams(l.flatParams(), l.stepLen, l.dir)
+			if iter != l.MaxIter {
+				loss, err = closure()
+				if err != nil {
+					return 0, err
+				}
+				grad, err = l.flatGrad()
+				if err != nil {
+					return 0, err
+				}
+				lsEvals = 1
+			}
+		}
+		evals += lsEvals
+		l.FuncEvals += lsEvals
+
+		if iter == l.MaxIter || evals >= l.MaxEval || maxAbs(grad) <= l.ToleranceGrad {
+			break
+		}
+		if maxAbs(l.dir)*math.Abs(l.stepLen) <= l.ToleranceChange {
+			break
+		}
+		if math.Abs(loss-l.prevLoss) < l.ToleranceChange {
+			break
+		}
+	}
+	return origLoss, nil
+}
+
+func sumAbs(a []float64) float64 {
+	sum := 0.0
+	for _, v := range a {
+		sum += math.Abs(v)
+	}
+	return sum
+}
+
+// Adds the last parameter and gradient change to the history when the
+// curvature along them is positive
+func (l *LBFGS) updateHistory(grad []float64) {
+	y := make([]float64, len(grad))
+	s := make([]float64, len(grad))
+	for i := range grad {
+		y[i] = grad[i] - l.prevGrad[i]
+		s[i] = l.dir[i] * l.stepLen
+	}
+	ys := dot(y, s)
+	if ys <= 1e-10 {
+		return
+	}
+	l.hDiag = ys / dot(y, y)
+	// with no history the direction is the gradient scaled by hDiag
+	if l.HistorySize < 1 {
+		return
+	}
+	for len(l.oldDirs) >= l.HistorySize {
+		l.oldDirs, l.oldSteps, l.ro = l.oldDirs[1:], l.oldSteps[1:], l.ro[1:]
+	}
+	l.oldDirs = append(l.oldDirs, y)
+	l.oldSteps = append(l.oldSteps, s)
+	l.ro = append(l.ro, 1/ys)
+}
+
+// Sets dir to the inverse Hessian estimate times the negative gradient
+func (l *LBFGS) twoLoop(grad []float64) {
+	n := len(l.oldDirs)
+	al := make([]float64, n)
+	for i, g := range grad {
+		l.dir[i] = -g
+	}
+	for i := n - 1; i >= 0; i-- {
+		al[i] = dot(l.oldSteps[i], l.dir) * l.ro[i]
+		for j, y := range l.oldDirs[i] {
+			l.dir[j] -= al[i] * y
+		}
+	}
+	for j := range l.dir {
+		l.dir[j] *= l.hDiag
+	}
+	for i := 0; i < n; i++ {
+		be := dot(l.oldDirs[i], l.dir) * l.ro[i]
+		for j, s := range l.oldSteps[i] {
+			l.dir[j] += s * (al[i] - be)
+		}
+	}
+}
+
+// Minimizer of the cubic through (x1, f1) and (x2, f2) with slopes g1 and g2,
+// clamped to [lo, hi]. Falls back to the middle when there is none
+func cubicInterpolate(x1, f1, g1, x2, f2, g2, lo, hi float64) float64 {
+	d1 := g1 + g2 - 3*(f1-f2)/(x1-x2)
+	d2Square := d1*d1 - g1*g2
+	if d2Square < 0 {
+		return (lo + hi) / 2
+	}
+	d2 := math.Sqrt(d2Square)
+	var minPos float64
+	if x1 <= x2 {
+		minPos = x2 - (x2-x1)*((g2+d2-d1)/(g2-g1+2*d2))
+	} else {
+		minPos = x1 - (x1-x2)*((g1+d2-d1)/(g1-g2+2*d2))
+	}
+	return math.Min(math.Max(minPos, lo), hi)
+}
+
+// One end of a line search bracket
+type linePoint struct {
+	t, f, gtd float64
+	g         []float64
+}
+
+// Strong Wolfe line search along d from loss f with gradient g and slope gtd,
+// starting at step t. Gives the loss, gradient and step it settled on and the
+// number of evaluations
+func strongWolfe(eval func(t float64) (float64, []float64, error), t float64, d []float64, f float64, g []float64, gtd, toleranceChange float64) (float64, []float64, float64, int, error) {
+	const (
+		c1    = 1e-4
+		c2    = 0.9
+		maxLS = 25
+	)
+	dNorm := maxAbs(d)
+	fNew, gNew, err := eval(t)
+	if err != nil {
+		return 0, nil, 0, 0, err
+	}
+	evals := 1
+	gtdNew := dot(gNew, d)
+	prev := linePoint{t: 0, f: f, gtd: gtd, g: g}
+	cur := func() linePoint { return linePoint{t: t, f: fNew, gtd: gtdNew, g: gNew} }
+
+	// bracketing phase, grow the step until an interval holds a good point
+	var bracket [2]linePoint
+	done := false
+	iter := 0
+	for ; iter < maxLS; iter++ {
+		if fNew > f+c1*t*gtd || (iter > 1 && fNew >= prev.f) {
+			bracket = [2]linePoint{prev, cur()}
+			break
+		}
+		if math.Abs(gtdNew) <= -c2*gtd {
+			bracket = [2]linePoint{cur(), cur()}
+			done = true
+			break
+		}
+		if gtdNew >= 0 {
+			bracket = [2]linePoint{prev, cur()}
+			break
+		}
+		lo := t + 0.01*(t-prev.t)
+		hi := t * 10
+		next := cubicInterpolate(prev.t, prev.f, prev.gtd, t, fNew, gtdNew, lo, hi)
+		prev = cur()
+		t = next
+		fNew, gNew, err = eval(t)
+		if err != nil {
+			return 0, nil, 0, 0, err
+		}
+		evals++
+		gtdNew = dot(gNew, d)
+	}
+	if iter == maxLS {
+		bracket = [2]linePoint{{t: 0, f: f, gtd: gtd, g: g}, cur()}
+	}
+
+	// zoom phase, shrink the interval until a point meets the conditions
+	low, high := 0, 1
+	if bracket[0].f > bracket[1].f {
+		low, high = 1, 0
+	}
+	insufficientProgress := false
+	for !done && iter < maxLS {
+		if math.Abs(bracket[1].t-bracket[0].t)*dNorm < toleranceChange {
+			break
+		}
+		bmin := math.Min(bracket[0].t, bracket[1].t)
+		bmax := math.Max(bracket[0].t, bracket[1].t)
+		t = cubicInterpolate(bracket[0].t, bracket[0].f, bracket[0].gtd, bracket[1].t, bracket[1].f, bracket[1].gtd, bmin, bmax)
+		// keep away from the ends of the interval unless progress stalls
+		eps := 0.1 * (bmax - bmin)
+		if math.Min(bmax-t, t-bmin) < eps {
+			if insufficientProgress || t >= bmax || t <= bmin {
+				if math.Abs(t-bmax) < math.Abs(t-bmin) {
+					t = bmax - eps
+				} else {
+					t = bmin + eps
+				}
+				insufficientProgress = false
+			} else {
+				insufficientProgress = true
+			}
+		} else {
+			insufficientProgress = false
+		}
+		fNew, gNew, err = eval(t)
+		if err != nil {
+			return 0, nil, 0, 0, err
+		}
+		evals++
+		gtdNew = dot(gNew, d)
+		iter++
+
+		if fNew > f+c1*t*gtd || fNew >= bracket[low].f {
+			bracket[high] = cur()
+			if bracket[0].f <= bracket[1].f {
+				low, high = 0, 1
+			} else {
+				low, high = 1, 0
+			}
+			continue
+		}
+		if math.Abs(gtdNew) <= -c2*gtd {
+			done = true
+		} else if gtdNew*(bracket[high].t-bracket[low].t) >= 0 {
+			bracket[high] = bracket[low]
+		}
+		bracket[low] = cur()
+	}
+	best := bracket[low]
+	return best.f, best.g, best.t, evals, nil
+}
+
+func (l *LBFGS) ZeroGrad() {
+	zeroGrads(l.Parameters)
+}
+
+func (l *LBFGS) GetLR() float64 {
+	return l.LR
+}
+
+func (l *LBFGS) SetLR(lr float64) {
+	l.LR = lr
+}
+
+// Flat vector as a one dimensional tensor, nil for an empty one
+func vectorTensor(v []float64) *tensor.Tensor {
+	if len(v) == 0 {
+		return nil
+	}
+	t, _ := tensor.NewTensor(len(v))
+	copy(t.Data(), v)
+	return t
+}
+
+func (l *LBFGS) StateDict() State {
+	state := newState()
+	state.Scalars["lr"] = l.LR
+	state.Scalars["maxIter"] = float64(l.MaxIter)
+	state.Scalars["maxEval"] = float64(l.MaxEval)
+	state.Scalars["historySize"] = float64(l.HistorySize)
+	state.Scalars["toleranceGrad"] = l.ToleranceGrad
+	state.Scalars["toleranceChange"] = l.ToleranceChange
+	state.Scalars["lineSearch"] = flag(l.LineSearch)
+	state.Scalars["nIter"] = float64(l.NIter)
+	state.Scalars["funcEvals"] = float64(l.FuncEvals)
+	state.Scalars["stepLen"] = l.stepLen
+	state.Scalars["hDiag"] = l.hDiag
+	state.Scalars["prevLoss"] = l.prevLoss
+	state.Tensors["dir"] = []*tensor.Tensor{vectorTensor(l.dir)}
+	state.Tensors["prevGrad"] = []*tensor.Tensor{vectorTensor(l.prevGrad)}
+	state.Tensors["ro"] = []*tensor.Tensor{vectorTensor(l.ro)}
+	state.Tensors["oldDirs"] = make([]*tensor.Tensor, len(l.oldDirs))
+	state.Tensors["oldSteps"] = make([]*tensor.Tensor, len(l.oldSteps))
+	for i := range l.oldDirs {
+		state.Tensors["oldDirs"][i] = vectorTensor(l.oldDirs[i])
+		state.Tensors["oldSteps"][i] = vectorTensor(l.oldSteps[i])
+	}
+	return state
+}
+
+// Gives the vectors saved under name, checking each has size n
+func (s State) vectors(name string, n int) ([][]float64, error) {
+	saved, ok := s.Tensors[name]
+	if !ok {
+		return nil, fmt.Errorf("optim: state has no %q", name)
+	}
+	vectors := make([][]float64, len(saved))
+	for i, t := range saved {
+		if t == nil {
+			continue
+		}
+		if n >= 0 && t.Len() != n {
+			return nil, fmt.Errorf("optim: state %q vector %d has size %d, expected %d", name, i, t.Len(), n)
+		}
+		vectors[i] = append([]float64(nil), t.Values()...)
+	}
+	return vectors, nil
+}
+
+func (l *LBFGS) LoadStateDict(state State) error {
+	scalars, err := state.scalars("lr", "maxIter", "maxEval", "historySize", "toleranceGrad", "toleranceChange",
+		"lineSearch", "nIter", "funcEvals", "stepLen", "hDiag", "prevLoss")
+	if err != nil {
+		return err
+	}
+	n := l.numel()
+	var single [3][]float64
+	for i, name := range []string{"dir", "prevGrad", "ro"} {
+		size := n
+		if name == "ro" {
+			size = -1
+		}
+		v, err := state.vectors(name, size)
+		if err != nil {
+			return err
+		}
+		if len(v) != 1 {
+			return fmt.Errorf("optim: state %q should hold one vector", name)
+		}
+		single[i] = v[0]
+	}
+	oldDirs, err := state.vectors("oldDirs", n)
+	if err != nil {
+		return err
+	}
+	oldSteps, err := state.vectors("oldSteps", n)
+	if err != nil {
+		return err
+	}
+	if len(oldDirs) != len(oldSteps) || len(oldDirs) != len(single[2]) {
+		return fmt.Errorf("optim: state has %d directions, %d steps and %d curvatures", len(oldDirs), len(oldSteps), len(single[2]))
+	}
+	l.LR = scalars[0]
+	l.MaxIter, l.MaxEval, l.HistorySize = int(scalars[1]), int(scalars[2]), int(scalars[3])
+	l.ToleranceGrad, l.ToleranceChange = scalars[4], scalars[5]
+	l.LineSearch = scalars[6] != 0
+	l.NIter, l.FuncEvals = int(scalars[7]), int(scalars[8])
+	l.stepLen, l.hDiag, l.prevLoss = scalars[9], scalars[10], scalars[11]
+	l.dir, l.prevGrad, l.ro = single[0], single[1], single[2]
+	l.oldDirs, l.oldSteps = oldDirs, oldSteps
+	return nil
+}
@@ -0,0 +1,132 @@
+package optim
+
+import (
+	"math"
+	"nnscratch/layers"
+	"nnscratch/tensor"
+	"slices"
+	"testing"
+)
+
+func point(x, y float64) *layers.Parameter {
+	value, _ := tensor.NewTensorInput([]float64{x, y})
+	grad, _ := tensor.NewTensor(2)
+	return &layers.Parameter{Value: value, Grad: grad}
+}
+
+// (1 - x)^2 + 100 (y - x^2)^2, its minimum is at (1, 1)
+func rosenbrock(p *layers.Parameter) Closure {
+	return func() (float64, error) {
+		v, g := p.Value.Data(), p.Grad.Data()
+		x, y := v[0], v[1]
+		g[0] = -2*(1-x) - 400*x*(y-x*x)
+		g[1] = 200 * (y - x*x)
+		return (1-x)*(1-x) + 100*(y-x*x)*(y-x*x), nil
+	}
+}
+
+func TestLBFGSRosenbrock(t *testing.T) {
+	for _, history := range []int{100, 10, 1} {
+		p := point(-1.5, 2)
+		l := NewLBFGS([]*layers.Parameter{p}, 1, WithHistorySize(history))
+		for i := 0; i < 100; i++ {
+			if _, err := l.Step(rosenbrock(p)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if v := p.Value.Data(); math.Abs(v[0]-1) > 1e-4 || math.Abs(v[1]-1) > 1e-4 {
+			t.Errorf("history %d ended at %v, expected (1, 1)", history, v)
+		}
+	}
+}
+
+func TestLBFGSQuadratic(t *testing.T) {
+	// (x - 3)^2 from 0 without the line search. The first iteration steps
+	// along -g scaled by 1/|g| to x = 1, the second has the exact curvature
+	// s/y = 1/2 in its history and lands on the minimum
+	x := param(t, 0)
+	closure := func() (float64, error) {
+		v := x.Value.Data()[0]
+		x.Grad.Data()[0] = 2 * (v - 3)
+		return (v - 3) * (v - 3), nil
+	}
+	for iterations, want := range map[int]float64{1: 1, 2: 3} {
+		x.Value.Data()[0] = 0
+		l := NewLBFGS([]*layers.Parameter{x}, 1, WithMaxIter(iterations), WithMaxEval(10))
+		l.LineSearch = false
+		if _, err := l.Step(closure); err != nil {
+			t.Fatal(err)
+		}
+		expectClose(t, x.Value.Data(), []float64{want}, 1e-12)
+	}
+}
+
+func TestLBFGSWithoutHistory(t *testing.T) {
+	p := point(-1.5, 2)
+	l := NewLBFGS([]*layers.Parameter{p}, 1, WithHistorySize(0))
+	start, _ := rosenbrock(p)()
+	var loss float64
+	for i := 0; i < 20; i++ {
+		var err error
+		if loss, err = l.Step(rosenbrock(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if loss >= start {
+		t.Errorf("loss went from %v to %v", start, loss)
+	}
+}
+
+func TestLBFGSHistoryShrinks(t *testing.T) {
+	p := point(-1.5, 2)
+	l := NewLBFGS([]*layers.Parameter{p}, 1, WithHistorySize(5))
+	if _, err := l.Step(rosenbrock(p)); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.oldDirs) != 5 {
+		t.Fatalf("history of %d, expected it full at 5", len(l.oldDirs))
+	}
+	// a smaller size drops all the oldest entries at the next update
+	l.HistorySize = 2
+	if _, err := l.Step(rosenbrock(p)); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.oldDirs) != 2 || len(l.oldSteps) != 2 || len(l.ro) != 2 {
+		t.Errorf("history of %d, %d and %d, expected 2", len(l.oldDirs), len(l.oldSteps), len(l.ro))
+	}
+}
+
+func TestLBFGSStateDictRoundTrip(t *testing.T) {
+	run := func(steps int, l *LBFGS, p *layers.Parameter) {
+		t.Helper()
+		for i := 0; i < steps; i++ {
+			if _, err := l.Step(rosenbrock(p)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	want := point(-1.5, 2)
+	run(6, NewLBFGS([]*layers.Parameter{want}, 1, WithHistorySize(5), WithMaxIter(3)), want)
+
+	// stop after 3 steps and go on with a new optimizer made with other settings
+	p := point(-1.5, 2)
+	first := NewLBFGS([]*layers.Parameter{p}, 1, WithHistorySize(5), WithMaxIter(3))
+	run(3, first, p)
+	second := NewLBFGS([]*layers.Parameter{p}, 0.5)
+	if err := second.LoadStateDict(first.StateDict()); err != nil {
+		t.Fatal(err)
+	}
+	if second.HistorySize != 5 || second.MaxIter != 3 || second.LR != 1 || second.NIter != first.NIter {
+		t.Errorf("settings not restored, got history %d, %d iterations, lr %v and %d done", second.HistorySize, second.MaxIter, second.LR, second.NIter)
+	}
+	run(3, second, p)
+	if !slices.Equal(p.Value.Data(), want.Value.Data()) {
+		t.Errorf("resumed run ended at %v, expected %v", p.Value.Data(), want.Value.Data())
+	}
+
+	// a state for a different number of parameters is refused
+	other := NewLBFGS([]*layers.Parameter{point(0, 0), point(0, 0)}, 1)
+	if err := other.LoadStateDict(first.StateDict()); err == nil {
+		t.Error("state of 2 values loaded into 4")
+	}
+}
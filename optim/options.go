@@ -0,0 +1,116 @@
+package optim
+
+// Hyperparameters set through options. Every constructor fills in its own
+// defaults and then applies the options, those an optimizer has no use for
+// are ignored
+type options struct {
+	momentum        float64
+	dampening       float64
+	nesterov        bool
+	weightDecay     float64
+	epsilon         float64
+	beta1           float64
+	beta2           float64
+	alpha           float64
+	centered        bool
+	rho             float64
+	lrDecay         float64
+	initialSum      float64
+	amsgrad         bool
+	maxIter         int
+	maxEval         int
+	historySize     int
+	toleranceGrad   float64
+	toleranceChange float64
+}
+
+type Option func(*options)
+
+func applyOptions(o options, opts []Option) options {
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func WithMomentum(momentum float64) Option {
+	return func(o *options) { o.momentum = momentum }
+}
+
+// Scales the gradient added to the momentum by 1-dampening
+func WithDampening(dampening float64) Option {
+	return func(o *options) { o.dampening = dampening }
+}
+
+// Nesterov momentum, needs a momentum and no dampening
+func WithNesterov() Option {
+	return func(o *options) { o.nesterov = true }
+}
+
+// L2 penalty, adds decay*p to the gradient of every parameter p
+func WithWeightDecay(decay float64) Option {
+	return func(o *options) { o.weightDecay = decay }
+}
+
+// Term added to denominators so they are never zero
+func WithEpsilon(epsilon float64) Option {
+	return func(o *options) { o.epsilon = epsilon }
+}
+
+// Decay rates of the running averages of the gradient and its square
+func WithBetas(beta1, beta2 float64) Option {
+	return func(o *options) { o.beta1, o.beta2 = beta1, beta2 }
+}
+
+// Decay rate of the running average of the squared gradient of RMSProp
+func WithAlpha(alpha float64) Option {
+	return func(o *options) { o.alpha = alpha }
+}
+
+// Centered RMSProp, which divides by an estimate of the gradient variance
+// instead of its second moment
+func WithCentered() Option {
+	return func(o *options) { o.centered = true }
+}
+
+// Decay rate of the running averages of Adadelta
+func WithRho(rho float64) Option {
+	return func(o *options) { o.rho = rho }
+}
+
+// Adagrad step t uses the learning rate lr/(1+(t-1)*decay)
+func WithLRDecay(decay float64) Option {
+	return func(o *options) { o.lrDecay = decay }
+}
+
+// Starting value of the sum of squared gradients of Adagrad
+func WithInitialAccumulator(value float64) Option {
+	return func(o *options) { o.initialSum = value }
+}
+
+// AMSGrad variant of Adam, which divides by the largest second moment seen so
+// far instead of the current one
+func WithAMSGrad() Option {
+	return func(o *options) { o.amsgrad = true }
+}
+
+// Most iterations of one LBFGS step
+func WithMaxIter(n int) Option {
+	return func(o *options) { o.maxIter = n }
+}
+
+// Most evaluations of the closure in one LBFGS step
+func WithMaxEval(n int) Option {
+	return func(o *options) { o.maxEval = n }
+}
+
+// Number of past updates LBFGS keeps to estimate the curvature
+func WithHistorySize(n int) Option {
+	return func(o *options) { o.historySize = n }
+}
+
+// LBFGS stops when the largest gradient is at most grad or when the step or
+// the change in loss is below change
+func WithTolerances(grad, change float64) Option {
+	return func(o *options) { o.toleranceGrad, o.toleranceChange = grad, change }
+}
@@ -0,0 +1,89 @@
+package optim
+
+import (
+	"math"
+)
+
+// Multiplies the learning rate by Factor once a watched metric, like the
+// validation loss, has not improved for more than Patience steps. An
+// improvement has to beat the best value by the relative Threshold. After a
+// reduction the next Cooldown steps don't count
+type ReduceLROnPlateau struct {
+	Optimizer LRSetter
+	Maximize  bool // the metric should go up, like an accuracy
+	Factor    float64
+	Patience  int
+	Threshold float64
+	Cooldown  int
+	MinLR     float64
+	Best      float64
+	NumBad    int // steps since the last improvement
+	cooldown  int // cooldown steps left
+}
+
+// Defaults to a factor of 0.1, a patience of 10, a threshold of 1e-4 and no
+// cooldown or minimum learning rate
+func NewReduceLROnPlateau(optimizer LRSetter, maximize bool) *ReduceLROnPlateau {
+	best := math.Inf(1)
+	if maximize {
+		best = math.Inf(-1)
+	}
+	return &ReduceLROnPlateau{
+		Optimizer: optimizer,
+		Maximize:  maximize,
+		Factor:    0.1,
+		Patience:  10,
+		Threshold: 1e-4,
+		Best:      best,
+	}
+}
+
+func (r *ReduceLROnPlateau) better(metric float64) bool {
+	if r.Maximize {
+		return metric > r.Best*(1+r.Threshold)
+	}
+	return metric < r.Best*(1-r.Threshold)
+}
+
+// Records the metric of this step and lowers the learning rate when it has
+// plateaued
+func (r *ReduceLROnPlateau) Step(metric float64) {
+	if r.better(metric) {
+		r.Best = metric
+		r.NumBad = 0
+	} else {
+		r.NumBad++
+	}
+	if r.cooldown > 0 {
+		r.cooldown--
+		r.NumBad = 0
+	}
+	if r.NumBad > r.Patience {
+		lr := r.Optimizer.GetLR()
+		// changes too small to matter are skipped
+		if reduced := math.Max(lr*r.Factor, r.MinLR); lr-reduced > 1e-8 {
+			r.Optimizer.SetLR(reduced)
+		}
+		r.cooldown = r.Cooldown
+		r.NumBad = 0
+	}
+}
+
+func (r *ReduceLROnPlateau) StateDict() State {
+	return State{Scalars: map[string]float64{
+		"best":     r.Best,
+		"numBad":   float64(r.NumBad),
+		"cooldown": float64(r.cooldown),
+	}}
+}
+
+// Restores the best metric and the counters, the learning rate itself is part
+// of the optimizer state
+func (r *ReduceLROnPlateau) LoadStateDict(state State) error {
+	values, err := state.scalars("best", "numBad", "cooldown")
+	if err != nil {
+		return err
+	}
+	r.Best, r.NumBad, r.cooldown = values[0], int(values[1]), int(values[2])
+	return nil
+}
@@ -0,0 +1,74 @@
+package optim
+
+import (
+	"math"
+	"testing"
+)
+
+func TestReduceLROnPlateau(t *testing.T) {
+	plateau := []float64{1, 0.9, 0.95, 0.95, 0.95, 0.95, 0.95, 0.95, 0.95}
+	tests := []struct {
+		name     string
+		maximize bool
+		cooldown int
+		minLR    float64
+		metrics  []float64
+		want     []float64 // learning rate after each step
+	}{
+		// more than 2 steps without improvement lower the learning rate
+		{"patience", false, 0, 0, plateau,
+			[]float64{0.1, 0.1, 0.1, 0.1, 0.01, 0.01, 0.01, 0.001, 0.001}},
+		// and the step after a reduction doesn't count
+		{"cooldown", false, 1, 0, plateau,
+			[]float64{0.1, 0.1, 0.1, 0.1, 0.01, 0.01, 0.01, 0.01, 0.001}},
+		{"min lr", false, 0, 0.005, plateau,
+			[]float64{0.1, 0.1, 0.1, 0.1, 0.01, 0.01, 0.01, 0.005, 0.005}},
+		// 0.89995 is within the relative threshold of 0.9, so no improvement
+		{"threshold", false, 0, 0, []float64{0.9, 0.89995, 0.89995, 0.89995},
+			[]float64{0.1, 0.1, 0.1, 0.01}},
+		{"maximize", true, 0, 0, []float64{0.5, 0.6, 0.7, 0.6, 0.6, 0.6},
+			[]float64{0.1, 0.1, 0.1, 0.1, 0.1, 0.01}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sgd := NewSGD(nil, 0.1)
+			r := NewReduceLROnPlateau(sgd, tt.maximize)
+			r.Patience = 2
+			r.Cooldown = tt.cooldown
+			r.MinLR = tt.minLR
+			for i, metric := range tt.metrics {
+				r.Step(metric)
+				if math.Abs(sgd.GetLR()-tt.want[i]) > 1e-12 {
+					t.Fatalf("learning rate %v after step %d, expected %v", sgd.GetLR(), i, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReduceLROnPlateauStateDict(t *testing.T) {
+	sgd := NewSGD(nil, 0.1)
+	r := NewReduceLROnPlateau(sgd, false)
+	r.Patience, r.Cooldown = 1, 2
+	for _, metric := range []float64{1, 2, 2} {
+		r.Step(metric)
+	}
+	// the learning rate itself comes back with the optimizer state
+	restored := NewReduceLROnPlateau(NewSGD(nil, sgd.GetLR()), false)
+	restored.Patience, restored.Cooldown = 1, 2
+	if err := restored.LoadStateDict(r.StateDict()); err != nil {
+		t.Fatal(err)
+	}
+	// both are in their cooldown, so the same metrics give the same learning rates
+	for _, metric := range []float64{2, 2, 2, 2} {
+		r.Step(metric)
+		restored.Step(metric)
+		if r.Optimizer.GetLR() != restored.Optimizer.GetLR() || r.NumBad != restored.NumBad {
+			t.Fatalf("restored scheduler at lr %v and %d bad steps, expected %v and %d",
+				restored.Optimizer.GetLR(), restored.NumBad, r.Optimizer.GetLR(), r.NumBad)
+		}
+	}
+	if err := restored.LoadStateDict(State{}); err == nil {
+		t.Error("an empty state loaded")
+	}
+}
@@ -0,0 +1,121 @@
+package optim
+
+import (
+	"math"
+	"nnscratch/layers"
+	"nnscratch/tensor"
+)
+
+// RMSProp divides the gradient by a running root mean square of recent
+// gradients, sq = alpha*sq + (1-alpha)*g^2. The centered variant subtracts the
+// square of the running mean gradient first, and with momentum the scaled
+// gradients are accumulated in a velocity
+type RMSProp struct {
+	Parameters  []*layers.Parameter
+	LR          float64
+	Alpha       float64
+	Epsilon     float64
+	Momentum    float64
+	Centered    bool
+	WeightDecay float64
+	SquareAvg   []*tensor.Tensor
+	GradAvg     []*tensor.Tensor // only used when centered
+	Velocity    []*tensor.Tensor // only used with momentum
+}
+
+// Defaults to alpha 0.99 and epsilon 1e-8, takes WithAlpha, WithEpsilon,
+// WithMomentum, WithCentered and WithWeightDecay
+func NewRMSProp(params []*layers.Parameter, lr float64, opts ...Option) *RMSProp {
+	o := applyOptions(options{alpha: 0.99, epsilon: 1e-8}, opts)
+	return &RMSProp{
+		Parameters:  params,
+		LR:          lr,
+		Alpha:       o.alpha,
+		Epsilon:     o.epsilon,
+		Momentum:    o.momentum,
+		Centered:    o.centered,
+		WeightDecay: o.weightDecay,
+		SquareAvg:   filledLike(params, 0),
+		GradAvg:     filledLike(params, 0),
+		Velocity:    filledLike(params, 0),
+	}
+}
+
+func (r *RMSProp) Step() error {
+	for i, p := range r.Parameters {
+		if p.Grad == nil {
+			continue
+		}
+		value, err := paramData(p)
+		if err != nil {
+			return err
+		}
+		sq, avg, velocity := r.SquareAvg[i].Data(), r.GradAvg[i].Data(), r.Velocity[i].Data()
+		for j, g := range p.Grad.Values() {
+			g += r.WeightDecay * value[j]
+			sq[j] = r.Alpha*sq[j] + (1-r.Alpha)*g*g
+			variance := sq[j]
+			if r.Centered {
+				avg[j] = r.Alpha*avg[j] + (1-r.Alpha)*g
+				variance -= avg[j] * avg[j]
+			}
+			step := g / (math.Sqrt(variance) + r.Epsilon)
+			if r.Momentum != 0 {
+				velocity[j] = r.Momentum*velocity[j] + step
+				step = velocity[j]
+			}
+			value[j] -= r.LR * step
+		}
+	}
+	return nil
+}
+
+func (r *RMSProp) ZeroGrad() {
+	zeroGrads(r.Parameters)
+}
+
+func (r *RMSProp) GetLR() float64 {
+	return r.LR
+}
+
+func (r *RMSProp) SetLR(lr float64) {
+	r.LR = lr
+}
+
+func (r *RMSProp) StateDict() State {
+	state := newState()
+	state.Scalars["lr"] = r.LR
+	state.Scalars["alpha"] = r.Alpha
+	state.Scalars["epsilon"] = r.Epsilon
+	state.Scalars["momentum"] = r.Momentum
+	state.Scalars["centered"] = flag(r.Centered)
+	state.Scalars["weightDecay"] = r.WeightDecay
+	state.Tensors["squareAvg"] = cloneTensors(r.SquareAvg)
+	state.Tensors["gradAvg"] = cloneTensors(r.GradAvg)
+	state.Tensors["velocity"] = cloneTensors(r.Velocity)
+	return state
+}
+
+func (r *RMSProp) LoadStateDict(state State) error {
+	scalars, err := state.scalars("lr", "alpha", "epsilon", "momentum", "centered", "weightDecay")
+	if err != nil {
+		return err
+	}
+	sq, err := state.tensors("squareAvg", r.Parameters)
+	if err != nil {
+		return err
+	}
+	avg, err := state.tensors("gradAvg", r.Parameters)
+	if err != nil {
+		return err
+	}
+	velocity, err := state.tensors("velocity", r.Parameters)
+	if err != nil {
+		return err
+	}
+	r.LR, r.Alpha, r.Epsilon, r.Momentum = scalars[0], scalars[1], scalars[2], scalars[3]
+	r.Centered = scalars[4] != 0
+	r.WeightDecay = scalars[5]
+	r.SquareAvg, r.GradAvg, r.Velocity = sq, avg, velocity
+	return nil
+}
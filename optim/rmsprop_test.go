@@ -0,0 +1,64 @@
+package optim
+
+import (
+	"math"
+	"nnscratch/layers"
+	"testing"
+)
+
+func TestRMSPropFirstStep(t *testing.T) {
+	// the square average is 0.01 g^2, so the first step is lr * 10 * sign(g)
+	p := param(t, 1, -2)
+	minimize(t, NewRMSProp([]*layers.Parameter{p}, 0.01, WithEpsilon(0)), p, 1)
+	expectClose(t, p.Value.Data(), []float64{0.9, -1.9}, 1e-12)
+}
+
+func TestRMSPropMatchesReference(t *testing.T) {
+	tests := []struct {
+		name     string
+		centered bool
+		momentum float64
+	}{
+		{"plain", false, 0},
+		{"centered", true, 0},
+		{"momentum", false, 0.5},
+		{"centered with momentum", true, 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []Option{WithAlpha(0.9), WithMomentum(tt.momentum), WithWeightDecay(0.1)}
+			if tt.centered {
+				opts = append(opts, WithCentered())
+			}
+			p := param(t, 1, -2)
+			minimize(t, NewRMSProp([]*layers.Parameter{p}, 0.01, opts...), p, 5)
+
+			x := []float64{1, -2}
+			sq, avg, velocity := make([]float64, 2), make([]float64, 2), make([]float64, 2)
+			for step := 0; step < 5; step++ {
+				for j := range x {
+					g := x[j] + 0.1*x[j]
+					sq[j] = 0.9*sq[j] + 0.1*g*g
+					variance := sq[j]
+					if tt.centered {
+						avg[j] = 0.9*avg[j] + 0.1*g
+						variance -= avg[j] * avg[j]
+					}
+					update := g / (math.Sqrt(variance) + 1e-8)
+					if tt.momentum != 0 {
+						velocity[j] = tt.momentum*velocity[j] + update
+						update = velocity[j]
+					}
+					x[j] -= 0.01 * update
+				}
+			}
+			expectClose(t, p.Value.Data(), x, 1e-15)
+		})
+	}
+}
+
+func TestRMSPropStateDict(t *testing.T) {
+	expectStateRoundTrip(t, func(params []*layers.Parameter) Optimizer {
+		return NewRMSProp(params, 0.01, WithCentered(), WithMomentum(0.5))
+	})
+}
@@ -0,0 +1,70 @@
+package optim
+
+// Learning rate after step steps, starting from base. A Scheduler applies one
+// to an optimizer every Step
+type Schedule interface {
+	LR(base float64, step int) float64
+}
+
+// Drives the learning rate of an optimizer with a schedule. Call Step once
+// per epoch, or once per batch for schedules counted in batches
+type Scheduler struct {
+	Optimizer LRSetter
+	Schedule  Schedule
+	BaseLR    float64 // the learning rate of the optimizer when made
+	StepCount int
+}
+
+// Takes the current learning rate of the optimizer as the base and sets the
+// learning rate of step 0
+func NewScheduler(optimizer LRSetter, schedule Schedule) *Scheduler {
+	s := &Scheduler{Optimizer: optimizer, Schedule: schedule, BaseLR: optimizer.GetLR()}
+	optimizer.SetLR(s.LR())
+	return s
+}
+
+// Learning rate of the current step
+func (s *Scheduler) LR() float64 {
+	return s.Schedule.LR(s.BaseLR, s.StepCount)
+}
+
+// Moves on one step and sets the learning rate of the optimizer
+func (s *Scheduler) Step() {
+	s.StepCount++
+	s.Optimizer.SetLR(s.LR())
+}
+
+func (s *Scheduler) StateDict() State {
+	return State{Scalars: map[string]float64{
+		"baseLR":    s.BaseLR,
+		"stepCount": float64(s.StepCount),
+	}}
+}
+
+// Restores the step count and sets the learning rate of that step
+func (s *Scheduler) LoadStateDict(state State) error {
+	values, err := state.scalars("baseLR", "stepCount")
+	if err != nil {
+		return err
+	}
+	s.BaseLR, s.StepCount = values[0], int(values[1])
+	s.Optimizer.SetLR(s.LR())
+	return nil
+}
+
+// Runs Schedules[i] from step Milestones[i-1] on, each counting its steps from
+// where it starts, e.g. a linear warmup for 5 steps and then cosine annealing.
+// A later schedule starts from the base learning rate
+type SequentialLR struct {
+	Schedules  []Schedule
+	Milestones []int // increasing, one less than Schedules
+}
+
+func (s SequentialLR) LR(base float64, step int) float64 {
+	i, start := 0, 0
+	for i < len(s.Milestones) && i+1 < len(s.Schedules) && step >= s.Milestones[i] {
+		start = s.Milestones[i]
+		i++
+	}
+	return s.Schedules[i].LR(base, step-start)
+}
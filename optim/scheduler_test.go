@@ -0,0 +1,37 @@
+package optim
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSchedulerSetsLR(t *testing.T) {
+	sgd := NewSGD(nil, 0.1)
+	s := NewScheduler(sgd, LinearWarmup{WarmupSteps: 2, StartFactor: 0.5})
+	for i, want := range []float64{0.05, 0.075, 0.1, 0.1} {
+		if i > 0 {
+			s.Step()
+		}
+		if math.Abs(sgd.GetLR()-want) > 1e-12 {
+			t.Errorf("learning rate %v at step %d, expected %v", sgd.GetLR(), i, want)
+		}
+	}
+}
+
+func TestSchedulerStateDict(t *testing.T) {
+	sgd := NewSGD(nil, 0.1)
+	s := NewScheduler(sgd, StepLR{StepSize: 2, Gamma: 0.1})
+	s.Step()
+	s.Step()
+	restoredSGD := NewSGD(nil, 0.5)
+	restored := NewScheduler(restoredSGD, StepLR{StepSize: 2, Gamma: 0.1})
+	if err := restored.LoadStateDict(s.StateDict()); err != nil {
+		t.Fatal(err)
+	}
+	if restored.BaseLR != 0.1 || restored.StepCount != 2 || math.Abs(restoredSGD.GetLR()-0.01) > 1e-12 {
+		t.Errorf("restored base %v at step %d with lr %v, expected 0.1, 2 and 0.01", restored.BaseLR, restored.StepCount, restoredSGD.GetLR())
+	}
+	if err := restored.LoadStateDict(State{}); err == nil {
+		t.Error("an empty state loaded")
+	}
+}
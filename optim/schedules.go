@@ -0,0 +1,151 @@
+package optim
+
+import (
+	"math"
+	"sort"
+)
+
+// Multiplies the learning rate by Gamma every StepSize steps
+type StepLR struct {
+	StepSize int
+	Gamma    float64
+}
+
+func (s StepLR) LR(base float64, step int) float64 {
+	if s.StepSize <= 0 {
+		return base
+	}
+	return base * math.Pow(s.Gamma, float64(step/s.StepSize))
+}
+
+// Multiplies the learning rate by Gamma at every milestone
+type MultiStep struct {
+	Milestones []int // increasing
+	Gamma      float64
+}
+
+func (m MultiStep) LR(base float64, step int) float64 {
+	passed := sort.SearchInts(m.Milestones, step+1)
+	return base * math.Pow(m.Gamma, float64(passed))
+}
+
+// Multiplies the learning rate by Gamma every step
+type Exponential struct {
+	Gamma float64
+}
+
+func (e Exponential) LR(base float64, step int) float64 {
+	return base * math.Pow(e.Gamma, float64(step))
+}
+
+// Anneals from the base learning rate down to EtaMin along half a cosine over
+// TMax steps, then stays at EtaMin
+type CosineAnnealing struct {
+	TMax   int
+	EtaMin float64
+}
+
+func (c CosineAnnealing) LR(base float64, step int) float64 {
+	if c.TMax <= 0 || step >= c.TMax {
+		return c.EtaMin
+	}
+	return cosine(base, c.EtaMin, float64(step)/float64(c.TMax))
+}
+
+// Goes from base at progress 0 to end at progress 1 along half a cosine
+func cosine(base, end, progress float64) float64 {
+	return end + (base-end)*(1+math.Cos(math.Pi*progress))/2
+}
+
+// Cosine annealing that restarts from the base learning rate, first after T0
+// steps and then after periods TMult times longer than the one before
+type CosineWarmRestarts struct {
+	T0     int
+	TMult  int // 1 keeps the period fixed
+	EtaMin float64
+}
+
+func (c CosineWarmRestarts) LR(base float64, step int) float64 {
+	if c.T0 <= 0 {
+		return base
+	}
+	period := c.T0
+	for step >= period {
+		step -= period
+		if c.TMult > 1 {
+			period *= c.TMult
+		}
+	}
+	return cosine(base, c.EtaMin, float64(step)/float64(period))
+}
+
+// One cycle policy over TotalSteps. The learning rate rises from MaxLR/DivFactor
+// to MaxLR during the first PctStart of the steps and then anneals down to
+// MaxLR/(DivFactor*FinalDivFactor), both along cosines. A zero MaxLR means the
+// base learning rate and zero factors take the usual 0.3, 25 and 1e4
+type OneCycle struct {
+	TotalSteps     int
+	MaxLR          float64
+	PctStart       float64
+	DivFactor      float64
+	FinalDivFactor float64
+}
+
+func (o OneCycle) LR(base float64, step int) float64 {
+	maxLR, pct, div, finalDiv := o.MaxLR, o.PctStart, o.DivFactor, o.FinalDivFactor
+	if maxLR == 0 {
+		maxLR = base
+	}
+	if pct == 0 {
+		pct = 0.3
+	}
+	if div == 0 {
+		div = 25
+	}
+	if finalDiv == 0 {
+		finalDiv = 1e4
+	}
+	initial := maxLR / div
+	final := initial / finalDiv
+	if o.TotalSteps <= 1 {
+		return initial
+	}
+	last := float64(o.TotalSteps - 1)
+	warmEnd := pct*float64(o.TotalSteps) - 1
+	t := math.Min(float64(step), last)
+	if warmEnd > 0 && t <= warmEnd {
+		return cosine(initial, maxLR, t/warmEnd)
+	}
+	return cosine(maxLR, final, (t-warmEnd)/(last-warmEnd))
+}
+
+// Scales the learning rate linearly from StartFactor times the base up to the
+// base over WarmupSteps steps, then keeps it there
+type LinearWarmup struct {
+	WarmupSteps int
+	StartFactor float64
+}
+
+func (w LinearWarmup) LR(base float64, step int) float64 {
+	if step >= w.WarmupSteps {
+		return base
+	}
+	progress := float64(step) / float64(w.WarmupSteps)
+	return base * (w.StartFactor + (1-w.StartFactor)*progress)
+}
+
+// Decays from the base learning rate to EndLR over TotalSteps steps following
+// (1 - step/TotalSteps)^Power, a Power of 1 is a linear decay
+type Polynomial struct {
+	TotalSteps int
+	Power      float64
+	EndLR      float64
+}
+
+func (p Polynomial) LR(base float64, step int) float64 {
+	if p.TotalSteps <= 0 || step >= p.TotalSteps {
+		return p.EndLR
+	}
+	remaining := 1 - float64(step)/float64(p.TotalSteps)
+	return (base-p.EndLR)*math.Pow(remaining, p.Power) + p.EndLR
+}
@@ -0,0 +1,78 @@
+package optim
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestSchedules(t *testing.T) {
+	halfCos := func(progress float64) float64 { return (1 + math.Cos(math.Pi*progress)) / 2 }
+	warmupCosine := SequentialLR{
+		Schedules:  []Schedule{LinearWarmup{WarmupSteps: 5}, CosineAnnealing{TMax: 10}},
+		Milestones: []int{5},
+	}
+	oneCycle := OneCycle{TotalSteps: 100, MaxLR: 1}
+	custom := OneCycle{TotalSteps: 21, MaxLR: 2, PctStart: 0.5, DivFactor: 10, FinalDivFactor: 100}
+	tests := []struct {
+		name     string
+		schedule Schedule
+		base     float64
+		step     int
+		want     float64
+	}{
+		{"step", StepLR{StepSize: 3, Gamma: 0.5}, 1, 2, 1},
+		{"step decayed", StepLR{StepSize: 3, Gamma: 0.5}, 1, 7, 0.25},
+
+		// the decay applies from the milestone step itself
+		{"multistep before milestone", MultiStep{Milestones: []int{2, 5}, Gamma: 0.1}, 1, 1, 1},
+		{"multistep at milestone", MultiStep{Milestones: []int{2, 5}, Gamma: 0.1}, 1, 2, 0.1},
+		{"multistep before second", MultiStep{Milestones: []int{2, 5}, Gamma: 0.1}, 1, 4, 0.1},
+		{"multistep at second", MultiStep{Milestones: []int{2, 5}, Gamma: 0.1}, 1, 5, 0.01},
+
+		{"exponential", Exponential{Gamma: 0.9}, 2, 2, 2 * 0.81},
+		{"cosine halfway", CosineAnnealing{TMax: 10}, 1, 5, 0.5},
+		{"cosine after end", CosineAnnealing{TMax: 10, EtaMin: 0.1}, 1, 12, 0.1},
+
+		// periods of 5, 10 and 20 steps
+		{"restarts first period", CosineWarmRestarts{T0: 5, TMult: 2}, 1, 4, halfCos(0.8)},
+		{"restarts first restart", CosineWarmRestarts{T0: 5, TMult: 2}, 1, 5, 1},
+		{"restarts second period", CosineWarmRestarts{T0: 5, TMult: 2}, 1, 10, 0.5},
+		{"restarts end of second", CosineWarmRestarts{T0: 5, TMult: 2}, 1, 14, halfCos(0.9)},
+		{"restarts second restart", CosineWarmRestarts{T0: 5, TMult: 2}, 1, 15, 1},
+		{"restarts third period", CosineWarmRestarts{T0: 5, TMult: 2}, 1, 25, 0.5},
+		// periods of 2 and 6 steps
+		{"restarts tmult 3", CosineWarmRestarts{T0: 2, TMult: 3}, 1, 5, 0.5},
+		{"restarts tmult 3 restart", CosineWarmRestarts{T0: 2, TMult: 3}, 1, 8, 1},
+
+		// warms up over steps 0 to 29 and anneals over 29 to 99
+		{"one cycle start", oneCycle, 0, 0, 0.04},
+		{"one cycle peak", oneCycle, 0, 29, 1},
+		{"one cycle mid anneal", oneCycle, 0, 64, (1 + 4e-6) / 2},
+		{"one cycle end", oneCycle, 0, 99, 4e-6},
+		{"one cycle after end", oneCycle, 0, 150, 4e-6},
+		{"one cycle base as max", OneCycle{TotalSteps: 100}, 1, 29, 1},
+		{"one cycle custom start", custom, 0, 0, 0.2},
+		{"one cycle custom end", custom, 0, 20, 0.002},
+
+		{"warmup", LinearWarmup{WarmupSteps: 4, StartFactor: 0.2}, 1, 2, 0.6},
+		{"warmup done", LinearWarmup{WarmupSteps: 4, StartFactor: 0.2}, 1, 9, 1},
+		{"polynomial", Polynomial{TotalSteps: 10, Power: 2}, 1, 5, 0.25},
+		{"polynomial done", Polynomial{TotalSteps: 10, Power: 2, EndLR: 0.1}, 1, 10, 0.1},
+
+		// 5 warmup steps, then cosine annealing counted from step 5
+		{"warmup cosine start", warmupCosine, 1, 0, 0},
+		{"warmup cosine warming", warmupCosine, 1, 4, 0.8},
+		{"warmup cosine switch", warmupCosine, 1, 5, 1},
+		{"warmup cosine halfway", warmupCosine, 1, 10, 0.5},
+		{"warmup cosine end", warmupCosine, 1, 15, 0},
+		{"warmup cosine after end", warmupCosine, 1, 20, 0},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %d", tt.name, tt.step), func(t *testing.T) {
+			if got := tt.schedule.LR(tt.base, tt.step); math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("learning rate %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package optim
 
 import (
+	"fmt"
 	"nnscratch/layers"
 	"nnscratch/tensor"
 )
@@ -8,43 +9,185 @@ import (
 type Optimizer interface {
 	Step() error
 	ZeroGrad() 
+	Stateful
+	LRSetter
 }
 
+// Things that can save and restore what they keep between steps, like
+// optimizers and learning rate schedulers
+type Stateful interface {
+	// Copy of the state kept between steps, LoadStateDict restores it
+	StateDict() State
+	LoadStateDict(state State) error
+}
+
+// Optimizers whose learning rate can change between steps, as learning rate
+// schedulers do
+type LRSetter interface {
+	GetLR() float64
+	SetLR(lr float64)
+}
+
+// Evaluates the model again, computing the gradients of every parameter, and
+// gives the loss
+type Closure func() (float64, error)
+
+// Optimizers that evaluate the model several times per step, like LBFGS
+type ClosureOptimizer interface {
+	Step(closure Closure) (float64, error)
+	ZeroGrad()
+	Stateful
+	LRSetter
+}
+
+// Gives the storage of the parameter value to update in place, making the
+// value contiguous first when it is a view. Fails when the gradient does not
+// match the value
+func paramData(p *layers.Parameter) ([]float64, error) {
+	if p.Grad.Len() != p.Value.Len() {
+		return nil, fmt.Errorf("optim: gradient of shape %v for parameter of shape %v", p.Grad.Shape(), p.Value.Shape())
+	}
+	if !p.Value.IsContiguous() {
+		p.Value = p.Value.Contiguous()
+	}
+	return p.Value.Data(), nil
+}
+
+// Tensors filled with value shaped like every parameter, for optimizer state
+func filledLike(params []*layers.Parameter, value float64) []*tensor.Tensor {
+	ts := make([]*tensor.Tensor, len(params))
+	for i, p := range params {
+		ts[i], _ = tensor.NewTensor(p.Value.Shape()...)
+		if value != 0 {
+			data := ts[i].Data()
+			for j := range data {
+				data[j] = value
+			}
+		}
+	}
+	return ts
+}
+
+// Zeroes the gradients in place. Data panics on a strided view, so a
+// gradient that is not contiguous is made contiguous first
+func zeroGrads(params []*layers.Parameter) {
+	for _, p := range params {
+		if p.Grad == nil {
+			continue
+		}
+		p.Grad = p.Grad.Contiguous()
+		data := p.Grad.Data()
+		for i := range data {
+			data[i] = 0
+		}
+	}
+}
+
+// Stochastic gradient descent with optional momentum, Nesterov momentum and
+// L2 weight decay. With momentum the update follows the velocity
+// v = momentum*v + (1-dampening)*g, which starts as the first gradient
 type SGD struct {
 	Parameters []*layers.Parameter 
 	LR float64
+	Momentum float64
+	Dampening float64
+	Nesterov bool
+	WeightDecay float64
+	Velocity []*tensor.Tensor // one per parameter, nil until its first step
 }
 
-func NewSGD(params []*layers.Parameter, lr float64) *SGD {
+func NewSGD(params []*layers.Parameter, lr float64, opts ...Option) *SGD {
+	o := applyOptions(options{}, opts)
 	return &SGD{
 		Parameters: params,
 		LR: lr,
+		Momentum: o.momentum,
+		Dampening: o.dampening,
+		Nesterov: o.nesterov,
+		WeightDecay: o.weightDecay,
+		Velocity: make([]*tensor.Tensor, len(params)),
 	}
 }
 
 func (s *SGD) Step() error {
-	for _, p := range s.Parameters {
+	if s.Nesterov && (s.Momentum <= 0 || s.Dampening != 0) {
+		return fmt.Errorf("sgd: nesterov needs a positive momentum and no dampening")
+	}
+	if len(s.Velocity) != len(s.Parameters) {
+		s.Velocity = make([]*tensor.Tensor, len(s.Parameters))
+	}
+	for i, p := range s.Parameters {
 		if p.Grad == nil {
 			continue
 		}
-		update, err := p.Grad.MulScalar(s.LR)
+		value, err := paramData(p)
 		if err != nil {
 			return err
 		}
-		p.Value, err = tensor.TensorDiff(p.Value, update)
-		if err != nil {
-			return err
+		grad := p.Grad.Values()
+		var velocity []float64
+		first := false
+		if s.Momentum != 0 {
+			if s.Velocity[i] == nil {
+				s.Velocity[i], _ = tensor.NewTensor(p.Value.Shape()...)
+				first = true
+			}
+			velocity = s.Velocity[i].Data()
+		}
+		for j, g := range grad {
+			g += s.WeightDecay * value[j]
+			if velocity != nil {
+				if first {
+					velocity[j] = g
+				} else {
+					velocity[j] = s.Momentum*velocity[j] + (1-s.Dampening)*g
+				}
+				if s.Nesterov {
+					g += s.Momentum * velocity[j]
+				} else {
+					g = velocity[j]
+				}
+			}
+			value[j] -= s.LR * g
 		}
 	}
 	return nil 
 }
 
 func (s *SGD) ZeroGrad() {
-	for _, p := range s.Parameters {
-		if p.Grad != nil {
-			for i := range p.Grad.Data() {
-				p.Grad.Data()[i] = 0
-			}
-		}
+	zeroGrads(s.Parameters)
+}
+
+func (s *SGD) GetLR() float64 {
+	return s.LR
+}
+
+func (s *SGD) SetLR(lr float64) {
+	s.LR = lr
+}
+
+func (s *SGD) StateDict() State {
+	state := newState()
+	state.Scalars["lr"] = s.LR
+	state.Scalars["momentum"] = s.Momentum
+	state.Scalars["dampening"] = s.Dampening
+	state.Scalars["weightDecay"] = s.WeightDecay
+	state.Scalars["nesterov"] = flag(s.Nesterov)
+	state.Tensors["velocity"] = cloneTensors(s.Velocity)
+	return state
+}
+
+func (s *SGD) LoadStateDict(state State) error {
+	scalars, err := state.scalars("lr", "momentum", "dampening", "weightDecay", "nesterov")
+	if err != nil {
+		return err
+	}
+	velocity, err := state.tensors("velocity", s.Parameters)
+	if err != nil {
+		return err
 	}
+	s.LR, s.Momentum, s.Dampening, s.WeightDecay = scalars[0], scalars[1], scalars[2], scalars[3]
+	s.Nesterov = scalars[4] != 0
+	s.Velocity = velocity
+	return nil
 }
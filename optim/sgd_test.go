@@ -0,0 +1,156 @@
+package optim
+
+import (
+	"math"
+	"nnscratch/layers"
+	"nnscratch/tensor"
+	"testing"
+)
+
+func param(t *testing.T, values ...float64) *layers.Parameter {
+	t.Helper()
+	value, err := tensor.NewTensorInput(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grad, _ := tensor.NewTensor(len(values))
+	return &layers.Parameter{Value: value, Grad: grad}
+}
+
+// Runs steps of opt on f(x) = sum(x^2)/2, whose gradient is x
+func minimize(t *testing.T, opt Optimizer, p *layers.Parameter, steps int) {
+	t.Helper()
+	for i := 0; i < steps; i++ {
+		copy(p.Grad.Data(), p.Value.Data())
+		if err := opt.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func expectClose(t *testing.T, got, want []float64, tol float64) {
+	t.Helper()
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > tol {
+			t.Fatalf("got %v, expected %v", got, want)
+		}
+	}
+}
+
+func TestSGDFirstStep(t *testing.T) {
+	// x - lr * (x + decay * x)
+	p := param(t, 1, -2)
+	minimize(t, NewSGD([]*layers.Parameter{p}, 0.1, WithWeightDecay(0.5)), p, 1)
+	expectClose(t, p.Value.Data(), []float64{0.85, -1.7}, 1e-15)
+}
+
+func TestSGDMatchesReference(t *testing.T) {
+	tests := []struct {
+		name      string
+		momentum  float64
+		dampening float64
+		nesterov  bool
+		decay     float64
+	}{
+		{"plain", 0, 0, false, 0},
+		{"momentum", 0.9, 0, false, 0},
+		{"dampening and decay", 0.9, 0.3, false, 0.1},
+		{"nesterov", 0.9, 0, true, 0.1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []Option{WithMomentum(tt.momentum), WithDampening(tt.dampening), WithWeightDecay(tt.decay)}
+			if tt.nesterov {
+				opts = append(opts, WithNesterov())
+			}
+			p := param(t, 1, -2)
+			minimize(t, NewSGD([]*layers.Parameter{p}, 0.1, opts...), p, 5)
+
+			// the update written out as in the PyTorch docs
+			x := []float64{1, -2}
+			velocity := make([]float64, len(x))
+			for step := 0; step < 5; step++ {
+				for j := range x {
+					g := x[j] + tt.decay*x[j]
+					if tt.momentum != 0 {
+						if step == 0 {
+							velocity[j] = g
+						} else {
+							velocity[j] = tt.momentum*velocity[j] + (1-tt.dampening)*g
+						}
+						if tt.nesterov {
+							g += tt.momentum * velocity[j]
+						} else {
+							g = velocity[j]
+						}
+					}
+					x[j] -= 0.1 * g
+				}
+			}
+			expectClose(t, p.Value.Data(), x, 1e-15)
+		})
+	}
+}
+
+func TestSGDNesterovNeedsMomentum(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"no momentum", []Option{WithNesterov()}},
+		{"dampening", []Option{WithNesterov(), WithMomentum(0.9), WithDampening(0.1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := param(t, 1, 2)
+			if err := NewSGD([]*layers.Parameter{p}, 0.1, tt.opts...).Step(); err == nil {
+				t.Error("expected an error")
+			}
+			expectClose(t, p.Value.Data(), []float64{1, 2}, 0)
+		})
+	}
+}
+
+// Steps an optimizer, loads its state into a fresh one and checks both go on
+// the same way
+func expectStateRoundTrip(t *testing.T, build func(params []*layers.Parameter) Optimizer) {
+	t.Helper()
+	p := param(t, 1, -2)
+	opt := build([]*layers.Parameter{p})
+	minimize(t, opt, p, 2)
+
+	q := param(t, p.Value.Data()...)
+	restored := build([]*layers.Parameter{q})
+	restored.SetLR(100)
+	if err := restored.LoadStateDict(opt.StateDict()); err != nil {
+		t.Fatal(err)
+	}
+	minimize(t, opt, p, 3)
+	minimize(t, restored, q, 3)
+	expectClose(t, q.Value.Data(), p.Value.Data(), 0)
+}
+
+func TestSGDStateDict(t *testing.T) {
+	expectStateRoundTrip(t, func(params []*layers.Parameter) Optimizer {
+		return NewSGD(params, 0.1, WithMomentum(0.9))
+	})
+}
+
+func TestZeroGradOfView(t *testing.T) {
+	value, _ := tensor.NewTensorOnes(2, 3)
+	grad, _ := tensor.NewTensorInput([][]float64{{1, 2}, {3, 4}, {5, 6}})
+	// a transposed view, which has no storage of its own to zero
+	view, err := grad.Transpose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &layers.Parameter{Value: value, Grad: view}
+	sgd := NewSGD([]*layers.Parameter{p}, 0.1)
+	sgd.ZeroGrad()
+	expectClose(t, p.Grad.Values(), make([]float64, 6), 0)
+	// a step with the zeroed gradient leaves the value alone
+	if err := sgd.Step(); err != nil {
+		t.Fatal(err)
+	}
+	expectClose(t, p.Value.Data(), []float64{1, 1, 1, 1, 1, 1}, 0)
+}
@@ -0,0 +1,72 @@
+package optim
+
+import (
+	"fmt"
+	"nnscratch/layers"
+	"nnscratch/tensor"
+)
+
+// What an optimizer keeps between steps, like the step count and the moments
+// of Adam, so a run can stop and carry on from the same point. Entries of
+// Tensors mostly hold one tensor per parameter, nil where none is kept yet
+type State struct {
+	Scalars map[string]float64
+	Tensors map[string][]*tensor.Tensor
+}
+
+func newState() State {
+	return State{
+		Scalars: make(map[string]float64),
+		Tensors: make(map[string][]*tensor.Tensor),
+	}
+}
+
+// Copies of the tensors so later steps don't change a saved state
+func cloneTensors(ts []*tensor.Tensor) []*tensor.Tensor {
+	out := make([]*tensor.Tensor, len(ts))
+	for i, t := range ts {
+		if t != nil {
+			out[i] = t.Copy()
+		}
+	}
+	return out
+}
+
+// Gives the saved scalars of the names in order
+func (s State) scalars(names ...string) ([]float64, error) {
+	values := make([]float64, len(names))
+	for i, name := range names {
+		v, ok := s.Scalars[name]
+		if !ok {
+			return nil, fmt.Errorf("optim: state has no %q", name)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// Flags are saved as 1 and 0
+func flag(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Gives copies of the saved tensors of name after checking there is one per
+// parameter with the parameter's shape
+func (s State) tensors(name string, params []*layers.Parameter) ([]*tensor.Tensor, error) {
+	saved, ok := s.Tensors[name]
+	if !ok {
+		return nil, fmt.Errorf("optim: state has no %q", name)
+	}
+	if len(saved) != len(params) {
+		return nil, fmt.Errorf("optim: state %q has %d tensors for %d parameters", name, len(saved), len(params))
+	}
+	for i, t := range saved {
+		if t != nil && !tensor.ShapesMatch(t, params[i].Value) {
+			return nil, fmt.Errorf("optim: state %q tensor %d has shape %v but the parameter has %v", name, i, t.Shape(), params[i].Value.Shape())
+		}
+	}
+	return cloneTensors(saved), nil
+}
@@ -0,0 +1,134 @@
+// Package random gives seedable random number generators whose state can be
+// read back and restored, so runs and checkpoints are reproducible.
+package random
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Source is a splitmix64 generator, its whole state is one uint64
+type Source struct {
+	state uint64
+}
+
+func NewSource(seed int64) *Source {
+	return &Source{state: uint64(seed)}
+}
+
+func (s *Source) Seed(seed int64) {
+	s.state = uint64(seed)
+}
+
+func (s *Source) Uint64() uint64 {
+	s.state += 0x9e3779b97f4a7c15
+	z := s.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+func (s *Source) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+func (s *Source) State() uint64 {
+	return s.state
+}
+
+func (s *Source) SetState(state uint64) {
+	s.state = state
+}
+
+// A source whose state can be read back, Source and lockedSource
+type stateSource interface {
+	rand.Source64
+	State() uint64
+	SetState(state uint64)
+}
+
+// Source guarded by a mutex so the default generator can be shared between
+// goroutines like the math/rand global one
+type lockedSource struct {
+	mu  sync.Mutex
+	src *Source
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	s.src.Seed(seed)
+	s.mu.Unlock()
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Uint64()
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) State() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.State()
+}
+
+func (s *lockedSource) SetState(state uint64) {
+	s.mu.Lock()
+	s.src.SetState(state)
+	s.mu.Unlock()
+}
+
+// Generator is a rand.Rand over a Source. One made by New is not safe for
+// concurrent use, the Default one is
+type Generator struct {
+	*rand.Rand
+	src stateSource
+}
+
+func New(seed int64) *Generator {
+	src := NewSource(seed)
+	return &Generator{Rand: rand.New(src), src: src}
+}
+
+// State to give to SetState to continue from this point
+func (g *Generator) State() uint64 {
+	return g.src.State()
+}
+
+func (g *Generator) SetState(state uint64) {
+	g.src.SetState(state)
+}
+
+// Gives 1 with probability p and 0 otherwise
+func (g *Generator) Bernoulli(p float64) float64 {
+	if g.Float64() < p {
+		return 1
+	}
+	return 0
+}
+
+var defaultGen = newLocked(time.Now().UnixNano())
+
+func newLocked(seed int64) *Generator {
+	src := &lockedSource{src: NewSource(seed)}
+	return &Generator{Rand: rand.New(src), src: src}
+}
+
+// Default generator used by tensor initialisation, data loaders and dropout
+// when they are not given their own. It starts from the time unless Seed is
+// called and can be used from several goroutines
+func Default() *Generator {
+	return defaultGen
+}
+
+// Seeds the default generator
+func Seed(seed int64) {
+	defaultGen.Seed(seed)
+}
@@ -0,0 +1,56 @@
+package random
+
+import (
+	"sync"
+	"testing"
+)
+
+func draws(g *Generator, n int) []float64 {
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = g.NormFloat64()
+	}
+	return values
+}
+
+func TestSeedAndState(t *testing.T) {
+	a, b := New(42), New(42)
+	first := draws(a, 5)
+	for i, v := range draws(b, 5) {
+		if v != first[i] {
+			t.Fatalf("two generators seeded with 42 differ at draw %d", i)
+		}
+	}
+
+	// restoring a state replays what came after it
+	state := a.State()
+	next := draws(a, 5)
+	a.SetState(state)
+	for i, v := range draws(a, 5) {
+		if v != next[i] {
+			t.Fatalf("draw %d after SetState is %v, expected %v", i, v, next[i])
+		}
+	}
+}
+
+func TestDefault(t *testing.T) {
+	Seed(7)
+	want := draws(New(7), 5)
+	for i, v := range draws(Default(), 5) {
+		if v != want[i] {
+			t.Fatalf("default generator seeded with 7 differs from New(7) at draw %d", i)
+		}
+	}
+
+	// the default generator is shared, go test -race checks this
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			draws(Default(), 1000)
+			Default().Shuffle(10, func(i, j int) {})
+		}()
+	}
+	wg.Wait()
+}
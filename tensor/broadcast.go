@@ -0,0 +1,143 @@
+package tensor
+
+import (
+	"fmt"
+)
+
+// Gives the shape two shapes broadcast to. Shapes are lined up from the right,
+// missing leading dimensions count as 1 and a dimension of 1 stretches to
+// match the other one: [4, 1, 3] and [2, 1] -> [4, 2, 3]
+func BroadcastShapes(a, b []int) ([]int, error) {
+	n := len(a)
+	if len(b) > n {
+		n = len(b)
+	}
+	result := make([]int, n)
+	for i := 1; i <= n; i++ {
+		da, db := 1, 1
+		if i <= len(a) {
+			da = a[len(a)-i]
+		}
+		if i <= len(b) {
+			db = b[len(b)-i]
+		}
+		switch {
+		case da == db || db == 1:
+			result[n-i] = da
+		case da == 1:
+			result[n-i] = db
+		default:
+			return nil, fmt.Errorf("shapes %v and %v cannot be broadcast together", a, b)
+		}
+	}
+	return result, nil
+}
+
+// Broadcast the tensor to the given shape without copying
+func (t *Tensor) BroadcastTo(shape ...int) (*Tensor, error) {
+	target, err := BroadcastShapes(t.shape, shape)
+	if err != nil || !listMatch(target, shape) {
+		return nil, fmt.Errorf("broadcastTo: cannot broadcast %v to %v", t.shape, shape)
+	}
+	return t.Expand(shape...)
+}
+
+// Calls fn for every position of shape in row major order with the data index
+// of each operand, the operands must already have the given shape
+func walk(shape []int, operands []*Tensor, fn func(i int, idx []int)) {
+	size := 1
+	for _, dim := range shape {
+		size *= dim
+	}
+	idx := make([]int, len(operands))
+	for k, op := range operands {
+		idx[k] = op.offset
+	}
+	coords := make([]int, len(shape))
+	for i := 0; i < size; i++ {
+		fn(i, idx)
+		for d := len(shape) - 1; d >= 0; d-- {
+			coords[d]++
+			for k, op := range operands {
+				idx[k] += op.strides[d]
+			}
+			if coords[d] < shape[d] {
+				break
+			}
+			for k, op := range operands {
+				idx[k] -= coords[d] * op.strides[d]
+			}
+			coords[d] = 0
+		}
+	}
+}
+
+// Applies fn elementwise over a and b after broadcasting them together,
+// name is used to tell which op failed in the error
+func broadcastBinary(name string, a, b *Tensor, fn func(x, y float64) float64) (*Tensor, error) {
+	if ShapesMatch(a, b) && a.IsContiguous() && b.IsContiguous() {
+		result, _ := NewTensor(a.shape...)
+		av, bv := a.values(), b.values()
+		for i := range result.data {
+			result.data[i] = fn(av[i], bv[i])
+		}
+		return result, nil
+	}
+	shape, err := BroadcastShapes(a.shape, b.shape)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	ae, err := a.Expand(shape...)
+	if err != nil {
+		return nil, err
+	}
+	be, err := b.Expand(shape...)
+	if err != nil {
+		return nil, err
+	}
+	result, _ := NewTensor(shape...)
+	walk(shape, []*Tensor{ae, be}, func(i int, idx []int) {
+		result.data[i] = fn(ae.data[idx[0]], be.data[idx[1]])
+	})
+	return result, nil
+}
+
+// Gives 1 where the condition holds and 0 where it does not
+func indicator(cond bool) float64 {
+	if cond {
+		return 1
+	}
+	return 0
+}
+
+// Sums a broadcast tensor back down to shape, the reverse of BroadcastTo.
+// This is what the gradient of a broadcast op needs
+func (t *Tensor) SumTo(shape ...int) (*Tensor, error) {
+	if listMatch(t.shape, shape) {
+		return t, nil
+	}
+	lead := len(t.shape) - len(shape)
+	if lead < 0 {
+		return nil, fmt.Errorf("sumTo: cannot sum %v down to %v", t.shape, shape)
+	}
+	var axes []int
+	for i := range t.shape {
+		switch {
+		case i < lead:
+			axes = append(axes, i)
+		case shape[i-lead] == t.shape[i]:
+		case shape[i-lead] == 1:
+			axes = append(axes, i)
+		default:
+			return nil, fmt.Errorf("sumTo: cannot sum %v down to %v", t.shape, shape)
+		}
+	}
+	if len(axes) == 0 {
+		return t.Reshape(shape...)
+	}
+	sum, err := t.SumAxis(true, axes...)
+	if err != nil {
+		return nil, err
+	}
+	return sum.Reshape(shape...)
+}
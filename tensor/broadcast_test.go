@@ -0,0 +1,104 @@
+package tensor
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBroadcastShapes(t *testing.T) {
+	tests := []struct {
+		a, b []int
+		want []int // nil when the shapes cannot be broadcast
+	}{
+		{[]int{2, 3}, []int{2, 3}, []int{2, 3}},
+		{[]int{2, 3}, []int{3}, []int{2, 3}},
+		{[]int{3}, []int{2, 3}, []int{2, 3}},
+		{[]int{4, 1, 3}, []int{2, 1}, []int{4, 2, 3}},
+		{[]int{1}, []int{2, 3, 4}, []int{2, 3, 4}},
+		{[]int{5, 1}, []int{1, 6}, []int{5, 6}},
+		{[]int{2, 3}, []int{4}, nil},
+		{[]int{2, 3}, []int{3, 3}, nil},
+		{[]int{2, 1, 3}, []int{4, 2}, nil},
+	}
+	for _, tt := range tests {
+		got, err := BroadcastShapes(tt.a, tt.b)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%v and %v broadcast to %v, expected an error", tt.a, tt.b, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v and %v: %v", tt.a, tt.b, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%v and %v broadcast to %v, expected %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestBroadcastBinary(t *testing.T) {
+	matrix, _ := NewTensorInput([][]float64{{1, 2, 3}, {4, 5, 6}})
+	row, _ := NewTensorInput([]float64{10, 20, 30})
+	col, _ := NewTensorInput([][]float64{{1}, {2}})
+	scalar, _ := NewTensorInput([]float64{2})
+	transposed, _ := matrix.Transpose()
+	tests := []struct {
+		name  string
+		op    func(a, b *Tensor) (*Tensor, error)
+		a, b  *Tensor
+		shape []int
+		want  []float64
+	}{
+		{"same shape", TensorAdd, matrix, matrix, []int{2, 3}, []float64{2, 4, 6, 8, 10, 12}},
+		{"rank promotion", TensorAdd, matrix, row, []int{2, 3}, []float64{11, 22, 33, 14, 25, 36}},
+		{"rank promotion on the left", TensorDiff, row, matrix, []int{2, 3}, []float64{9, 18, 27, 6, 15, 24}},
+		{"size 1 column", TensorMul, matrix, col, []int{2, 3}, []float64{1, 2, 3, 8, 10, 12}},
+		{"column and row", TensorDiff, col, row, []int{2, 3}, []float64{-9, -19, -29, -8, -18, -28}},
+		{"single element", TensorDiv, matrix, scalar, []int{2, 3}, []float64{0.5, 1, 1.5, 2, 2.5, 3}},
+		{"pow", TensorPow, matrix, scalar, []int{2, 3}, []float64{1, 4, 9, 16, 25, 36}},
+		{"min", TensorMin, matrix, col, []int{2, 3}, []float64{1, 1, 1, 2, 2, 2}},
+		{"max", TensorMax, matrix, col, []int{2, 3}, []float64{1, 2, 3, 4, 5, 6}},
+		{"greater", TensorGreater, matrix, col, []int{2, 3}, []float64{0, 1, 1, 1, 1, 1}},
+		{"lessEqual", TensorLessEqual, matrix, scalar, []int{2, 3}, []float64{1, 1, 0, 0, 0, 0}},
+		{"equal", TensorEqual, col, scalar, []int{2, 1}, []float64{0, 1}},
+		{"strided operand", TensorAdd, transposed, reshape(t, col, 1, 2), []int{3, 2}, []float64{2, 6, 3, 7, 4, 8}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.op(tt.a, tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got.Shape(), tt.shape) || !slices.Equal(got.Data(), tt.want) {
+				t.Errorf("got %v with shape %v, expected %v with shape %v", got.Data(), got.Shape(), tt.want, tt.shape)
+			}
+		})
+	}
+}
+
+func TestBroadcastBinaryError(t *testing.T) {
+	a, _ := NewTensor(2, 3)
+	b, _ := NewTensor(4)
+	_, err := TensorMul(a, b)
+	if err == nil {
+		t.Fatal("multiplying [2 3] by [4] gave no error")
+	}
+	// the error names the op and both shapes
+	for _, part := range []string{"tensorMul", "[2 3]", "[4]"} {
+		if !strings.Contains(err.Error(), part) {
+			t.Errorf("error %q does not mention %s", err, part)
+		}
+	}
+}
+
+func reshape(t *testing.T, x *Tensor, shape ...int) *Tensor {
+	t.Helper()
+	result, err := x.Reshape(shape...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
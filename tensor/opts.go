@@ -2,13 +2,14 @@ package tensor
 
 import (
 	"fmt"
+	"nnscratch/maths"
 )
 
 // Gives sum of all the values in the tensor
 func (t *Tensor) Sum() (float64, error) {
 	result := 0.0
-	for i := range(t.data) {
-		result += t.data[i]
+	for _, val := range t.values() {
+		result += val
 	}
 	return result, nil
 }
@@ -28,8 +29,8 @@ func (t *Tensor) AddScalar(other float64) (*Tensor, error) {
 	if err != nil {
 		return nil, err
 	}
-	for i := range result.data {
-		result.data[i] = t.data[i] + other
+	for i, val := range t.values() {
+		result.data[i] = val + other
 	}
 	return result, nil
 }
@@ -40,71 +41,101 @@ func (t *Tensor) MulScalar(other float64) (*Tensor, error) {
 	if err != nil {
 		return nil, err
 	}
-	for i := range result.data {
-		result.data[i] = t.data[i] * other
+	for i, val := range t.values() {
+		result.data[i] = val * other
 	}
 	return result, nil
 }
 
-// Perform element wise addition for tensors of same shape
-// This also included broadcasting now
+// Perform element wise addition, the shapes are broadcast together
 func TensorAdd(a *Tensor, b *Tensor) (*Tensor, error) {
-	if len(a.shape) != len((b.shape)) {
-		return nil, fmt.Errorf("add: tensor shapes or brodcast do not match %v and %v", a.shape, b.shape)
-	}
-	if !ShapesMatch(a, b) && b.shape[0] != 1{
-		return nil, fmt.Errorf("add: tensor shapes or brodcast do not match %v and %v", a.shape, b.shape)
-	}
-	if len(a.shape) > 1 {
-		if b.shape[0] == 1 && !listMatch(a.shape[1:], b.shape[1:]){
-			return nil, fmt.Errorf("add: tensor shapes or brodcast do not match %v and %v", a.shape, b.shape)
-		}
-	}
-	result, _ := NewTensor(a.shape...)
-	if b.shape[0] == 1 && b.shape[0] != a.shape[0] {
-		for i := range a.shape[0] {
-			for j := 0; j < b.size; j++ {
-				result.data[i*a.strides[0] + j] = a.data[i*a.strides[0] + j] + b.data[j]
-			}
-		}
-		return result, nil 
-	}
-	for i := 0; i < a.size; i++ {
-		result.data[i] = a.data[i] + b.data[i]
-	}
-	return result, nil
+	return broadcastBinary("add", a, b, func(x, y float64) float64 {
+		return x + y
+	})
 }
 
-// Element wise difference between tow tensors of the same shape
+// Element wise difference between two tensors, the shapes are broadcast together
 func TensorDiff(a *Tensor, b *Tensor) (*Tensor, error) {
-	if !ShapesMatch(a, b) {
-		return nil, fmt.Errorf("tensorDiff: tensor shapes do not match %v, %v", a.shape, b.shape)
-	}
-	result, _ := NewTensor(a.shape...)
-	for i:=0; i<a.size; i++ {
-		result.data[i] = a.data[i] - b.data[i]
-	}
-	return result, nil
+	return broadcastBinary("tensorDiff", a, b, func(x, y float64) float64 {
+		return x - y
+	})
 }
 
-// Element wise multiplication of tensors of the same shape
-func  TensorMul(a *Tensor, b *Tensor) (*Tensor, error) {
-	if !ShapesMatch(a, b) {
-		return nil, fmt.Errorf("tensorMul: tensor shapes do not match %v and %v", a.shape, b.shape)
-	}
-	result, _ := NewTensor(a.shape...)
-	for i := 0; i < a.size; i++ {
-		result.data[i] = a.data[i] * b.data[i]
-	}
-	return result, nil
+// Element wise multiplication of tensors, the shapes are broadcast together
+func TensorMul(a *Tensor, b *Tensor) (*Tensor, error) {
+	return broadcastBinary("tensorMul", a, b, func(x, y float64) float64 {
+		return x * y
+	})
 }
 
+// Element wise division of tensors, the shapes are broadcast together
 func TensorDiv(a *Tensor, b *Tensor) (*Tensor, error) {
-	denom,err := b.Power(-1)
-	if err != nil {
-		return nil, err
-	}
-	return TensorMul(a, denom)
+	return broadcastBinary("tensorDiv", a, b, func(x, y float64) float64 {
+		return x / y
+	})
+}
+
+// Raises every value of a to the matching value of b, the shapes are broadcast together
+func TensorPow(a *Tensor, b *Tensor) (*Tensor, error) {
+	return broadcastBinary("tensorPow", a, b, maths.Power)
+}
+
+// Element wise minimum of two tensors, the shapes are broadcast together
+func TensorMin(a *Tensor, b *Tensor) (*Tensor, error) {
+	return broadcastBinary("tensorMin", a, b, func(x, y float64) float64 {
+		if y < x {
+			return y
+		}
+		return x
+	})
+}
+
+// Element wise maximum of two tensors, the shapes are broadcast together
+func TensorMax(a *Tensor, b *Tensor) (*Tensor, error) {
+	return broadcastBinary("tensorMax", a, b, func(x, y float64) float64 {
+		if y > x {
+			return y
+		}
+		return x
+	})
+}
+
+// The comparisons give 1 where the comparison holds and 0 elsewhere,
+// the shapes are broadcast together
+func TensorEqual(a *Tensor, b *Tensor) (*Tensor, error) {
+	return broadcastBinary("tensorEqual", a, b, func(x, y float64) float64 {
+		return indicator(x == y)
+	})
+}
+
+func TensorNotEqual(a *Tensor, b *Tensor) (*Tensor, error) {
+	return broadcastBinary("tensorNotEqual", a, b, func(x, y float64) float64 {
+		return indicator(x != y)
+	})
+}
+
+func TensorGreater(a *Tensor, b *Tensor) (*Tensor, error) {
+	return broadcastBinary("tensorGreater", a, b, func(x, y float64) float64 {
+		return indicator(x > y)
+	})
+}
+
+func TensorGreaterEqual(a *Tensor, b *Tensor) (*Tensor, error) {
+	return broadcastBinary("tensorGreaterEqual", a, b, func(x, y float64) float64 {
+		return indicator(x >= y)
+	})
+}
+
+func TensorLess(a *Tensor, b *Tensor) (*Tensor, error) {
+	return broadcastBinary("tensorLess", a, b, func(x, y float64) float64 {
+		return indicator(x < y)
+	})
+}
+
+func TensorLessEqual(a *Tensor, b *Tensor) (*Tensor, error) {
+	return broadcastBinary("tensorLessEqual", a, b, func(x, y float64) float64 {
+		return indicator(x <= y)
+	})
 }
 
 func listMatch(a, b []int) bool {
@@ -133,36 +164,73 @@ func TensorCombine(a *Tensor, b *Tensor) (*Tensor, error) {
 		if err != nil {
 			return nil, err
 		}
-		for i := range(result.data) {
-			if i > len(a.data)-1 {
-				result.data[i] = b.data[i-len(a.data)]
-			} else {
-				result.data[i] = a.data[i]
-			}
-		}
+		copy(result.data, a.values())
+		copy(result.data[a.size:], b.values())
 		return result, nil
 	}
 
 	// When tensor b is one rank lower than a 
 	if listMatch(a.shape[1:], b.shape) {
-		newshape := a.shape
+		newshape := append([]int(nil), a.shape...)
 		newshape[0] += 1
 		result, err := NewTensor(newshape...)
 		if err != nil {
 			return nil, err
 		}
-		for i := range(result.data) {
-			if i > len(a.data) - 1 {
-				result.data[i] = b.data[i-len(a.data)]
-			} else {
-				result.data[i] = a.data[i]
-			}
-		}
+		copy(result.data, a.values())
+		copy(result.data[a.size:], b.values())
 		return result, nil 
 	}
 	return nil, fmt.Errorf("for some reason there is an error Good luck finding why")
 }
 
+// Joins tensors along an existing axis, every other dimension must match
+// [a, b, c] + [a, d, c] on axis 1 -> [a, b+d, c]
+func Concat(axis int, ts ...*Tensor) (*Tensor, error) {
+	if len(ts) == 0 {
+		return nil, fmt.Errorf("concat: needs at least one tensor")
+	}
+	first := ts[0]
+	axis, err := first.axis(axis)
+	if err != nil {
+		return nil, err
+	}
+	shape := append([]int(nil), first.shape...)
+	shape[axis] = 0
+	for _, t := range ts {
+		if len(t.shape) != len(shape) {
+			return nil, fmt.Errorf("concat: tensors must have the same rank got %v and %v", first.shape, t.shape)
+		}
+		for d := range shape {
+			if d != axis && t.shape[d] != first.shape[d] {
+				return nil, fmt.Errorf("concat: shapes %v and %v differ outside axis %d", first.shape, t.shape, axis)
+			}
+		}
+		shape[axis] += t.shape[axis]
+	}
+	result, err := NewTensor(shape...)
+	if err != nil {
+		return nil, err
+	}
+
+	// every tensor gives one block per index of the axes before axis
+	outer := 1
+	for _, dim := range shape[:axis] {
+		outer *= dim
+	}
+	row := result.size / outer
+	start := 0
+	for _, t := range ts {
+		values := t.values()
+		block := t.size / outer
+		for o := 0; o < outer; o++ {
+			copy(result.data[o*row+start:o*row+start+block], values[o*block:(o+1)*block])
+		}
+		start += block
+	}
+	return result, nil
+}
+
 
 // Matrix multiplication on two teensors look inside for all the kinds or muls
 func Matmul(a *Tensor, b *Tensor) (*Tensor, error) {
@@ -173,8 +241,9 @@ func Matmul(a *Tensor, b *Tensor) (*Tensor, error) {
 		}
 		result, _ := NewTensor(1)
 		result.data[0] = 0
+		av, bv := a.values(), b.values()
 		for i := 0; i < a.size; i++ {
-			result.data[0] += a.data[i] * b.data[i]
+			result.data[0] += av[i] * bv[i]
 		}
 		return result, nil
 	}
@@ -185,15 +254,16 @@ func Matmul(a *Tensor, b *Tensor) (*Tensor, error) {
 			return nil, fmt.Errorf("the 2d tensors should have dims (m, k), (k, p) they are %v, %v", a.shape, b.shape)
 		}
 		result, _ := NewTensor(a.shape[0], b.shape[1])
+		// index the data through the strides directly so transposed views need no copy
 		for i := 0; i < a.shape[0]; i++ {
+			rowA := a.offset + i*a.strides[0]
 			for j := 0; j < b.shape[1]; j++ {
+				idxB := b.offset + j*b.strides[1]
 				val := 0.0
 				for k := 0; k < a.shape[1]; k++ {
-					val1, _ := a.Get(i, k)
-					val2, _ := b.Get(k, j)
-					val += val1 * val2
+					val += a.data[rowA+k*a.strides[1]] * b.data[idxB+k*b.strides[0]]
 				}
-				result.Set(val, i, j)
+				result.data[i*b.shape[1]+j] = val
 			}
 		}
 		return result, nil
@@ -210,122 +280,103 @@ func Matmul(a *Tensor, b *Tensor) (*Tensor, error) {
 			for j := 0; j < a.shape[1]; j++ {
 				val1, _ := a.Get(i, j)
 				val2, _ := b.Get(j)
-				val += val1 + val2
+				val += val1 * val2
 			}
 			result.Set(val, i)
 		}
 		return result, nil
 	}
 
-	// if more than 2d tensors then do matrix multiplication on their 2d slices if possible (..., m, k) * (..., k, p) => (..., m, p) the ... should be same
+	// if more than 2d tensors then do matrix multiplication on their 2d slices if possible (..., m, k) * (..., k, p) => (..., m, p) the ... should broadcast together
 	if len(a.shape) == len(b.shape) && len(a.shape) > 2 {
-		if a.shape[len(a.shape)-2] != b.shape[len(a.shape)-1] {
+		n := len(a.shape) - 2
+		if a.shape[n+1] != b.shape[n] {
 			return nil, fmt.Errorf("the n'd tensors should have the dims (..., m, k), (..., k, p) they are %v, %v", a.shape, b.shape)
 		}
-		n := len(a.shape) - 2
-		coord := make([]int, n)
-		newShape := a.shape
-		newShape[n+1] = b.shape[n+1]
-		result, _ := NewTensor(newShape...)
-
-		total := 1
-		for _, dim := range a.shape[:n] {
-			total *= dim
+		batch, err := BroadcastShapes(a.shape[:n], b.shape[:n])
+		if err != nil {
+			return nil, fmt.Errorf("the n'd tensors should have matching batch dims they are %v, %v", a.shape, b.shape)
 		}
+		m, k, p := a.shape[n], a.shape[n+1], b.shape[n+1]
+		a, _ = a.BroadcastTo(append(append([]int(nil), batch...), m, k)...)
+		b, _ = b.BroadcastTo(append(append([]int(nil), batch...), k, p)...)
+		result, _ := NewTensor(append(append([]int(nil), batch...), m, p)...)
 
-		for i := 0; i < total; i++ {
-			newCoord := make([]int, n)
-			copy(newCoord, coord)
-			for m := 0; m < a.shape[n]; m++ {
-				for p := 0; p < b.shape[n+1]; p++ {
+		// walk the batch dims and index every 2d slice through the strides
+		walk(batch, []*Tensor{a, b}, func(i int, idx []int) {
+			out := result.data[i*m*p : (i+1)*m*p]
+			for r := 0; r < m; r++ {
+				rowA := idx[0] + r*a.strides[n]
+				for c := 0; c < p; c++ {
+					idxB := idx[1] + c*b.strides[n+1]
 					val := 0.0
-					for k := 0; k < a.shape[n+1]; k++ {
-						arr1 := append(newCoord, m, k)
-						arr2 := append(newCoord, k, p)
-						val1, _ := a.Get(arr1...)
-						val2, _ := b.Get(arr2...)
-						val += val1 * val2
+					for q := 0; q < k; q++ {
+						val += a.data[rowA+q*a.strides[n+1]] * b.data[idxB+q*b.strides[n]]
 					}
-					arr3 := append(newCoord, m, p)
-					result.Set(val, arr3...)
+					out[r*p+c] = val
 				}
 			}
-			for j := n - 1; j >= 0; j-- {
-				coord[j]++
-				if coord[j] < a.shape[j] {
-					break
-				}
-				coord[j] = 0
-			}
-		}
+		})
 		return result, nil
 	}
 	return nil, fmt.Errorf("something wrong last %v, %v", a.shape, b.shape)
 }
 
-// Transpose a tensor [n, m] -> [m, n] 
+// Transpose a tensor [n, m] -> [m, n], the result shares data with t
 func (t *Tensor) Transpose() (*Tensor, error) {
 	if len(t.shape) != 2 {
 		return nil, fmt.Errorf("transpose: Input should be a 2d tensor")
 	}
-	result, _ := NewTensor(t.shape[1], t.shape[0])
-	for i := 0; i < t.shape[0]; i++ {
-		for j := 0; j < t.shape[1]; j++ {
-			val, _ := t.Get(i, j)
-			result.Set(val, j, i)
-		}
-	}
-	return result, nil
+	return t.TransposeAxes(0, 1)
 }
 
-// Reshape a given tensor to the input shape
+// Reshape a given tensor to the input shape, one dimension can be -1 to be
+// worked out from the others. Contiguous tensors are reshaped without copying
 func (t *Tensor) Reshape(shape ...int) (*Tensor, error) {
-	mul1 := 1
-	for _, i := range t.shape {
-		mul1 *= i
-	}
+	shape = append([]int(nil), shape...)
+	infer := -1
 	mul2 := 1
-	for _, i := range shape {
-		mul2 *= i
+	for i, dim := range shape {
+		if dim == -1 && infer == -1 {
+			infer = i
+			continue
+		}
+		mul2 *= dim
 	}
-
-	if mul1 != mul2 {
-		return nil, fmt.Errorf("reshape: The given shape cannot fit the data in the tensor - %v, %v", mul1, mul2)
+	if infer != -1 && mul2 > 0 && t.size%mul2 == 0 {
+		shape[infer] = t.size / mul2
+		mul2 *= shape[infer]
 	}
-	result, err := NewTensor(shape...)
-	if err != nil {
-		// handle error
-		return nil, err
+
+	if t.size != mul2 {
+		return nil, fmt.Errorf("reshape: The given shape cannot fit the data in the tensor - %v, %v", t.size, mul2)
 	}
-	for i := range result.data {
-		result.data[i] = t.data[i]
+	for _, dim := range shape {
+		if dim <= 0 {
+			return nil, fmt.Errorf("reshape: dimensions must be positive :%v", shape)
+		}
 	}
-	return result, nil
+	c := t.Contiguous()
+	return newView(c.data, shape, contiguousStrides(shape), c.offset), nil
 }
 
 // Flatten the tensor to a 1d vector
 func (t *Tensor) Flatten() (*Tensor, error) {
-	mul := 1
-	for _, i := range t.shape {
-		mul *= i
-	}
-	result, err := NewTensor(mul)
-	if err != nil {
-		return nil, err
-	}
-	copy(result.data, t.data)
-	return result, nil
+	return t.Reshape(t.size)
 }
 
 // Add 1 to the dimention of the tensor at the input value
 func (t *Tensor) Unsqeeze(pos int) (*Tensor, error) {
-	firstPart := t.shape[:pos]
-	secondPartt := t.shape[pos:]
-	newSlice := append(firstPart, 1)
-	newSlice = append(newSlice, secondPartt...)
-	result, err := t.Reshape(newSlice...)
-	if err != nil {
-		return nil, err
-	}
-	return result, nil
+	if pos < 0 || pos > len(t.shape) {
+		return nil, fmt.Errorf("unsqeeze: position %d out of range for shape %v", pos, t.shape)
+	}
+	shape := make([]int, 0, len(t.shape)+1)
+	shape = append(shape, t.shape[:pos]...)
+	shape = append(shape, 1)
+	shape = append(shape, t.shape[pos:]...)
+	strides := make([]int, 0, len(t.strides)+1)
+	strides = append(strides, t.strides[:pos]...)
+	strides = append(strides, 1)
+	strides = append(strides, t.strides[pos:]...)
+	return newView(t.data, shape, strides, t.offset), nil
 }
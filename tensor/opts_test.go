@@ -0,0 +1,127 @@
+package tensor
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMatmul(t *testing.T) {
+	matrix, _ := NewTensorInput([][]float64{{1, 2}, {3, 4}, {-1, 0.5}})
+	vector, _ := NewTensorInput([]float64{5, 6})
+	square, _ := NewTensorInput([][]float64{{1, -1}, {2, 0}})
+	transposed, _ := square.Transpose()
+	columns, _ := NewTensorInput([]float64{1, 1, 0, 1, 2, -1})
+	tests := []struct {
+		name  string
+		a, b  *Tensor
+		shape []int
+		want  []float64
+	}{
+		{"vector vector", vector, vector, []int{1}, []float64{61}},
+		// (m, k) * (k) used to add the elements instead of multiplying them
+		{"matrix vector", matrix, vector, []int{3}, []float64{17, 39, -2}},
+		{"matrix matrix", matrix, square, []int{3, 2}, []float64{5, -1, 11, -3, 0, 1}},
+		{"transposed view", matrix, transposed, []int{3, 2}, []float64{-1, 2, -1, 6, -1.5, -2}},
+		{"batched", arange(t, 2, 2, 2), reshape(t, square, 1, 2, 2), []int{2, 2, 2}, []float64{2, 0, 8, -2, 14, -4, 20, -6}},
+		// (2, 1) and (1, 3) batches broadcast to (2, 3)
+		{"broadcast batches", arange(t, 2, 1, 1, 2), reshape(t, columns, 1, 3, 2, 1), []int{2, 3, 1, 1}, []float64{1, 1, -1, 5, 3, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Matmul(tt.a, tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got.Shape(), tt.shape) || !slices.Equal(got.Data(), tt.want) {
+				t.Errorf("got %v with shape %v, expected %v with shape %v", got.Data(), got.Shape(), tt.want, tt.shape)
+			}
+		})
+	}
+}
+
+func TestMatmulErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b *Tensor
+	}{
+		{"inner dims", arange(t, 2, 2, 3), arange(t, 2, 2, 3)},
+		{"batch dims", arange(t, 2, 2, 2), arange(t, 3, 2, 2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Matmul(tt.a, tt.b); err == nil {
+				t.Errorf("%v * %v gave no error", tt.a.Shape(), tt.b.Shape())
+			}
+		})
+	}
+}
+
+func TestConcat(t *testing.T) {
+	ones, _ := NewTensorOnes(2, 1, 2)
+	transposed, _ := arange(t, 2, 2).Transpose()
+	tests := []struct {
+		name  string
+		axis  int
+		ts    []*Tensor
+		shape []int
+		want  []float64
+	}{
+		{"first axis", 0, []*Tensor{arange(t, 1, 2), arange(t, 2, 2)}, []int{3, 2}, []float64{0, 1, 0, 1, 2, 3}},
+		{"middle axis", 1, []*Tensor{arange(t, 2, 2, 2), ones}, []int{2, 3, 2}, []float64{0, 1, 2, 3, 1, 1, 4, 5, 6, 7, 1, 1}},
+		{"last axis", -1, []*Tensor{arange(t, 2, 1), arange(t, 2, 2), arange(t, 2, 1)}, []int{2, 4}, []float64{0, 0, 1, 0, 1, 2, 3, 1}},
+		{"strided view", 1, []*Tensor{transposed, arange(t, 2, 1)}, []int{2, 3}, []float64{0, 2, 0, 1, 3, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Concat(tt.axis, tt.ts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got.Shape(), tt.shape) || !slices.Equal(got.Data(), tt.want) {
+				t.Errorf("got %v with shape %v, expected %v with shape %v", got.Data(), got.Shape(), tt.want, tt.shape)
+			}
+		})
+	}
+}
+
+func TestConcatErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		axis int
+		ts   []*Tensor
+	}{
+		{"no tensors", 0, nil},
+		{"axis out of range", 2, []*Tensor{arange(t, 2, 2)}},
+		{"different ranks", 0, []*Tensor{arange(t, 2, 2), arange(t, 2)}},
+		{"other dims differ", 0, []*Tensor{arange(t, 2, 2), arange(t, 2, 3)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Concat(tt.axis, tt.ts...); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestNarrowSplitsConcat(t *testing.T) {
+	// the Concat layer splits its gradient back into the branch outputs with
+	// Narrow, which must give every input back in order
+	parts := []*Tensor{arange(t, 2, 1, 3), reshape(t, arange(t, 12), 2, 2, 3), arange(t, 2, 3, 3)}
+	joined, err := Concat(1, parts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := 0
+	for i, part := range parts {
+		size := part.Shape()[1]
+		got, err := joined.Narrow(1, start, size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got.Shape(), part.Shape()) || !slices.Equal(got.Values(), part.Values()) {
+			t.Errorf("part %d is %v with shape %v, expected %v with shape %v", i, got.Values(), got.Shape(), part.Values(), part.Shape())
+		}
+		start += size
+	}
+}
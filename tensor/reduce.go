@@ -0,0 +1,279 @@
+package tensor
+
+import (
+	"fmt"
+	"math"
+)
+
+// The reductions below take a keepDims flag and the axes to reduce over.
+// Giving no axes reduces over every axis, negative axes count from the end.
+// With keepDims the reduced axes stay in the shape with size 1 so the result
+// broadcasts against the input, otherwise they are dropped. Reducing every
+// axis without keepDims gives a one element tensor of shape [1].
+
+// Works out which dimensions get reduced
+func (t *Tensor) reduceMask(name string, axes []int) ([]bool, error) {
+	mask := make([]bool, len(t.shape))
+	if len(axes) == 0 {
+		for i := range mask {
+			mask[i] = true
+		}
+		return mask, nil
+	}
+	for _, a := range axes {
+		d, err := t.axis(a)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if mask[d] {
+			return nil, fmt.Errorf("%s: axis %d repeated in %v", name, a, axes)
+		}
+		mask[d] = true
+	}
+	return mask, nil
+}
+
+// Gives the shape with the reduced dimensions set to 1 and the strides that
+// spread a tensor of that shape back over the full shape
+func keptShape(shape []int, mask []bool) ([]int, []int) {
+	kept := make([]int, len(shape))
+	for i, dim := range shape {
+		kept[i] = dim
+		if mask[i] {
+			kept[i] = 1
+		}
+	}
+	spread := contiguousStrides(kept)
+	for i := range spread {
+		if mask[i] {
+			spread[i] = 0
+		}
+	}
+	return kept, spread
+}
+
+// Drops the reduced dimensions of a keepDims result unless asked to keep them
+func squeezeReduced(t *Tensor, mask []bool, keepDims bool) (*Tensor, error) {
+	if keepDims {
+		return t, nil
+	}
+	var shape []int
+	for i, dim := range t.shape {
+		if !mask[i] {
+			shape = append(shape, dim)
+		}
+	}
+	if len(shape) == 0 {
+		shape = []int{1}
+	}
+	return t.Reshape(shape...)
+}
+
+// Folds fn over the reduced axes starting from init
+func (t *Tensor) reduce(name string, keepDims bool, axes []int, init float64, fn func(acc, x float64) float64) (*Tensor, error) {
+	mask, err := t.reduceMask(name, axes)
+	if err != nil {
+		return nil, err
+	}
+	kept, spread := keptShape(t.shape, mask)
+	result, _ := NewTensor(kept...)
+	for i := range result.data {
+		result.data[i] = init
+	}
+	out := newView(result.data, t.shape, spread, 0)
+	walk(t.shape, []*Tensor{t, out}, func(i int, idx []int) {
+		result.data[idx[1]] = fn(result.data[idx[1]], t.data[idx[0]])
+	})
+	return squeezeReduced(result, mask, keepDims)
+}
+
+// Gives the position of the value picked by better inside the reduced axes,
+// counted in row major order over those axes
+func (t *Tensor) argReduce(name string, keepDims bool, axes []int, better func(x, best float64) bool) (*Tensor, error) {
+	mask, err := t.reduceMask(name, axes)
+	if err != nil {
+		return nil, err
+	}
+	kept, spread := keptShape(t.shape, mask)
+	result, _ := NewTensor(kept...)
+	best := make([]float64, result.size)
+	seen := make([]bool, result.size)
+
+	// strides that count positions over the reduced axes only
+	posStrides := make([]int, len(t.shape))
+	stride := 1
+	for i := len(t.shape) - 1; i >= 0; i-- {
+		if mask[i] {
+			posStrides[i] = stride
+			stride *= t.shape[i]
+		}
+	}
+	out := newView(result.data, t.shape, spread, 0)
+	pos := newView(nil, t.shape, posStrides, 0)
+	walk(t.shape, []*Tensor{t, out, pos}, func(i int, idx []int) {
+		x := t.data[idx[0]]
+		if !seen[idx[1]] || better(x, best[idx[1]]) {
+			seen[idx[1]] = true
+			best[idx[1]] = x
+			result.data[idx[1]] = float64(idx[2])
+		}
+	})
+	return squeezeReduced(result, mask, keepDims)
+}
+
+// Number of elements that go into each reduced value
+func (t *Tensor) reducedCount(mask []bool) int {
+	count := 1
+	for i, dim := range t.shape {
+		if mask[i] {
+			count *= dim
+		}
+	}
+	return count
+}
+
+// Sum over the given axes
+func (t *Tensor) SumAxis(keepDims bool, axes ...int) (*Tensor, error) {
+	return t.reduce("sumAxis", keepDims, axes, 0, func(acc, x float64) float64 {
+		return acc + x
+	})
+}
+
+// Product over the given axes
+func (t *Tensor) Prod(keepDims bool, axes ...int) (*Tensor, error) {
+	return t.reduce("prod", keepDims, axes, 1, func(acc, x float64) float64 {
+		return acc * x
+	})
+}
+
+// Mean over the given axes
+func (t *Tensor) Mean(keepDims bool, axes ...int) (*Tensor, error) {
+	mask, err := t.reduceMask("mean", axes)
+	if err != nil {
+		return nil, err
+	}
+	sum, err := t.SumAxis(keepDims, axes...)
+	if err != nil {
+		return nil, err
+	}
+	return sum.MulScalar(1.0 / float64(t.reducedCount(mask)))
+}
+
+// Largest value over the given axes
+func (t *Tensor) Max(keepDims bool, axes ...int) (*Tensor, error) {
+	return t.reduce("max", keepDims, axes, math.Inf(-1), math.Max)
+}
+
+// Smallest value over the given axes
+func (t *Tensor) Min(keepDims bool, axes ...int) (*Tensor, error) {
+	return t.reduce("min", keepDims, axes, math.Inf(1), math.Min)
+}
+
+// Index of the largest value over the given axes, the first one wins ties
+func (t *Tensor) ArgMax(keepDims bool, axes ...int) (*Tensor, error) {
+	return t.argReduce("argMax", keepDims, axes, func(x, best float64) bool {
+		return x > best
+	})
+}
+
+// Index of the smallest value over the given axes, the first one wins ties
+func (t *Tensor) ArgMin(keepDims bool, axes ...int) (*Tensor, error) {
+	return t.argReduce("argMin", keepDims, axes, func(x, best float64) bool {
+		return x < best
+	})
+}
+
+// Population variance over the given axes (divides by the count, not count-1)
+func (t *Tensor) Var(keepDims bool, axes ...int) (*Tensor, error) {
+	mean, err := t.Mean(true, axes...)
+	if err != nil {
+		return nil, err
+	}
+	diff, err := TensorDiff(t, mean)
+	if err != nil {
+		return nil, err
+	}
+	square, err := diff.Apply(func(x float64) float64 {
+		return x * x
+	})
+	if err != nil {
+		return nil, err
+	}
+	return square.Mean(keepDims, axes...)
+}
+
+// Population standard deviation over the given axes
+func (t *Tensor) Std(keepDims bool, axes ...int) (*Tensor, error) {
+	variance, err := t.Var(keepDims, axes...)
+	if err != nil {
+		return nil, err
+	}
+	return variance.Apply(math.Sqrt)
+}
+
+// log(sum(exp(x))) over the given axes, shifted by the max so it does not overflow
+func (t *Tensor) LogSumExp(keepDims bool, axes ...int) (*Tensor, error) {
+	mask, err := t.reduceMask("logSumExp", axes)
+	if err != nil {
+		return nil, err
+	}
+	shift, err := t.Max(true, axes...)
+	if err != nil {
+		return nil, err
+	}
+	// a slice that is all -inf would give nan when shifted by itself
+	shift, _ = shift.Apply(func(x float64) float64 {
+		if math.IsInf(x, 0) {
+			return 0
+		}
+		return x
+	})
+	shifted, err := TensorDiff(t, shift)
+	if err != nil {
+		return nil, err
+	}
+	shifted, _ = shifted.Apply(math.Exp)
+	sum, err := shifted.SumAxis(true, axes...)
+	if err != nil {
+		return nil, err
+	}
+	sum, _ = sum.Apply(math.Log)
+	result, err := TensorAdd(sum, shift)
+	if err != nil {
+		return nil, err
+	}
+	return squeezeReduced(result, mask, keepDims)
+}
+
+// The p norm over the given axes, p can be math.Inf(1) for the max norm
+func (t *Tensor) Norm(p float64, keepDims bool, axes ...int) (*Tensor, error) {
+	switch {
+	case p <= 0:
+		return nil, fmt.Errorf("norm: p must be positive got %v", p)
+	case math.IsInf(p, 1):
+		return t.reduce("norm", keepDims, axes, 0, func(acc, x float64) float64 {
+			return math.Max(acc, math.Abs(x))
+		})
+	case p == 1:
+		return t.reduce("norm", keepDims, axes, 0, func(acc, x float64) float64 {
+			return acc + math.Abs(x)
+		})
+	case p == 2:
+		sum, err := t.reduce("norm", keepDims, axes, 0, func(acc, x float64) float64 {
+			return acc + x*x
+		})
+		if err != nil {
+			return nil, err
+		}
+		return sum.Apply(math.Sqrt)
+	}
+	sum, err := t.reduce("norm", keepDims, axes, 0, func(acc, x float64) float64 {
+		return acc + math.Pow(math.Abs(x), p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sum.Apply(func(x float64) float64 {
+		return math.Pow(x, 1/p)
+	})
+}
@@ -0,0 +1,134 @@
+package tensor
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+type reduction func(t *Tensor, keepDims bool, axes ...int) (*Tensor, error)
+
+func TestReductions(t *testing.T) {
+	// [[1, 5, 3], [4, 2, 6]]
+	a, _ := NewTensorInput([][]float64{{1, 5, 3}, {4, 2, 6}})
+	ties, _ := NewTensorInput([][]float64{{2, 7, 7}, {2, -8, 7}})
+	norm := func(p float64) reduction {
+		return func(t *Tensor, keepDims bool, axes ...int) (*Tensor, error) {
+			return t.Norm(p, keepDims, axes...)
+		}
+	}
+	tests := []struct {
+		name     string
+		reduce   reduction
+		input    *Tensor
+		keepDims bool
+		axes     []int
+		shape    []int
+		want     []float64
+	}{
+		{"sum rows", (*Tensor).SumAxis, a, false, []int{0}, []int{3}, []float64{5, 7, 9}},
+		{"sum columns kept", (*Tensor).SumAxis, a, true, []int{-1}, []int{2, 1}, []float64{9, 12}},
+		{"sum all", (*Tensor).SumAxis, a, false, nil, []int{1}, []float64{21}},
+		{"sum all kept", (*Tensor).SumAxis, a, true, []int{0, 1}, []int{1, 1}, []float64{21}},
+		{"prod", (*Tensor).Prod, a, false, []int{1}, []int{2}, []float64{15, 48}},
+		{"mean", (*Tensor).Mean, a, true, []int{0}, []int{1, 3}, []float64{2.5, 3.5, 4.5}},
+		{"max", (*Tensor).Max, a, false, []int{-1}, []int{2}, []float64{5, 6}},
+		{"min", (*Tensor).Min, a, true, []int{0}, []int{1, 3}, []float64{1, 2, 3}},
+		{"argMax", (*Tensor).ArgMax, a, false, []int{1}, []int{2}, []float64{1, 2}},
+		{"argMin kept", (*Tensor).ArgMin, a, true, []int{0}, []int{1, 3}, []float64{0, 1, 0}},
+		// positions over several axes count in row major order
+		{"argMax all", (*Tensor).ArgMax, a, false, nil, []int{1}, []float64{5}},
+		{"argMax first tie", (*Tensor).ArgMax, ties, false, []int{1}, []int{2}, []float64{1, 2}},
+		{"argMin first tie", (*Tensor).ArgMin, ties, false, []int{0}, []int{3}, []float64{0, 1, 0}},
+		{"var", (*Tensor).Var, a, false, []int{0}, []int{3}, []float64{2.25, 2.25, 2.25}},
+		{"std", (*Tensor).Std, a, true, []int{0}, []int{1, 3}, []float64{1.5, 1.5, 1.5}},
+		{"logSumExp", (*Tensor).LogSumExp, a, false, []int{1}, []int{2}, []float64{
+			math.Log(math.Exp(1) + math.Exp(5) + math.Exp(3)),
+			math.Log(math.Exp(4) + math.Exp(2) + math.Exp(6)),
+		}},
+		{"norm inf", norm(math.Inf(1)), ties, false, []int{1}, []int{2}, []float64{7, 8}},
+		{"norm 1", norm(1), a, false, []int{0}, []int{3}, []float64{5, 7, 9}},
+		{"norm 2", norm(2), a, false, nil, []int{1}, []float64{math.Sqrt(91)}},
+		{"norm 3", norm(3), a, true, []int{1}, []int{2, 1}, []float64{math.Cbrt(153), math.Cbrt(288)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.reduce(tt.input, tt.keepDims, tt.axes...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got.Shape(), tt.shape) {
+				t.Fatalf("shape %v, expected %v", got.Shape(), tt.shape)
+			}
+			for i, want := range tt.want {
+				if math.Abs(got.Data()[i]-want) > 1e-12 {
+					t.Errorf("got %v, expected %v", got.Data(), tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestReduceAxes(t *testing.T) {
+	a, _ := NewTensor(2, 3, 4)
+	for i := range a.data {
+		a.data[i] = float64(i)
+	}
+	// summing axes 0 and 2 of a 2x3x4 arange, given as negative axes
+	got, err := a.SumAxis(false, -1, -3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{0 + 1 + 2 + 3 + 12 + 13 + 14 + 15, 4 + 5 + 6 + 7 + 16 + 17 + 18 + 19, 8 + 9 + 10 + 11 + 20 + 21 + 22 + 23}
+	if !slices.Equal(got.Shape(), []int{3}) || !slices.Equal(got.Data(), want) {
+		t.Errorf("got %v with shape %v, expected %v", got.Data(), got.Shape(), want)
+	}
+
+	// a strided view reduces the same as its contiguous copy
+	permuted, _ := a.Permute(2, 0, 1)
+	got, err = permuted.ArgMax(false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, idx := range got.Data() {
+		if idx != 3 {
+			t.Fatalf("argMax over the last axis of an arange gave %v", got.Data())
+		}
+	}
+
+	for _, axes := range [][]int{{0, 0}, {1, -2}, {3}, {-4}} {
+		if _, err := a.SumAxis(false, axes...); err == nil {
+			t.Errorf("axes %v gave no error", axes)
+		}
+	}
+}
+
+func TestLogSumExpOfNegativeInfinity(t *testing.T) {
+	inf := math.Inf(-1)
+	a, _ := NewTensorInput([][]float64{{inf, inf}, {0, inf}})
+	got, err := a.LogSumExp(false, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a row of only -inf sums to exp(-inf) = 0 so its log is -inf, not nan
+	if d := got.Data(); !math.IsInf(d[0], -1) || d[1] != 0 {
+		t.Errorf("got %v, expected [-Inf 0]", d)
+	}
+
+	// large values do not overflow
+	big, _ := NewTensorInput([]float64{1000, 1000})
+	got, _ = big.LogSumExp(false)
+	if want := 1000 + math.Log(2); math.Abs(got.Data()[0]-want) > 1e-9 {
+		t.Errorf("got %v, expected %v", got.Data()[0], want)
+	}
+}
+
+func TestNormNeedsPositiveP(t *testing.T) {
+	a, _ := NewTensor(2)
+	for _, p := range []float64{0, -1} {
+		if _, err := a.Norm(p, false); err == nil {
+			t.Errorf("p = %v gave no error", p)
+		}
+	}
+}
@@ -2,8 +2,8 @@ package tensor
 
 import (
 	"fmt"
-	"math/rand"
 	"nnscratch/maths"
+	"nnscratch/random"
 	"reflect"
 )
 
@@ -12,6 +12,7 @@ type Tensor struct {
 	data    []float64
 	strides []int
 	size    int
+	offset  int
 }
 
 // Takes a multidimentional array and converts it to a tensor
@@ -76,20 +77,25 @@ func NewTensor(shape ...int) (*Tensor, error) {
 		size *= dim
 	}
 
+	// copy the shape so the new tensor never aliases the caller's slice
+	shape = append([]int(nil), shape...)
+	return &Tensor{
+		shape:   shape,
+		data:    make([]float64, size),
+		strides: contiguousStrides(shape),
+		size:    size,
+	}, nil
+}
+
+// Gives the row major strides for the given shape
+func contiguousStrides(shape []int) []int {
 	strides := make([]int, len(shape))
 	stride := 1
-
 	for i := len(shape) - 1; i >= 0; i-- {
 		strides[i] = stride
 		stride *= shape[i]
 	}
-
-	return &Tensor{
-		shape:   shape,
-		data:    make([]float64, size),
-		strides: strides,
-		size:    size,
-	}, nil
+	return strides
 }
 
 // Creates new tensor of the shape with 1 for all the vales
@@ -104,13 +110,19 @@ func NewTensorOnes(shape ...int) (*Tensor, error) {
 	return t, nil
 }
 
+// Gives a tensor of N(0, 0.01) values drawn from the default generator
 func NewTensorRandom(shape ...int) (*Tensor, error) {
+	return NewTensorRandomFrom(random.Default(), shape...)
+}
+
+// Gives a tensor of N(0, 0.01) values drawn from g
+func NewTensorRandomFrom(g *random.Generator, shape ...int) (*Tensor, error) {
 	res, err := NewTensor(shape...)
 	if err != nil {
 		return nil, err
 	}
 	for i := range res.data {
-		res.data[i] = rand.NormFloat64() * 0.01
+		res.data[i] = g.NormFloat64() * 0.01
 	}
 	return res, nil
 }
@@ -121,7 +133,7 @@ func (t *Tensor) getIndex(coords ...int) (int, error) {
 		return 0, fmt.Errorf("getIndex error: invalid coordinates for the get function")
 	}
 
-	index := 0
+	index := t.offset
 	for i, coord := range coords {
 		if coord < 0 || coord >= t.shape[i] {
 			return 0, fmt.Errorf(" getIndex error: coordinate %d out of bound for dimention %d", coord, i)
@@ -146,22 +158,34 @@ func (t *Tensor) SetTensor(val *Tensor, coords ...int) error {
 	if len(coords) >= len(t.shape) {
 		return fmt.Errorf("setTensor: the given tensor has the wrong shape for assigning tensors %v", t.shape)
 	}
+	if len(val.shape) > len(t.shape) {
+		return fmt.Errorf("setTensor: the shapes do not match")
+	}
 	for i := 0; i < len(val.shape); i++ {
 		if val.shape[len(val.shape)-1-i] != t.shape[len(t.shape)-1-i] {
 			return fmt.Errorf("setTensor: the shapes do not match")
 		}
 	}
-	start := 0
-	for i := 0; i < len(t.shape)-len(val.shape); i++ {
-		start += coords[i] * t.strides[i]
+	lead := len(t.shape) - len(val.shape)
+	if len(coords) < lead {
+		return fmt.Errorf("setTensor: need %d coordinates to place a tensor of shape %v in %v", lead, val.shape, t.shape)
 	}
-	for i := 0; i < len(val.data); i++ {
-		t.data[i+start] = val.data[i]
+	dst := t
+	if lead > 0 {
+		var err error
+		dst, err = t.Slice(coords[:lead]...)
+		if err != nil {
+			return err
+		}
 	}
+	src := val.values()
+	dst.forEach(func(i, idx int) {
+		dst.data[idx] = src[i]
+	})
 	return nil
 }
 
-// Give the sub tensor at the given coords
+// Give the sub tensor at the given coords, the result shares data with t
 func (t *Tensor) Slice(coords ...int) (*Tensor, error) {
 	if len(coords) == 0 {
 		return nil, fmt.Errorf("slice error: slice must have atleast one coords")
@@ -170,62 +194,30 @@ func (t *Tensor) Slice(coords ...int) (*Tensor, error) {
 		return nil, fmt.Errorf("slice error: too many coordinates for a slice use get for single elements")
 	}
 
-	// return the single value as a one element tensor if called with slice
-	if len(coords) == len(t.shape) {
-		data, err := t.Get(coords...)
-		if err != nil {
-			return nil, err
+	start := t.offset
+	for i, coord := range coords {
+		if coord < 0 || coord >= t.shape[i] {
+			return nil, fmt.Errorf("slice error: coordinate %d out of bound for dimention %d of %v", coord, i, t.shape)
 		}
-		return &Tensor{
-			shape:   []int{1},
-			data:    []float64{data},
-			strides: []int{1},
-			size:    1,
-		}, nil
+		start += coord * t.strides[i]
 	}
 
-	newDim := len(coords)
-	newShape := t.shape[newDim:]
-	newStrides := t.strides[newDim:]
-	newSize := 1
-	for _, dim := range newShape {
-		newSize *= dim
-	}
-	startIndex := 0
-	for i := range coords {
-		startIndex += coords[i] * t.strides[i]
-	}
-	if startIndex+newSize > len(t.data) {
-		return nil, fmt.Errorf("slice: the given slice %d is out of bounds for the given tensor of %d", startIndex+newSize, len(t.data))
+	// a single value is returned as a one element tensor if called with slice
+	if len(coords) == len(t.shape) {
+		return newView(t.data, []int{1}, []int{1}, start), nil
 	}
-	newData := t.data[startIndex : startIndex+newSize]
-
-	return &Tensor{
-		shape:   newShape,
-		size:    newSize,
-		strides: newStrides,
-		data:    newData,
-	}, nil
+	return newView(t.data, t.shape[len(coords):], t.strides[len(coords):], start), nil
 }
 
-// Give a piece of the tensor without changing dim t[m:n]
-func (t * Tensor) View(a int, b int) (*Tensor, error) {
-	if (a < 0 || b > t.shape[0]) {
+// Give a piece of the tensor without changing dim t[m:n], the result shares data with t
+func (t *Tensor) View(a int, b int) (*Tensor, error) {
+	if a < 0 || b > t.shape[0] {
 		return nil, fmt.Errorf("view: The given inputs are not in range of (0, %v) they are (%v, %v)", t.shape[0], a, b)
 	}
-	if (a > b) {
+	if a > b {
 		return nil, fmt.Errorf("view: first input should be less than the second input they are %v, %v", a, b)
 	}
-	NewShape := t.shape
-	NewShape[0] = b - a
-	res, err := NewTensor(NewShape...)
-	if err != nil {
-		return nil, err
-	}
-	for i:=a*t.strides[0]; i<b*t.strides[0]; i++ {
-		res.data[i-a*t.strides[0]] = t.data[i]
-	}
-	return res, nil
+	return t.Narrow(0, a, b-a)
 }
 
 // Check if the shapes of the given tensors match
@@ -258,7 +250,7 @@ func (t *Tensor) GetBatchElements(indices []int) (*Tensor, error) {
 // Shows a given tensor in the terminal
 func (t Tensor) Show() {
 	if len(t.shape) == 1 {
-		fmt.Printf("%v", t.data)
+		fmt.Printf("%v", t.values())
 		return
 	}
 	fmt.Printf("\n")
@@ -271,26 +263,25 @@ func (t Tensor) Show() {
 // Copies one tensor to a new variable that it is assigned to
 func (t *Tensor) Copy() *Tensor {
 	newt, _ := NewTensor(t.shape...)
-	copy(newt.data, t.data)
+	copy(newt.data, t.values())
 	return newt
 }
 
-
 // Apply func that applies a float to float function on a tensor
 func (t *Tensor) Apply(fn func(float64) float64) (*Tensor, error) {
 	result, err := NewTensor(t.shape...)
 	if err != nil {
 		return nil, err
 	}
-	for i := range t.data {
-		result.data[i] = fn(t.data[i])
+	for i, val := range t.values() {
+		result.data[i] = fn(val)
 	}
 	return result, nil
 }
 
 // Get length of the tensor data 
 func (t *Tensor) Len() int {
-	return len(t.data)
+	return t.size
 }
 
 func (t *Tensor) Power(a float64) (*Tensor, error) {
@@ -298,8 +289,8 @@ func (t *Tensor) Power(a float64) (*Tensor, error) {
 	if err != nil {
 		return nil, err
 	}
-	for i := range t.data {
-		result.data[i] = maths.Power(t.data[i], a) 
+	for i, val := range t.values() {
+		result.data[i] = maths.Power(val, a) 
 	}
 	return result, nil
 }
@@ -308,6 +299,22 @@ func (t *Tensor) Shape() []int {
 	return t.shape 
 }
 
+func (t *Tensor) Strides() []int {
+	return t.strides
+}
+
+// Gives the storage of a contiguous tensor in row major order, so writes are
+// seen by every view sharing it. Panics if the tensor is not contiguous, use
+// Values to read one or Contiguous to get a copy that can be written
 func (t *Tensor) Data() []float64 {
-	return t.data
+	if !t.IsContiguous() {
+		panic(fmt.Sprintf("data: tensor of shape %v with strides %v is not contiguous", t.shape, t.strides))
+	}
+	return t.data[t.offset : t.offset+t.size]
+}
+
+// Gives the values in row major order for reading. It is the storage when
+// the tensor is contiguous and a copy otherwise, so it must not be written
+func (t *Tensor) Values() []float64 {
+	return t.values()
 }
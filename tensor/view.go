@@ -0,0 +1,196 @@
+package tensor
+
+import (
+	"fmt"
+)
+
+// A tensor is a window over its data slice: element (i, j, ...) lives at
+// data[offset + i*strides[0] + j*strides[1] + ...]. Views share data with
+// the tensor they came from and only differ in shape, strides and offset,
+// so they are O(1) to make. Call Contiguous to get a row major copy.
+
+// Makes a tensor that shares data, copying shape and strides so the view
+// never aliases the slices of the tensor it came from
+func newView(data []float64, shape []int, strides []int, offset int) *Tensor {
+	size := 1
+	for _, dim := range shape {
+		size *= dim
+	}
+	return &Tensor{
+		shape:   append([]int(nil), shape...),
+		data:    data,
+		strides: append([]int(nil), strides...),
+		size:    size,
+		offset:  offset,
+	}
+}
+
+// Turns a possibly negative axis into its position in the shape
+func (t *Tensor) axis(dim int) (int, error) {
+	if dim < 0 {
+		dim += len(t.shape)
+	}
+	if dim < 0 || dim >= len(t.shape) {
+		return 0, fmt.Errorf("axis: dimension %d out of range for shape %v", dim, t.shape)
+	}
+	return dim, nil
+}
+
+// Check if the tensor is laid out in row major order without gaps
+func (t *Tensor) IsContiguous() bool {
+	expected := 1
+	for i := len(t.shape) - 1; i >= 0; i-- {
+		// the stride of a dimension of size 1 is never used
+		if t.shape[i] != 1 && t.strides[i] != expected {
+			return false
+		}
+		expected *= t.shape[i]
+	}
+	return true
+}
+
+// Gives t if it is already contiguous otherwise a row major copy of it
+func (t *Tensor) Contiguous() *Tensor {
+	if t.IsContiguous() {
+		return t
+	}
+	return t.Copy()
+}
+
+// Gives the values in row major order without copying when possible
+func (t *Tensor) values() []float64 {
+	if t.IsContiguous() {
+		return t.data[t.offset : t.offset+t.size]
+	}
+	result := make([]float64, t.size)
+	t.forEach(func(i, idx int) {
+		result[i] = t.data[idx]
+	})
+	return result
+}
+
+// Calls fn for every element in row major order with its position i and
+// its index idx into the data
+func (t *Tensor) forEach(fn func(i, idx int)) {
+	if t.IsContiguous() {
+		for i := 0; i < t.size; i++ {
+			fn(i, t.offset+i)
+		}
+		return
+	}
+	coords := make([]int, len(t.shape))
+	idx := t.offset
+	for i := 0; i < t.size; i++ {
+		fn(i, idx)
+		for d := len(t.shape) - 1; d >= 0; d-- {
+			coords[d]++
+			idx += t.strides[d]
+			if coords[d] < t.shape[d] {
+				break
+			}
+			idx -= coords[d] * t.strides[d]
+			coords[d] = 0
+		}
+	}
+}
+
+// Narrow gives length elements along dim starting at start, sharing data with t
+func (t *Tensor) Narrow(dim, start, length int) (*Tensor, error) {
+	dim, err := t.axis(dim)
+	if err != nil {
+		return nil, err
+	}
+	if start < 0 || length <= 0 || start+length > t.shape[dim] {
+		return nil, fmt.Errorf("narrow: range [%d, %d) is not inside dimension %d of %v", start, start+length, dim, t.shape)
+	}
+	result := newView(t.data, t.shape, t.strides, t.offset+start*t.strides[dim])
+	result.shape[dim] = length
+	result.size = t.size / t.shape[dim] * length
+	return result, nil
+}
+
+// SliceRange gives t[start:end:step] along dim, sharing data with t
+func (t *Tensor) SliceRange(dim, start, end, step int) (*Tensor, error) {
+	dim, err := t.axis(dim)
+	if err != nil {
+		return nil, err
+	}
+	if step <= 0 {
+		return nil, fmt.Errorf("sliceRange: step must be positive got %d", step)
+	}
+	if start < 0 || end > t.shape[dim] || start >= end {
+		return nil, fmt.Errorf("sliceRange: range [%d, %d) is not inside dimension %d of %v", start, end, dim, t.shape)
+	}
+	result := newView(t.data, t.shape, t.strides, t.offset+start*t.strides[dim])
+	result.shape[dim] = (end - start + step - 1) / step
+	result.strides[dim] *= step
+	result.size = t.size / t.shape[dim] * result.shape[dim]
+	return result, nil
+}
+
+// Swaps two dimensions of the tensor, sharing data with t
+func (t *Tensor) TransposeAxes(dim0, dim1 int) (*Tensor, error) {
+	dim0, err := t.axis(dim0)
+	if err != nil {
+		return nil, err
+	}
+	dim1, err = t.axis(dim1)
+	if err != nil {
+		return nil, err
+	}
+	result := newView(t.data, t.shape, t.strides, t.offset)
+	result.shape[dim0], result.shape[dim1] = result.shape[dim1], result.shape[dim0]
+	result.strides[dim0], result.strides[dim1] = result.strides[dim1], result.strides[dim0]
+	return result, nil
+}
+
+// Reorders the dimensions, dimension i of the result is dimension dims[i] of t
+func (t *Tensor) Permute(dims ...int) (*Tensor, error) {
+	if len(dims) != len(t.shape) {
+		return nil, fmt.Errorf("permute: need %d dimensions for shape %v got %v", len(t.shape), t.shape, dims)
+	}
+	shape := make([]int, len(dims))
+	strides := make([]int, len(dims))
+	seen := make([]bool, len(dims))
+	for i, d := range dims {
+		d, err := t.axis(d)
+		if err != nil {
+			return nil, err
+		}
+		if seen[d] {
+			return nil, fmt.Errorf("permute: dimension %d repeated in %v", d, dims)
+		}
+		seen[d] = true
+		shape[i] = t.shape[d]
+		strides[i] = t.strides[d]
+	}
+	return newView(t.data, shape, strides, t.offset), nil
+}
+
+// Expand repeats dimensions of size 1 to the given shape without copying,
+// new leading dimensions can be added as well [3, 1] -> [2, 3, 4]
+func (t *Tensor) Expand(shape ...int) (*Tensor, error) {
+	if len(shape) < len(t.shape) {
+		return nil, fmt.Errorf("expand: cannot expand %v to fewer dimensions %v", t.shape, shape)
+	}
+	lead := len(shape) - len(t.shape)
+	strides := make([]int, len(shape))
+	for i := range shape {
+		if i < lead {
+			if shape[i] <= 0 {
+				return nil, fmt.Errorf("expand: dimensions must be positive :%v", shape)
+			}
+			continue
+		}
+		dim := t.shape[i-lead]
+		switch {
+		case dim == shape[i]:
+			strides[i] = t.strides[i-lead]
+		case dim == 1 && shape[i] > 0:
+			strides[i] = 0
+		default:
+			return nil, fmt.Errorf("expand: cannot expand %v to %v", t.shape, shape)
+		}
+	}
+	return newView(t.data, shape, strides, t.offset), nil
+}
@@ -0,0 +1,171 @@
+package tensor
+
+import (
+	"slices"
+	"testing"
+)
+
+// A tensor of the given shape holding 0, 1, 2, ... in row major order
+func arange(t *testing.T, shape ...int) *Tensor {
+	t.Helper()
+	result, err := NewTensor(shape...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range result.data {
+		result.data[i] = float64(i)
+	}
+	return result
+}
+
+func TestViewsShareStorage(t *testing.T) {
+	tests := []struct {
+		name string
+		view func(*Tensor) (*Tensor, error)
+		// coordinates in the view and the row major position in the base
+		// they land on
+		coords []int
+		at     int
+	}{
+		{"narrow", func(b *Tensor) (*Tensor, error) { return b.Narrow(1, 1, 2) }, []int{1, 1, 0}, 1*12 + 2*4},
+		{"sliceRange", func(b *Tensor) (*Tensor, error) { return b.SliceRange(2, 1, 4, 2) }, []int{0, 2, 1}, 2*4 + 3},
+		{"permute", func(b *Tensor) (*Tensor, error) { return b.Permute(2, 0, 1) }, []int{3, 1, 2}, 1*12 + 2*4 + 3},
+		{"transposeAxes", func(b *Tensor) (*Tensor, error) { return b.TransposeAxes(0, -1) }, []int{2, 1, 0}, 0*12 + 1*4 + 2},
+		{"reshape", func(b *Tensor) (*Tensor, error) { return b.Reshape(4, -1) }, []int{2, 5}, 2*6 + 5},
+		{"slice", func(b *Tensor) (*Tensor, error) { return b.Slice(1) }, []int{2, 3}, 1*12 + 2*4 + 3},
+		{"view", func(b *Tensor) (*Tensor, error) { return b.View(1, 2) }, []int{0, 1, 1}, 1*12 + 1*4 + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := arange(t, 2, 3, 4)
+			view, err := tt.view(base)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := view.Get(tt.coords...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != float64(tt.at) {
+				t.Fatalf("view%v is %v, expected %v", tt.coords, got, tt.at)
+			}
+			if err := view.Set(-1, tt.coords...); err != nil {
+				t.Fatal(err)
+			}
+			if base.data[tt.at] != -1 {
+				t.Errorf("writing the view did not change the base at %d", tt.at)
+			}
+		})
+	}
+}
+
+func TestExpandSharesStorage(t *testing.T) {
+	base := arange(t, 3, 1)
+	expanded, err := base.Expand(2, 3, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(expanded.Shape(), []int{2, 3, 4}) || !slices.Equal(expanded.Strides(), []int{0, 1, 0}) {
+		t.Fatalf("shape %v and strides %v, expected [2 3 4] and [0 1 0]", expanded.Shape(), expanded.Strides())
+	}
+	base.data[1] = 7
+	for _, coords := range [][]int{{0, 1, 0}, {1, 1, 3}} {
+		if got, _ := expanded.Get(coords...); got != 7 {
+			t.Errorf("expanded%v is %v, expected 7", coords, got)
+		}
+	}
+	if _, err := base.Expand(2, 4, 4); err == nil {
+		t.Error("expanding a dimension of size 3 to 4 gave no error")
+	}
+}
+
+func TestContiguous(t *testing.T) {
+	base := arange(t, 2, 3, 4)
+	permuted, err := base.Permute(2, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stepped, err := base.SliceRange(1, 0, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		view  *Tensor
+		shape []int
+		want  []float64
+	}{
+		{"permute", permuted, []int{4, 2, 3}, []float64{
+			0, 4, 8, 12, 16, 20,
+			1, 5, 9, 13, 17, 21,
+			2, 6, 10, 14, 18, 22,
+			3, 7, 11, 15, 19, 23,
+		}},
+		{"sliceRange", stepped, []int{2, 2, 4}, []float64{
+			0, 1, 2, 3, 8, 9, 10, 11,
+			12, 13, 14, 15, 20, 21, 22, 23,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.view.IsContiguous() {
+				t.Fatal("the view is contiguous")
+			}
+			c := tt.view.Contiguous()
+			if !c.IsContiguous() || !slices.Equal(c.Shape(), tt.shape) {
+				t.Fatalf("got shape %v contiguous %v, expected %v", c.Shape(), c.IsContiguous(), tt.shape)
+			}
+			if !slices.Equal(c.Data(), tt.want) {
+				t.Errorf("got %v, expected %v", c.Data(), tt.want)
+			}
+			if !slices.Equal(tt.view.Values(), tt.want) {
+				t.Errorf("values %v, expected %v", tt.view.Values(), tt.want)
+			}
+			// the copy has its own storage
+			c.Data()[0] = -1
+			if base.data[0] != 0 {
+				t.Error("writing the contiguous copy changed the base")
+			}
+		})
+	}
+	if base.Contiguous() != base {
+		t.Error("contiguous copied a tensor that was already contiguous")
+	}
+}
+
+func TestDataOfView(t *testing.T) {
+	base := arange(t, 2, 3)
+	row, _ := base.Slice(1)
+	row.Data()[0] = -1
+	if base.data[3] != -1 {
+		t.Error("data of a contiguous view is not its storage")
+	}
+
+	transposed, _ := base.Transpose()
+	defer func() {
+		if recover() == nil {
+			t.Error("data of a transposed tensor did not panic")
+		}
+	}()
+	transposed.Data()
+}
+
+func TestViewKeepsShape(t *testing.T) {
+	base := arange(t, 4, 2)
+	if _, err := base.View(1, 3); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(base.Shape(), []int{4, 2}) {
+		t.Errorf("view changed the shape of the tensor to %v", base.Shape())
+	}
+
+	shape := []int{2, 4}
+	reshaped, err := base.Reshape(shape...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shape[0] = 8
+	if !slices.Equal(reshaped.Shape(), []int{2, 4}) {
+		t.Errorf("changing the shape argument changed the tensor to %v", reshaped.Shape())
+	}
+}
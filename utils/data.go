@@ -1,7 +1,8 @@
 package utils
 
 import (
-	"math/rand"
+	"fmt"
+	"nnscratch/random"
 	"nnscratch/tensor"
 )
 
@@ -11,6 +12,7 @@ type DataLoader struct {
 	batchSize int
 	shuffle bool 
 	ignoreLast bool 
+	rng *random.Generator
 }
 
 func NewDataLoader(inputs, targets *tensor.Tensor, batchSize int, shuffle bool) *DataLoader {
@@ -23,6 +25,11 @@ func NewDataLoader(inputs, targets *tensor.Tensor, batchSize int, shuffle bool)
 	}
 }
 
+// Makes the loader shuffle with g instead of the default generator
+func (dl *DataLoader) SetGenerator(g *random.Generator) {
+	dl.rng = g
+}
+
 type BatchIterator struct {
 	loader *DataLoader
 	indices []int
@@ -37,7 +44,11 @@ func (dl *DataLoader) MakeIterator() *BatchIterator {
 		indices[i] = i 
 	}
 	if dl.shuffle {
-		rand.Shuffle(n, func(i, j int) {
+		rng := dl.rng
+		if rng == nil {
+			rng = random.Default()
+		}
+		rng.Shuffle(n, func(i, j int) {
 			indices[i], indices[j] = indices[j], indices[i]
 		})
 	}
@@ -80,5 +91,40 @@ func (it *BatchIterator) Get() (*tensor.Tensor, *tensor.Tensor) {
 	return xBatch, yBatch
 }
 
+// Where an iterator is in its epoch, enough to carry on after a restart
+type IteratorState struct {
+	Indices []int // sample order of the epoch
+	Current int   // samples already given out
+}
 
+func (it *BatchIterator) State() IteratorState {
+	indices := make([]int, len(it.indices))
+	copy(indices, it.indices)
+	return IteratorState{Indices: indices, Current: it.current}
+}
 
+// Makes an iterator that carries on from state, the loader must hold the same
+// number of samples as the one state was taken from
+func (dl *DataLoader) ResumeIterator(state IteratorState) (*BatchIterator, error) {
+	n := dl.inputs.Shape()[0]
+	if len(state.Indices) != n {
+		return nil, fmt.Errorf("dataloader: state has %d samples but the loader has %d", len(state.Indices), n)
+	}
+	if state.Current < 0 || state.Current > n {
+		return nil, fmt.Errorf("dataloader: position %d out of range for %d samples", state.Current, n)
+	}
+	seen := make([]bool, n)
+	for _, idx := range state.Indices {
+		if idx < 0 || idx >= n || seen[idx] {
+			return nil, fmt.Errorf("dataloader: state indices are not an order of the samples")
+		}
+		seen[idx] = true
+	}
+	indices := make([]int, n)
+	copy(indices, state.Indices)
+	return &BatchIterator{
+		loader: dl,
+		indices: indices,
+		current: state.Current,
+	}, nil
+}